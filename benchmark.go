@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Generate n overlapping periods of a single product over about a year of days,
+// the same seed gives the same periods
+func generatePeriods(n int, seed uint64) []periods.Period {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	generated := make([]periods.Period, n)
+	for i := range generated {
+		start := base.Add(time.Duration(rng.IntN(365)) * time.Hour * 24)
+		generated[i] = periods.Period{
+			ID:             i + 1,
+			PeriodStart:    start,
+			PeriodEnd:      start.Add(time.Duration(1+rng.IntN(60)) * time.Hour * 24),
+			Price:          periods.Price(rng.IntN(10000) * 100), // up to 99.99
+			ProdNum:        1,
+			PeriodPriority: 1 + rng.IntN(5),
+		}
+	}
+	return generated
+}
+
+// one benchmark measurement
+type BenchmarkResult struct {
+	Size       int
+	Duration   time.Duration
+	Iterations int
+}
+
+// Run the resolver over generated datasets of each size
+func runBenchmark(sizes []int, opts periods.ProcessOptions) ([]BenchmarkResult, error) {
+	opts.Logger, opts.Trace, opts.Removals = discardLogger, nil, nil
+	results := make([]BenchmarkResult, 0, len(sizes))
+	for _, size := range sizes {
+		iterations := 0
+		opts.Iterations = &iterations
+		input := generatePeriods(size, 1)
+		start := time.Now()
+		// conflicts in generated data only cost time, the run itself is what is measured
+		var conflicts *periods.ConflictsError
+		if _, err := periods.ProcessPeriods(input, opts); err != nil && !errors.As(err, &conflicts) {
+			return results, fmt.Errorf("benchmark of %d periods: %w", size, err)
+		}
+		results = append(results, BenchmarkResult{Size: size, Duration: time.Since(start), Iterations: iterations})
+	}
+	return results, nil
+}
+
+// Print benchmark results as a table, with growth relative to the previous size
+func printBenchmark(results []BenchmarkResult) {
+	fmt.Printf("%8s %14s %12s %8s\n", "size", "duration", "iterations", "growth")
+	for i, r := range results {
+		growth := "-"
+		if i > 0 && results[i-1].Duration > 0 {
+			growth = fmt.Sprintf("%.1fx", float64(r.Duration)/float64(results[i-1].Duration))
+		}
+		fmt.Printf("%8d %14v %12d %8s\n", r.Size, r.Duration.Round(time.Microsecond), r.Iterations, growth)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestGeneratePeriodsSeeded(t *testing.T) {
+	a, b := generatePeriods(50, 7), generatePeriods(50, 7)
+	if !samePeriods(a, b) {
+		t.Error("the same seed generated different periods")
+	}
+	if samePeriods(a, generatePeriods(50, 8)) {
+		t.Error("different seeds generated the same periods")
+	}
+	for _, p := range a {
+		if !p.PeriodEnd.After(p.PeriodStart) || p.ProdNum != 1 {
+			t.Errorf("generated period %+v is not a valid period of product 1", p)
+		}
+	}
+}
+
+func TestRunBenchmark(t *testing.T) {
+	for _, resolver := range []periods.Resolver{periods.PairwiseResolver{}, periods.SweepLineResolver{}} {
+		t.Run(fmt.Sprintf("%T", resolver), func(t *testing.T) {
+			results, err := runBenchmark([]int{10, 40}, periods.ProcessOptions{ClosedIntervals: true, Resolver: resolver})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 2 || results[0].Size != 10 || results[1].Size != 40 {
+				t.Fatalf("results %+v, want one per size", results)
+			}
+			// iterations are counted per size, not accumulated over the run
+			if results[0].Iterations == 0 || results[1].Iterations <= results[0].Iterations {
+				t.Errorf("iterations %d then %d, want growing counts", results[0].Iterations, results[1].Iterations)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// First day of the month of t, at midnight in t's location
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// Snap period boundaries to calendar month starts after resolution: starts round up to the next
+// month start and ends round down, periods left without a whole month are dropped; open ends stay open
+func snapBoundariesToMonth(input []periods.Period, closed bool) []periods.Period {
+	snapped := input[:0]
+	for _, p := range input {
+		if start := monthStart(p.PeriodStart); start.Before(p.PeriodStart) {
+			p.PeriodStart = start.AddDate(0, 1, 0)
+		}
+		if p.PeriodEnd.Equal(openPeriodEnd) {
+			snapped = append(snapped, p)
+			continue
+		}
+		end := p.PeriodEnd
+		if closed {
+			// inclusive end: snap the day after it, then step back to the last day of the month
+			end = end.AddDate(0, 0, 1)
+		}
+		end = monthStart(end)
+		if !end.After(p.PeriodStart) {
+			fmt.Printf("Snapping to month: dropping period id %d (prodnum %d) shorter than a calendar month\n", p.ID, p.ProdNum)
+			continue
+		}
+		if closed {
+			end = end.AddDate(0, 0, -1)
+		}
+		p.PeriodEnd = end
+		snapped = append(snapped, p)
+	}
+	return snapped
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestSnapBoundariesToMonth(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		closed     bool
+		want       []string
+	}{
+		{"month starts kept half-open", "2024-01-01", "2024-03-01", false, []string{"1 2024-01-01..2024-03-01"}},
+		{"start rounds up, end rounds down half-open", "2024-01-15", "2024-04-10", false, []string{"1 2024-02-01..2024-04-01"}},
+		{"last day of month kept closed", "2024-01-01", "2024-02-29", true, []string{"1 2024-01-01..2024-02-29"}},
+		{"end rounds down to a month end closed", "2024-01-15", "2024-04-10", true, []string{"1 2024-02-01..2024-03-31"}},
+		{"shorter than a month dropped", "2024-01-15", "2024-02-20", false, nil},
+		{"inside one month dropped closed", "2024-02-01", "2024-02-28", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []periods.Period{{ID: 1, ProdNum: 1, PeriodStart: day(tt.start), PeriodEnd: day(tt.end)}}
+			got := spans(snapBoundariesToMonth(input, tt.closed))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("snapped %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapBoundariesToMonthOpenEnd(t *testing.T) {
+	tests := []struct {
+		name   string
+		closed bool
+	}{
+		{"half-open", false},
+		{"closed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []periods.Period{{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-15"), PeriodEnd: openPeriodEnd}}
+			snapped := snapBoundariesToMonth(input, tt.closed)
+			if len(snapped) != 1 || !snapped[0].PeriodStart.Equal(day("2024-02-01")) || !snapped[0].PeriodEnd.Equal(openPeriodEnd) {
+				t.Fatalf("snapped %q, want the start snapped and the end left open", spans(snapped))
+			}
+			// an open end still writes back as NULL
+			if end := insertArgs(snapped[0])[2]; end != nil {
+				t.Errorf("written end %v, want NULL", end)
+			}
+		})
+	}
+}
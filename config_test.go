@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestFindConfig(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	if _, err := findConfig("config_test.json"); err == nil {
+		t.Error("found a config that is in no search location")
+	}
+	want := filepath.Join(configHome, "pricingperiods", "config_test.json")
+	if err := os.MkdirAll(filepath.Dir(want), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(want, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := findConfig("config_test.json"); err != nil || got != want {
+		t.Errorf("findConfig = %q, %v, want %q", got, err, want)
+	}
+	// a config in the working directory comes first
+	if err := os.WriteFile("config_test.json", []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := findConfig("config_test.json"); err != nil || got != "config_test.json" {
+		t.Errorf("findConfig = %q, %v, want the working directory's", got, err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	var valid Config
+	valid.Database.Server = "db.example.com"
+	valid.Database.Database = "pricing"
+	// neither the query file nor the server exist, validation must not touch them
+	valid.QueryPath = filepath.Join(t.TempDir(), "missing.sql")
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+
+	invalid := valid
+	invalid.Database.Server = ""
+	invalid.Processing.IntervalMode = "open"
+	invalid.Output.Format = "queue"
+	invalid.Database.MaxOpenConns = -1
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("no error for an invalid config")
+	}
+	for _, want := range []string{"database.serverName", "processing.intervalMode", "output.queue", "database.maxOpenConns"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %s", err, want)
+		}
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	valid := func() *Config {
+		config := &Config{Query: "SELECT periods"}
+		config.Database.Server, config.Database.Database = "db01", "pricing"
+		return config
+	}
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"valid", func(*Config) {}, nil},
+		{"missing server and database", func(c *Config) { c.Database.Server, c.Database.Database = "", "" },
+			[]string{"database.serverName is required", "database.databaseName is required"}},
+		{"missing query", func(c *Config) { c.Query = "" }, []string{"query, queryPath or sources is required"}},
+		{"unknown application intent", func(c *Config) { c.Database.ApplicationIntent = "ReadMostly" },
+			[]string{`database applicationIntent "ReadMostly" of server db01 must be ReadOnly or ReadWrite`}},
+		{"log to file without a path", func(c *Config) { c.Logging.LogToFile = true },
+			[]string{"logging.runLogPath or filePath is required with logging.logToFile"}},
+		{"every problem listed", func(c *Config) {
+			c.Database.Server, c.Query = "", ""
+			c.Processing.FillGaps = "nearest"
+			c.Database.RetryAttempts = -1
+		}, []string{"database.serverName is required", "query, queryPath or sources is required",
+			`processing.fillGaps "nearest" must be extend or default`, "database.retryAttempts and retryBaseDelayMs must not be negative"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid()
+			tt.modify(config)
+			err := config.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error misses %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	query := filepath.Join(dir, "periods.sql")
+	if err := os.WriteFile(query, []byte("SELECT periods"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{QueryPath: query}
+	if err := config.checkFiles(); err != nil {
+		t.Errorf("existing query file: %v", err)
+	}
+	config.QueryPath = filepath.Join(dir, "missing.sql")
+	config.Processing.HolidayFile = filepath.Join(dir, "holidays.csv")
+	err := config.checkFiles()
+	for _, want := range []string{"queryPath", "processing.holidayFile"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v, want %s reported", err, want)
+		}
+	}
+	// query URLs are not fetched
+	config.QueryPath, config.Processing.HolidayFile = "https://config.example.com/periods.sql", ""
+	if err := config.checkFiles(); err != nil {
+		t.Errorf("query URL: %v", err)
+	}
+}
+
+func TestConfigLogRedactsSecrets(t *testing.T) {
+	config := &Config{}
+	config.Database.Password = "db-pass"
+	config.Database.Shards = []DatabaseConfig{{Password: "shard-pass"}}
+	config.QueryURL.AuthHeader = "Bearer token"
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			var handler slog.Handler = slog.NewTextHandler(&out, nil)
+			if format == "json" {
+				handler = slog.NewJSONHandler(&out, nil)
+			}
+			logger := slog.New(handler)
+			logger.Info("config", "config", config, "password", config.Database.Password)
+			for _, secret := range []string{"db-pass", "shard-pass", "Bearer token"} {
+				if strings.Contains(out.String(), secret) {
+					t.Errorf("log carries %q: %s", secret, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunLogPath(t *testing.T) {
+	tests := []struct {
+		filePath, runLogPath, want string
+	}{
+		{"logs/periods.log", "", "logs/periods.run.log"},
+		{"periods", "", "periods.run"},
+		{"logs/periods.log", "logs/run.log", "logs/run.log"},
+	}
+	for _, tt := range tests {
+		config := &Config{}
+		config.Logging.FilePath, config.Logging.RunLogPath = tt.filePath, tt.runLogPath
+		if got := config.runLogPath(); got != tt.want {
+			t.Errorf("runLogPath(%q, %q) = %q, want %q", tt.filePath, tt.runLogPath, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRunLogPath(t *testing.T) {
+	config := &Config{}
+	config.Logging.LogToFile = true
+	config.Logging.FilePath, config.Logging.RunLogPath = "periods.log", "periods.log"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "logging.runLogPath must not be logging.filePath") {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestCheckStreamOutputFlags(t *testing.T) {
+	streamed := &Config{}
+	streamed.Processing.StreamByProduct, streamed.Processing.StreamOutput = true, true
+	tests := []struct {
+		name    string
+		config  *Config
+		set     map[string]bool
+		wantErr string
+	}{
+		{"no flags", streamed, map[string]bool{"-dryrun": false, "-record": false}, ""},
+		{"dry run", streamed, map[string]bool{"-dryrun": true, "-record": false}, "processing.streamOutput cannot be combined with -dryrun"},
+		{"several", streamed, map[string]bool{"-record": true, "-diff": true, "-dryrun": true}, "processing.streamOutput cannot be combined with -diff, -dryrun, -record"},
+		{"not streamed", &Config{}, map[string]bool{"-dryrun": true, "-diff": true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.checkStreamOutputFlags(tt.set)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultIntervalModeMatchesBaseline(t *testing.T) {
+	period := func(id, prodNum int, start, end string, priority int, price string) periods.Period {
+		return periods.Period{ID: id, ProdNum: prodNum, PeriodStart: day(start), PeriodEnd: day(end), PeriodPriority: priority, Price: mustPrice(price)}
+	}
+	input := []periods.Period{
+		// split around a higher priority period inside
+		period(1, 7, "2024-01-01", "2024-01-31", 2, "10.50"),
+		period(2, 7, "2024-01-10", "2024-01-20", 1, "20.50"),
+		// cut before a higher priority period starts
+		period(3, 7, "2024-02-01", "2024-02-15", 2, "11.00"),
+		period(4, 7, "2024-02-10", "2024-02-28", 1, "12.00"),
+		// pushed after a higher priority period ends
+		period(5, 8, "2024-01-01", "2024-01-15", 1, "5.00"),
+		period(6, 8, "2024-01-10", "2024-01-31", 2, "6.00"),
+		// covered entirely by a higher priority period
+		period(7, 8, "2024-02-01", "2024-02-29", 1, "7.00"),
+		period(8, 8, "2024-02-05", "2024-02-20", 3, "8.00"),
+		// back to back, untouched
+		period(9, 9, "2024-01-01", "2024-01-09", 1, "1.00"),
+		period(10, 9, "2024-01-10", "2024-01-20", 2, "2.00"),
+	}
+	// output of the processing before the interval mode was configurable, end dates inclusive with ±1 day cuts
+	baseline := []string{
+		"7 2024-01-01..2024-01-09 10.50", "7 2024-01-10..2024-01-20 20.50", "7 2024-01-21..2024-01-31 10.50",
+		"7 2024-02-01..2024-02-09 11.00", "7 2024-02-10..2024-02-28 12.00",
+		"8 2024-01-01..2024-01-15 5.00", "8 2024-01-16..2024-01-31 6.00", "8 2024-02-01..2024-02-29 7.00",
+		"9 2024-01-01..2024-01-09 1.00", "9 2024-01-10..2024-01-20 2.00",
+	}
+	tests := []struct {
+		name, mode   string
+		wantBaseline bool
+	}{
+		{"unset", "", true},
+		{"closed", "closed", true},
+		{"half-open", "halfOpen", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			config.Processing.IntervalMode = tt.mode
+			opts := periods.ProcessOptions{ClosedIntervals: config.closedIntervals()}
+			if err := config.resolution(&opts); err != nil {
+				t.Fatal(err)
+			}
+			output, err := periods.ProcessPeriods(slices.Clone(input), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, _ = normalizeResolved(output, &config, opts)
+			got := make([]string, len(output))
+			for i, p := range output {
+				got[i] = fmt.Sprintf("%d %s..%s %s", p.ProdNum, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"), p.Price)
+			}
+			if slices.Equal(got, baseline) != tt.wantBaseline {
+				t.Errorf("output %q, want baseline %q: %v", got, baseline, tt.wantBaseline)
+			}
+		})
+	}
+}
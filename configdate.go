@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Config date in "YYYY-MM-DD" form, empty means today,
+// a malformed value is kept and reported by Config.Validate rather than failing the parse
+type ConfigDate struct {
+	time.Time
+	raw string
+	err error
+}
+
+// Today's date at midnight UTC
+func today() ConfigDate {
+	now := time.Now()
+	return ConfigDate{Time: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+func (d *ConfigDate) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("config date must be a string: %w", err)
+	}
+	if value == "" {
+		*d = today()
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	*d = ConfigDate{Time: date, raw: value, err: err}
+	return nil
+}
+
+func (d ConfigDate) MarshalJSON() ([]byte, error) {
+	if d.err != nil {
+		return json.Marshal(d.raw)
+	}
+	return json.Marshal(d.Format("2006-01-02"))
+}
+
+// Parse error of the configured value, nil when valid
+func (d ConfigDate) Err() error {
+	if d.err != nil {
+		return fmt.Errorf("%q is not a YYYY-MM-DD date", d.raw)
+	}
+	return nil
+}
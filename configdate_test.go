@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestConfigDateJSON(t *testing.T) {
+	tests := []struct {
+		name, json string
+		want       string
+		wantErr    bool
+	}{
+		{"date", `"2024-03-01"`, "2024-03-01", false},
+		{"empty is today", `""`, today().Format("2006-01-02"), false},
+		{"malformed kept for validation", `"01/03/2024"`, "01/03/2024", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d ConfigDate
+			if err := json.Unmarshal([]byte(tt.json), &d); err != nil {
+				t.Fatalf("unmarshal failed: %v", err)
+			}
+			if (d.Err() != nil) != tt.wantErr {
+				t.Fatalf("Err() = %v, want error %v", d.Err(), tt.wantErr)
+			}
+			// a malformed value marshals back as written
+			data, err := json.Marshal(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `"` + tt.want + `"`; string(data) != want {
+				t.Errorf("marshalled %s, want %s", data, want)
+			}
+		})
+	}
+}
+
+func TestReadConfigAsOfDate(t *testing.T) {
+	tests := []struct {
+		name, config string
+		want         string
+		wantErr      bool
+	}{
+		{"configured", `{"processing": {"asOfDate": "2024-03-01"}}`, "2024-03-01", false},
+		{"missing is today", `{}`, today().Format("2006-01-02"), false},
+		{"malformed", `{"processing": {"asOfDate": "March 1st"}}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := readConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := config.Processing.AsOfDate.Err(); (err != nil) != tt.wantErr {
+				t.Fatalf("asOfDate error %v, want error %v", err, tt.wantErr)
+			}
+			if got := config.Processing.AsOfDate.Format("2006-01-02"); !tt.wantErr && got != tt.want {
+				t.Errorf("asOfDate %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryPeriodsAsOfDate(t *testing.T) {
+	config := queryFileConfig(t)
+	if err := os.WriteFile(config.QueryPath, []byte("SELECT periods WHERE PeriodEnd >= @AsOfDate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Processing.AsOfDate = ConfigDate{Time: day("2024-03-01")}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WithArgs(sql.Named("AsOfDate", day("2024-03-01"))).WillReturnRows(sqlmock.NewRows(periodQueryColumns))
+	rows, err := queryPeriods(context.Background(), db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryPeriodsWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		from, to string
+		wantArgs []driver.Value
+		wantErr  bool
+	}{
+		{"both bounds", "SELECT periods WHERE PeriodEnd >= @from AND PeriodStart <= @to", "2024-01-01", "2024-03-31",
+			[]driver.Value{sql.Named("from", day("2024-01-01")), sql.Named("to", day("2024-03-31"))}, false},
+		{"unset bound passed as NULL", "SELECT periods WHERE PeriodEnd >= @from AND (@to IS NULL OR PeriodStart <= @to)", "2024-01-01", "",
+			[]driver.Value{sql.Named("from", day("2024-01-01")), sql.Named("to", nil)}, false},
+		{"query without the window", "SELECT periods", "2024-01-01", "2024-03-31", nil, false},
+		// parameters are whole identifiers, longer ones sharing their prefix are not the window
+		{"identifiers sharing a prefix", "SELECT periods WHERE PeriodStart <= @today AND (@fromDate IS NULL OR @AsOfDateUTC IS NULL)", "2024-01-01", "2024-03-31", nil, false},
+		{"inverted window", "SELECT periods WHERE PeriodEnd >= @from AND PeriodStart <= @to", "2024-03-31", "2024-01-01", nil, true},
+		{"not a date", "SELECT periods WHERE PeriodEnd >= @from", "01/01/2024", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := queryFileConfig(t)
+			if err := os.WriteFile(config.QueryPath, []byte(tt.query), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config.QueryFrom, config.QueryTo = tt.from, tt.to
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if !tt.wantErr {
+				expect := mock.ExpectQuery("SELECT")
+				if tt.wantArgs != nil {
+					expect.WithArgs(tt.wantArgs...)
+				} else {
+					expect.WithoutArgs()
+				}
+				expect.WillReturnRows(sqlmock.NewRows(periodQueryColumns))
+			}
+			rows, err := queryPeriods(context.Background(), db, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if rows != nil {
+				rows.Close()
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
+)
+
+func TestConnectionRoles(t *testing.T) {
+	replica := &DatabaseConfig{Server: "replica", Database: "pricing", ApplicationIntent: "ReadOnly"}
+	primary := &DatabaseConfig{Server: "primary", Database: "pricing", ApplicationIntent: "ReadWrite"}
+	tests := []struct {
+		name                        string
+		read, write                 *DatabaseConfig
+		wantReadHost, wantWriteHost string
+		wantReadOnly                bool
+	}{
+		{"single block", nil, nil, "shared", "shared", false},
+		{"separate blocks", replica, primary, "replica", "primary", true},
+		{"only read block", replica, nil, "replica", "replica", true},
+		{"only write block", nil, primary, "primary", "primary", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			config.Database.Server = "shared"
+			config.Database.Read, config.Database.Write = tt.read, tt.write
+			read, _, err := msdsn.Parse(connectionString(config.connection(ReadConnection)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			write, _, err := msdsn.Parse(connectionString(config.connection(WriteConnection)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read.Host != tt.wantReadHost || read.ReadOnlyIntent != tt.wantReadOnly {
+				t.Errorf("read connection to %q read-only %v, want %q read-only %v", read.Host, read.ReadOnlyIntent, tt.wantReadHost, tt.wantReadOnly)
+			}
+			if write.Host != tt.wantWriteHost {
+				t.Errorf("write connection to %q, want %q", write.Host, tt.wantWriteHost)
+			}
+		})
+	}
+}
+
+func TestConnectionStringTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds int
+		want    string
+	}{
+		{"driver default", 0, ""},
+		{"configured", 5, "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(connectionString(DatabaseConfig{Server: "primary", Database: "pricing", ConnectTimeoutSeconds: tt.seconds}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := u.Query()
+			if dial, connection := query.Get("dial timeout"), query.Get("connection timeout"); dial != tt.want || connection != tt.want {
+				t.Errorf("dial timeout %q connection timeout %q, want %q", dial, connection, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectDBTimeout(t *testing.T) {
+	// a server accepting connections but never answering the login
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+	dbCfg := DatabaseConfig{Server: fmt.Sprintf("127.0.0.1,%d", port), Database: "pricing", ConnectTimeoutSeconds: 1}
+	start := time.Now()
+	db, err := connectDB(context.Background(), dbCfg)
+	if err == nil {
+		db.Close()
+		t.Fatal("connected to a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("gave up after %v, want about the 1s connect timeout", elapsed)
+	}
+	// the deadline surfaces from the context, or from the connection when the driver's own read deadline fires first
+	var netErr net.Error
+	if !errors.Is(err, context.DeadlineExceeded) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Errorf("error %q, want the connect timeout exceeded", err)
+	}
+}
+
+func TestPingWithRetry(t *testing.T) {
+	transient := errors.New("unable to open tcp connection with host 'db01:1433'")
+	tests := []struct {
+		name      string
+		failures  []error
+		wantPings int
+		wantErr   bool
+	}{
+		{"first attempt", nil, 1, false},
+		{"transient failures", []error{transient, transient}, 3, false},
+		{"attempts exhausted", []error{transient, transient, transient}, 3, true},
+		{"login failure not retried", []error{errors.New("login error: Login failed for user 'svc'")}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pings := 0
+			ping := func(context.Context) error {
+				pings++
+				if pings <= len(tt.failures) {
+					return tt.failures[pings-1]
+				}
+				return nil
+			}
+			dbCfg := DatabaseConfig{Server: "db01", RetryAttempts: 3, RetryBaseDelayMs: 1}
+			err := pingWithRetry(context.Background(), dbCfg, ping)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if pings != tt.wantPings {
+				t.Errorf("pinged %d times, want %d", pings, tt.wantPings)
+			}
+		})
+	}
+}
+
+func TestConnectionStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		name, server, password string
+		wantHost, wantInstance string
+		wantPort               uint64
+	}{
+		{"plain", "db01", "secret", "db01", "", 0},
+		{"separators", "db01", `p;a'ss" {w}o@rd:/?#%`, "db01", "", 0},
+		{"named instance", `db01\PRICING`, "secret", "db01", "PRICING", 0},
+		{"port", "db01,1444", "secret", "db01", "", 1444},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbCfg := DatabaseConfig{Server: tt.server, Database: "Pricing", Username: "svc;user", Password: Secret(tt.password),
+				ApplicationName: "pricing periods", ConnectTimeoutSeconds: 5}
+			parsed, _, err := msdsn.Parse(connectionString(dbCfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Password != tt.password || parsed.User != "svc;user" {
+				t.Errorf("credentials %q / %q, want %q / %q", parsed.User, parsed.Password, "svc;user", tt.password)
+			}
+			if parsed.Host != tt.wantHost || parsed.Instance != tt.wantInstance || parsed.Port != tt.wantPort {
+				t.Errorf("server %q instance %q port %d", parsed.Host, parsed.Instance, parsed.Port)
+			}
+			if parsed.Database != "Pricing" || parsed.AppName != "pricing periods" {
+				t.Errorf("database %q app name %q", parsed.Database, parsed.AppName)
+			}
+		})
+	}
+}
+
+func TestRedactPassword(t *testing.T) {
+	connStr := connectionString(DatabaseConfig{Server: "db01", Username: "svc", Password: "p;a'ss word"})
+	redacted := redactPassword(connStr)
+	if strings.Contains(redacted, "ss") || !strings.Contains(redacted, "svc:REDACTED@db01") {
+		t.Errorf("redacted %q", redacted)
+	}
+}
+
+func TestPingWithRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pings := 0
+	ping := func(context.Context) error {
+		pings++
+		// cancelled while waiting out the backoff, not during the ping
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return errors.New("unable to open tcp connection with host 'db01:1433'")
+	}
+	dbCfg := DatabaseConfig{Server: "db01", RetryAttempts: 3, RetryBaseDelayMs: int(time.Hour / time.Millisecond)}
+	start := time.Now()
+	err := pingWithRetry(ctx, dbCfg, ping)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if pings != 1 {
+		t.Errorf("pinged %d times, want 1", pings)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, the backoff ignored the cancellation", elapsed)
+	}
+}
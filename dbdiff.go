@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// changes needed to turn the stored periods into the processed periods
+type PeriodDiff struct {
+	Added   []periods.Period
+	Updated []periods.Period
+	Deleted []periods.Period
+}
+
+// logical key of a stored period: one period per product and start date
+type periodKey struct {
+	ProdNum     int
+	PeriodStart time.Time
+}
+
+func keyOf(p periods.Period) periodKey {
+	return periodKey{ProdNum: p.ProdNum, PeriodStart: p.PeriodStart.UTC()}
+}
+
+// Quote a possibly schema qualified table name, e.g. dbo.Periods -> [dbo].[Periods]
+func quoteTableName(table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = "[" + strings.ReplaceAll(strings.Trim(part, "[]"), "]", "]]") + "]"
+	}
+	return strings.Join(parts, ".")
+}
+
+// Fetch periods currently stored in the output table within the run scope, boundaries normalized like fetched periods
+func fetchTablePeriods(ctx context.Context, db Querier, config *Config, scope runScope) ([]periods.Period, error) {
+	condition, args := buildScopeCondition(config.WriteColumns, scope)
+	rows, err := db.QueryContext(ctx, buildSelectStatement(config.WriteTable, config.WriteColumns)+condition, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query of table %s failed: %w", config.WriteTable, timeoutError(ctx, err))
+	}
+	defer rows.Close()
+	scanner, err := newPeriodScanner(rows, config, 0)
+	if err != nil {
+		return nil, err
+	}
+	var stored []periods.Period
+	for rows.Next() {
+		p, err := scanner.scan()
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rows: %w", timeoutError(ctx, err))
+	}
+	return stored, nil
+}
+
+// Compare stored and processed periods by logical key (ProdNum, PeriodStart)
+func diffPeriods(existing, processed []periods.Period) PeriodDiff {
+	var diff PeriodDiff
+	stored := make(map[periodKey]periods.Period, len(existing))
+	for _, p := range existing {
+		stored[keyOf(p)] = p
+	}
+	for _, p := range processed {
+		old, ok := stored[keyOf(p)]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, p)
+		case !old.PeriodEnd.Equal(p.PeriodEnd) || old.Price != p.Price || old.PeriodPriority != p.PeriodPriority:
+			diff.Updated = append(diff.Updated, p)
+		}
+		delete(stored, keyOf(p))
+	}
+	// stored periods not matched by any processed period
+	for _, p := range existing {
+		if _, ok := stored[keyOf(p)]; ok {
+			diff.Deleted = append(diff.Deleted, p)
+		}
+	}
+	return diff
+}
+
+// Print diff counts, and log every changed period at debug level
+func printDiff(diff PeriodDiff) {
+	fmt.Printf("Diff against stored periods: %d added, %d updated, %d deleted\n", len(diff.Added), len(diff.Updated), len(diff.Deleted))
+	for _, change := range []struct {
+		label   string
+		periods []periods.Period
+	}{{"added", diff.Added}, {"updated", diff.Updated}, {"deleted", diff.Deleted}} {
+		for _, p := range change.periods {
+			slog.Debug("diff "+change.label, "prodnum", p.ProdNum, "start", p.PeriodStart.Format("2006-01-02"),
+				"end", p.PeriodEnd.Format("2006-01-02"), "price", p.Price, "priority", p.PeriodPriority)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestDiffAgainstTable(t *testing.T) {
+	rows := sqlmock.NewRows(periodQueryColumns).
+		AddRow(1, day("2024-01-01"), day("2024-01-10"), 10.5, 7, 1).
+		AddRow(2, day("2024-01-10"), day("2024-01-20"), 20.5, 7, 1).
+		AddRow(3, day("2024-01-01"), day("2024-01-31"), 30.5, 8, 1)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM [dbo].[Periods]")).WillReturnRows(rows)
+	existing, err := fetchTablePeriods(context.Background(), db, &Config{WriteTable: "dbo.Periods"}, runScope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed := []periods.Period{
+		// unchanged
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10.50"), PeriodPriority: 1},
+		// repriced
+		{ID: 2, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), Price: mustPrice("25"), PeriodPriority: 1},
+		// new, while product 8's period is gone
+		{ID: 4, ProdNum: 9, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), Price: mustPrice("40"), PeriodPriority: 1},
+	}
+	diff := diffPeriods(existing, processed)
+	for _, tt := range []struct {
+		change  string
+		periods []periods.Period
+		wantIDs []int
+	}{
+		{"added", diff.Added, []int{4}},
+		{"updated", diff.Updated, []int{2}},
+		{"deleted", diff.Deleted, []int{3}},
+	} {
+		var ids []int
+		for _, p := range tt.periods {
+			ids = append(ids, p.ID)
+		}
+		if !slices.Equal(ids, tt.wantIDs) {
+			t.Errorf("%s %v, want %v", tt.change, ids, tt.wantIDs)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Write the diff as one line per classified period, grouped by product in ProdNum order
+func formatDiff(w io.Writer, diff periods.Diff) error {
+	prodNums := make([]int, 0, len(diff))
+	for prodNum := range diff {
+		prodNums = append(prodNums, prodNum)
+	}
+	sort.Ints(prodNums)
+	span := func(p periods.Period) string {
+		return fmt.Sprintf("%s to %s at %v", p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"), p.Price)
+	}
+	for _, prodNum := range prodNums {
+		if _, err := fmt.Fprintf(w, "prodnum %d\n", prodNum); err != nil {
+			return err
+		}
+		for _, change := range diff[prodNum] {
+			var line string
+			switch change.Kind {
+			case periods.Unchanged:
+				line = fmt.Sprintf("  unchanged id %d: %s", change.Before.ID, span(change.Before))
+			case periods.Adjusted:
+				line = fmt.Sprintf("  adjusted  id %d: %s -> %s", change.Before.ID, span(change.Before), span(change.After))
+			case periods.Split:
+				line = fmt.Sprintf("  split     id %d from id %d: %s", change.After.ID, change.Before.ID, span(change.After))
+			case periods.Removed:
+				line = fmt.Sprintf("  removed   id %d: %s", change.Before.ID, span(change.Before))
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Write the diff to path, or print it when path is "-"
+func writeDiff(path string, diff periods.Diff) (err error) {
+	if path == "-" {
+		return formatDiff(os.Stdout, diff)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating diff file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing diff file: %w", closeErr)
+		}
+	}()
+	if err := formatDiff(file, diff); err != nil {
+		return fmt.Errorf("error writing diff: %w", err)
+	}
+	fmt.Printf("Diff written to %s: %v products\n", path, len(diff))
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// IDs of the periods of a product a write would touch
+type ProductChanges struct {
+	// split fragments and gap fills, under their negative IDs
+	Inserted []int
+	// input periods written with changed dates or price
+	Updated []int
+	// input periods cut into fragments
+	Split []int
+	// input periods left out of the output
+	Removed []int
+}
+
+// Sort the diff of the processed periods against the input into the writes it implies, per ProdNum;
+// periods of no input period (gap fills) are inserted as well
+func dryRunChanges(input, output []periods.Period) map[int]*ProductChanges {
+	changes := make(map[int]*ProductChanges)
+	of := func(prodNum int) *ProductChanges {
+		if changes[prodNum] == nil {
+			changes[prodNum] = &ProductChanges{}
+		}
+		return changes[prodNum]
+	}
+	for prodNum, list := range periods.DiffPeriods(input, output) {
+		for _, change := range list {
+			switch change.Kind {
+			case periods.Adjusted:
+				of(prodNum).Updated = append(of(prodNum).Updated, change.Before.ID)
+			case periods.Split:
+				of(prodNum).Inserted = append(of(prodNum).Inserted, change.After.ID)
+				if !slices.Contains(of(prodNum).Split, change.Before.ID) {
+					of(prodNum).Split = append(of(prodNum).Split, change.Before.ID)
+				}
+			case periods.Removed:
+				of(prodNum).Removed = append(of(prodNum).Removed, change.Before.ID)
+			}
+		}
+	}
+	inputIDs := make(map[int]bool, len(input))
+	for _, p := range input {
+		inputIDs[p.ID] = true
+	}
+	for _, p := range output {
+		if p.ParentID == 0 && !inputIDs[p.ID] {
+			of(p.ProdNum).Inserted = append(of(p.ProdNum).Inserted, p.ID)
+		}
+	}
+	return changes
+}
+
+// Print operation counts in total and per product, and log the affected IDs at debug level
+func printDryRun(changes map[int]*ProductChanges) {
+	prodNums := make([]int, 0, len(changes))
+	var inserted, updated, split, removed int
+	for prodNum, c := range changes {
+		prodNums = append(prodNums, prodNum)
+		inserted, updated, split, removed = inserted+len(c.Inserted), updated+len(c.Updated), split+len(c.Split), removed+len(c.Removed)
+	}
+	slices.Sort(prodNums)
+	fmt.Printf("Dry run, nothing written: %d inserted, %d updated, %d split, %d removed in %d products\n",
+		inserted, updated, split, removed, len(prodNums))
+	for _, prodNum := range prodNums {
+		c := changes[prodNum]
+		fmt.Printf("  prodnum %d: %d inserted, %d updated, %d split, %d removed\n",
+			prodNum, len(c.Inserted), len(c.Updated), len(c.Split), len(c.Removed))
+		slog.Debug("dry run changes", "prodnum", prodNum, "inserted", c.Inserted, "updated", c.Updated, "split", c.Split, "removed", c.Removed)
+	}
+}
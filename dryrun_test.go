@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestDryRunChanges(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 7, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 9, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 9, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), PeriodPriority: 2},
+		{ID: 5, ProdNum: 9, PeriodStart: day("2024-02-01"), PeriodEnd: day("2024-02-10"), PeriodPriority: 1},
+	}
+	output, err := periods.ProcessPeriods(slices.Clone(input), periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]*ProductChanges{
+		// 1 is cut around 2 and its second part inserted as a fragment
+		7: {Inserted: []int{-1}, Updated: []int{1}, Split: []int{1}},
+		// 4 lies within 3 and is dropped, 3 and 5 are written as they were
+		9: {Removed: []int{4}},
+	}
+	if got := dryRunChanges(input, output); !reflect.DeepEqual(got, want) {
+		for prodNum, c := range got {
+			t.Errorf("prodnum %d: %+v, want %+v", prodNum, *c, want[prodNum])
+		}
+	}
+
+	printed := captureStdout(t, func() { printDryRun(want) })
+	wantPrinted := "Dry run, nothing written: 1 inserted, 1 updated, 1 split, 1 removed in 2 products\n" +
+		"  prodnum 7: 1 inserted, 1 updated, 1 split, 0 removed\n" +
+		"  prodnum 9: 0 inserted, 0 updated, 0 split, 1 removed\n"
+	if printed != wantPrinted {
+		t.Errorf("printed\n%s\nwant\n%s", printed, wantPrinted)
+	}
+}
+
+func TestDryRunChangesGapFill(t *testing.T) {
+	period := func(id, parentID int, start, end string) periods.Period {
+		return periods.Period{ID: id, ParentID: parentID, ProdNum: 1, PeriodStart: day(start), PeriodEnd: day(end)}
+	}
+	input := []periods.Period{
+		period(1, 0, "2024-01-01", "2024-01-31"),
+		period(2, 0, "2024-01-10", "2024-01-20"),
+		period(3, 0, "2024-01-12", "2024-01-15"),
+		period(4, 0, "2024-02-10", "2024-02-20"),
+	}
+	output := []periods.Period{
+		period(1, 0, "2024-01-01", "2024-01-10"),
+		period(2, 0, "2024-01-10", "2024-01-20"),
+		period(-1, 1, "2024-01-20", "2024-01-31"),
+		period(-2, 0, "2024-01-31", "2024-02-10"), // gap fill
+		period(4, 0, "2024-02-10", "2024-02-20"),
+	}
+	want := map[int]*ProductChanges{
+		1: {Inserted: []int{-1, -2}, Updated: []int{1}, Split: []int{1}, Removed: []int{3}},
+	}
+	if got := dryRunChanges(input, output); !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %+v, want %+v", got[1], want[1])
+	}
+	if got := dryRunChanges(input, input); len(got) != 0 {
+		t.Errorf("unprocessed input reported changes %+v", got)
+	}
+}
@@ -0,0 +1,820 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// columns of a named period query
+var periodQueryColumns = []string{"ID", "PeriodStart", "PeriodEnd", "Price", "ProdNum", "PeriodPriority"}
+
+// Price of decimal text
+func mustPrice(s string) periods.Price {
+	price, err := periods.ParsePrice(s)
+	if err != nil {
+		panic(err)
+	}
+	return price
+}
+
+// Database answering the next query with rows
+func mockQuery(t *testing.T, rows *sqlmock.Rows) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	return db, mock
+}
+
+// Config reading its query from a file in a fresh temp dir
+func queryFileConfig(t *testing.T) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "periods.sql")
+	if err := os.WriteFile(path, []byte("SELECT periods"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &Config{QueryPath: path}
+}
+
+func TestFetchPeriodsMaxRows(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRows    int
+		allowLarge bool
+		wantErr    bool
+	}{
+		{"no cap", 0, false, false},
+		{"within cap", 5, false, false},
+		{"over cap", 3, false, true},
+		{"over cap allowed", 3, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := sqlmock.NewRows(periodQueryColumns)
+			for id := 1; id <= 5; id++ {
+				rows.AddRow(id, day("2024-01-01"), day("2024-01-10"), 10.5, id, 1)
+			}
+			db, _ := mockQuery(t, rows)
+			config := queryFileConfig(t)
+			config.Processing.MaxRows = tt.maxRows
+			config.Processing.AllowLarge = tt.allowLarge
+			fetched, err := fetchPeriods(context.Background(), db, config)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "maxRows") {
+					t.Errorf("err = %v, want the row cap reported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fetched) != 5 {
+				t.Errorf("fetched %d periods, want 5", len(fetched))
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsQueryURL(t *testing.T) {
+	const query = "SELECT ID, PeriodStart, PeriodEnd, Price, ProdNum, PeriodPriority FROM served_periods"
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(query))
+	}))
+	defer server.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for range 2 {
+		mock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(sqlmock.NewRows(periodQueryColumns).
+			AddRow(1, day("2024-01-01"), day("2024-01-10"), 10.5, 7, 1))
+	}
+
+	config := &Config{QueryPath: server.URL + "/periods.sql"}
+	config.QueryURL.AuthHeader = "Bearer token"
+	for range 2 {
+		fetched, err := fetchPeriods(context.Background(), db, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fetched) != 1 || fetched[0].ProdNum != 7 {
+			t.Errorf("fetched %+v, want the served query's period", fetched)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("query fetched %d times, want once per run", requests)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadQueryURLStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	if _, err := loadQuery(&Config{QueryPath: server.URL + "/missing.sql"}); err == nil {
+		t.Error("no error for a query URL answering 404")
+	}
+}
+
+func TestLoadQueryInline(t *testing.T) {
+	file := queryFileConfig(t)
+	tests := []struct {
+		name    string
+		config  Config
+		want    string
+		wantErr bool
+	}{
+		{"inline only", Config{Query: "SELECT inline"}, "SELECT inline", false},
+		{"inline wins over file", Config{Query: "SELECT inline", QueryPath: file.QueryPath}, "SELECT inline", false},
+		{"file only", Config{QueryPath: file.QueryPath}, "SELECT periods", false},
+		{"neither", Config{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadQuery(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("query %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsTruncatesSubSecond(t *testing.T) {
+	// the second period starts microseconds after the first ends
+	rows := sqlmock.NewRows(periodQueryColumns).
+		AddRow(1, day("2024-01-01").Add(250*time.Millisecond), day("2024-01-10"), 10.5, 1, 2).
+		AddRow(2, day("2024-01-10").Add(123*time.Microsecond), day("2024-01-20"), 20.5, 1, 1)
+	db, _ := mockQuery(t, rows)
+	fetched, err := fetchPeriods(context.Background(), db, queryFileConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fetched[0].PeriodStart.Equal(day("2024-01-01")) || !fetched[0].PeriodEnd.Equal(fetched[1].PeriodStart) {
+		t.Fatalf("fetched %v..%v and %v, want whole day boundaries", fetched[0].PeriodStart, fetched[0].PeriodEnd, fetched[1].PeriodStart)
+	}
+	// boundaries equal after alignment are adjacent, not overlapping
+	processed, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}
+	if got := spans(processed); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+}
+
+func TestLoadQueryReloadsChangedFile(t *testing.T) {
+	config := queryFileConfig(t)
+	first := day("2024-01-01 09:00")
+	cycles := []struct {
+		name    string
+		query   string
+		modTime time.Time
+		want    string
+	}{
+		{"first cycle", "SELECT v1", first, "SELECT v1"},
+		{"same modtime not re-read", "SELECT edited in place", first, "SELECT v1"},
+		{"changed file", "SELECT v2", first.Add(time.Minute), "SELECT v2"},
+	}
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, cycle := range cycles {
+		if err := os.WriteFile(config.QueryPath, []byte(cycle.query), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(config.QueryPath, cycle.modTime, cycle.modTime); err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery(cycle.want).WillReturnRows(sqlmock.NewRows(periodQueryColumns))
+		if _, err := fetchPeriods(context.Background(), db, config); err != nil {
+			t.Fatalf("%s: %v", cycle.name, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchPeriodsNullPricePolicy(t *testing.T) {
+	tests := []struct {
+		policy    string
+		wantErr   bool
+		wantSpans []string
+		wantPrice periods.Price
+	}{
+		{"error", true, nil, 0},
+		{"skip", false, []string{"1 2024-01-01..2024-01-31"}, 0},
+		{"zero", false, []string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20", "-1 2024-01-20..2024-01-31"}, 0},
+		{"carry-forward", false, []string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20", "-1 2024-01-20..2024-01-31"}, mustPrice("10.50")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			// the NULL priced period wins the overlap on priority
+			rows := sqlmock.NewRows(periodQueryColumns).
+				AddRow(1, day("2024-01-01"), day("2024-01-31"), 10.5, 1, 2).
+				AddRow(2, day("2024-01-15"), day("2024-01-20"), nil, 1, 1)
+			db, _ := mockQuery(t, rows)
+			config := queryFileConfig(t)
+			config.Processing.NullPricePolicy = tt.policy
+			fetched, err := fetchPeriods(context.Background(), db, config)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error for a NULL price")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			processed, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.wantSpans) {
+				t.Fatalf("processed %q, want %q", got, tt.wantSpans)
+			}
+			for _, p := range processed {
+				if p.ID == 2 && p.Price != tt.wantPrice {
+					t.Errorf("NULL price resolved to %v, want %v", p.Price, tt.wantPrice)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsMetadataSurvivesSplit(t *testing.T) {
+	rows := sqlmock.NewRows(append(slices.Clone(periodQueryColumns), "Metadata")).
+		AddRow(1, day("2024-01-01"), day("2024-01-31"), 10.5, 1, 2, `{"source": "catalog", "batch": 7}`).
+		AddRow(2, day("2024-01-15"), day("2024-01-20"), 20.5, 1, 1, nil)
+	db, _ := mockQuery(t, rows)
+	fetched, err := fetchPeriods(context.Background(), db, queryFileConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	processed, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fragments int
+	for _, p := range processed {
+		// fragments of a split keep the split period's ID as their parent
+		if p.ID != 1 && p.ParentID != 1 {
+			if p.Metadata != nil {
+				t.Errorf("period %d has metadata %v, want none", p.ID, p.Metadata)
+			}
+			continue
+		}
+		fragments++
+		if p.Metadata["source"] != "catalog" || p.Metadata["batch"] != 7.0 {
+			t.Errorf("fragment %v..%v has metadata %v, want the split period's", p.PeriodStart, p.PeriodEnd, p.Metadata)
+		}
+	}
+	if fragments != 2 {
+		t.Errorf("processed %q, want period 1 split in two", spans(processed))
+	}
+}
+
+func TestFetchSources(t *testing.T) {
+	dir := t.TempDir()
+	var config Config
+	for _, name := range []string{"erp", "web"} {
+		path := filepath.Join(dir, name+".sql")
+		if err := os.WriteFile(path, []byte("SELECT periods FROM "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config.Sources = append(config.Sources, struct {
+			Name      string `json:"name"`
+			QueryPath string `json:"queryPath"`
+		}{name, path})
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the web source's period overlaps the erp one and wins on priority
+	mock.ExpectQuery("FROM erp").WillReturnRows(sqlmock.NewRows(periodQueryColumns).
+		AddRow(1, day("2024-01-01"), day("2024-01-31"), 10.5, 1, 2))
+	mock.ExpectQuery("FROM web").WillReturnRows(sqlmock.NewRows(periodQueryColumns).
+		AddRow(2, day("2024-01-15"), day("2024-02-10"), 20.5, 1, 1))
+
+	fetched, err := fetchSources(context.Background(), db, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processed, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1 erp 2024-01-01..2024-01-15", "2 web 2024-01-15..2024-02-10"}
+	var got []string
+	for _, p := range processed {
+		got = append(got, fmt.Sprintf("%d %s %s..%s", p.ID, p.Source, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02")))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchPeriodsByProductLowMemory(t *testing.T) {
+	const products, periodsPerProduct = 200, 50
+	// bytes allocated by streaming a large product-ordered result set, and the product buffers seen
+	stream := func(lowMemory bool) (uint64, map[*periods.Period]bool) {
+		rows := sqlmock.NewRows(periodQueryColumns)
+		for prodNum := 1; prodNum <= products; prodNum++ {
+			for i := 0; i < periodsPerProduct; i++ {
+				start := day("2024-01-01").AddDate(0, 0, i*7)
+				rows.AddRow(prodNum*1000+i, start, start.AddDate(0, 0, 10), 10.5, prodNum, i%3)
+			}
+		}
+		db, _ := mockQuery(t, rows)
+		config := queryFileConfig(t)
+		config.Processing.LowMemory = lowMemory
+		buffers := map[*periods.Period]bool{}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := fetchPeriodsByProduct(context.Background(), db, config, func(product []periods.Period) error {
+			buffers[&product[:1][0]] = true
+			return nil
+		})
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return after.TotalAlloc - before.TotalAlloc, buffers
+	}
+	defaultAlloc, defaultBuffers := stream(false)
+	lowAlloc, lowBuffers := stream(true)
+	if len(lowBuffers) >= len(defaultBuffers) {
+		t.Errorf("low memory mode used %d product buffers, default %d", len(lowBuffers), len(defaultBuffers))
+	}
+	if lowAlloc >= defaultAlloc {
+		t.Errorf("low memory mode allocated %d bytes, default %d", lowAlloc, defaultAlloc)
+	}
+	t.Logf("allocated %d bytes in low memory mode, %d by default", lowAlloc, defaultAlloc)
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name, prodNums, since string
+		wantProdNums          []int
+		wantSince             string
+		wantErr               bool
+	}{
+		{"unscoped", "", "", nil, "", false},
+		{"prodnums", "7, 9", "", []int{7, 9}, "", false},
+		{"since", "", "2024-03-01", nil, "2024-03-01", false},
+		{"invalid prodnum", "7,x", "", nil, "", true},
+		{"invalid date", "", "03/01/2024", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := parseScope(tt.prodNums, tt.since)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var prodNums []int
+			for prodNum := range scope.ProdNums {
+				prodNums = append(prodNums, prodNum)
+			}
+			slices.Sort(prodNums)
+			if !slices.Equal(prodNums, tt.wantProdNums) {
+				t.Errorf("prodnums %v, want %v", prodNums, tt.wantProdNums)
+			}
+			if tt.wantSince != "" && !scope.Since.Equal(day(tt.wantSince)) || tt.wantSince == "" && !scope.Since.IsZero() {
+				t.Errorf("since %v, want %q", scope.Since, tt.wantSince)
+			}
+			if limited := tt.prodNums != "" || tt.since != ""; scope.limited() != limited {
+				t.Errorf("limited %v, want %v", scope.limited(), limited)
+			}
+		})
+	}
+}
+
+func TestRunScopeFilter(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-02-28")},
+		{ID: 2, ProdNum: 7, PeriodStart: day("2024-02-01"), PeriodEnd: day("2024-03-01")},
+		{ID: 3, ProdNum: 8, PeriodStart: day("2024-03-01"), PeriodEnd: day("2024-03-31")},
+		{ID: 4, ProdNum: 9, PeriodStart: day("2024-03-01"), PeriodEnd: day("2024-03-31")},
+	}
+	tests := []struct {
+		name    string
+		scope   runScope
+		wantIDs []int
+	}{
+		{"unscoped", runScope{}, []int{1, 2, 3, 4}},
+		{"prodnums", runScope{ProdNums: map[int]bool{7: true, 9: true}}, []int{1, 2, 4}},
+		{"ending on or after since", runScope{Since: day("2024-03-01")}, []int{2, 3, 4}},
+		{"both", runScope{ProdNums: map[int]bool{7: true}, Since: day("2024-03-01")}, []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			for _, p := range tt.scope.filter(slices.Clone(input)) {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("kept %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsDefaultedColumns(t *testing.T) {
+	tests := []struct {
+		name         string
+		rows         *sqlmock.Rows
+		wantPrice    periods.Price
+		wantPriority int
+		wantErr      bool
+	}{
+		{"no priority column", sqlmock.NewRows([]string{"ID", "PeriodStart", "PeriodEnd", "Price", "ProdNum"}).
+			AddRow(1, day("2024-01-01"), day("2024-01-31"), 12.5, 7).
+			AddRow(2, day("2024-01-10"), day("2024-01-20"), 10.0, 7), mustPrice("12.50"), 5, false},
+		{"no price column", sqlmock.NewRows([]string{"ID", "PeriodStart", "PeriodEnd", "ProdNum", "PeriodPriority"}).
+			AddRow(1, day("2024-01-01"), day("2024-01-31"), 7, 2).
+			AddRow(2, day("2024-01-10"), day("2024-01-20"), 7, 1), 0, 2, false},
+		{"columns in any order", sqlmock.NewRows([]string{"prodnum", "PeriodEnd", "PeriodStart", "id", "Extra"}).
+			AddRow(7, day("2024-01-31"), day("2024-01-01"), 1, "dropped").
+			AddRow(7, day("2024-01-20"), day("2024-01-10"), 2, "dropped"), 0, 5, false},
+		{"unnamed columns", sqlmock.NewRows([]string{"a", "b", "c", "d", "e"}).
+			AddRow(1, day("2024-01-01"), day("2024-01-31"), 12.5, 7), 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := queryFileConfig(t)
+			config.Processing.DefaultPriority = 5
+			db, _ := mockQuery(t, tt.rows)
+			fetched, err := fetchPeriods(context.Background(), db, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if p := fetched[0]; p.ID != 1 || p.ProdNum != 7 || !p.PeriodStart.Equal(day("2024-01-01")) || p.Price != tt.wantPrice || p.PeriodPriority != tt.wantPriority {
+				t.Errorf("fetched %+v, want price %v and priority %d", p, tt.wantPrice, tt.wantPriority)
+			}
+			// processing proceeds on the defaulted fields
+			if _, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{}); err != nil {
+				t.Errorf("processing failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsDeadline(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT").WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows(periodQueryColumns))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := fetchPeriods(ctx, db, queryFileConfig(t)); err == nil {
+		t.Fatal("slow query finished past the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("query cancelled after %v, want about the 20ms deadline", elapsed)
+	}
+}
+
+func TestFetchPeriodsByProductDeadline(t *testing.T) {
+	rows := sqlmock.NewRows(periodQueryColumns)
+	for prodNum := 1; prodNum <= 10; prodNum++ {
+		rows.AddRow(prodNum, day("2024-01-01"), day("2024-01-31"), 10.0, prodNum, 1)
+	}
+	db, _ := mockQuery(t, rows)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// a slow processor checking the run deadline after each product, as the streamed run does
+	var processed int
+	err := fetchPeriodsByProduct(ctx, db, queryFileConfig(t), func(product []periods.Period) error {
+		time.Sleep(20 * time.Millisecond)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		processed++
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v, want the deadline exceeded", err)
+	}
+	if processed == 0 || processed >= 10 {
+		t.Errorf("processed %d of 10 products before the deadline, want a partial run", processed)
+	}
+}
+
+func TestReportTimeout(t *testing.T) {
+	tests := []struct {
+		mode      string
+		partial   bool
+		wantWrite bool
+	}{
+		{"abort", false, false},
+		// partial output is written first, the run exits with the timeout code after it
+		{"partial", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if got := reportTimeout(time.Millisecond, tt.partial); got != tt.wantWrite {
+				t.Errorf("reportTimeout(%v) = %v, want %v", tt.partial, got, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsOpenEndProcessing(t *testing.T) {
+	// an open-ended period outlasts every dated one: split around a higher priority period, its tail stays open
+	rows := sqlmock.NewRows(periodQueryColumns).
+		AddRow(1, day("2024-01-01"), nil, 10.0, 7, 2).
+		AddRow(2, day("2024-02-01"), day("2024-03-01"), 12.0, 7, 1).
+		AddRow(3, day("2024-04-01"), nil, 11.0, 7, nil)
+	db, _ := mockQuery(t, rows)
+	config := queryFileConfig(t)
+	config.Processing.DefaultPriority = 1
+	fetched, err := fetchPeriods(context.Background(), db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched[2].PeriodPriority != 1 {
+		t.Errorf("NULL priority scanned as %d, want the default 1", fetched[2].PeriodPriority)
+	}
+	processed, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1 2024-01-01..2024-02-01", "2 2024-02-01..2024-03-01", "-1 2024-03-01..2024-04-01", "3 2024-04-01..9999-12-31"}
+	if got := spans(processed); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+	// the open end is written back as NULL
+	if args := insertArgs(processed[3]); args[2] != nil {
+		t.Errorf("open end written as %v, want NULL", args[2])
+	}
+}
+
+func TestFetchPeriodsTimeZone(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/London"); err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	// datetime values come back as UTC wall clocks, a datetimeoffset value with its own offset
+	offset := time.Date(2024, 3, 31, 23, 0, 0, 0, time.FixedZone("UTC+0", 0))
+	rows := sqlmock.NewRows(periodQueryColumns).
+		AddRow(1, day("2024-03-30"), day("2024-04-02"), "10", 7, 2).
+		AddRow(2, day("2024-03-31"), offset, "10", 7, 1)
+	db, _ := mockQuery(t, rows)
+	config := &Config{Query: "SELECT periods"}
+	config.Processing.TimeZone = "Europe/London"
+	fetched, err := fetchPeriods(context.Background(), db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{
+		{"2024-03-30 00:00 GMT", "2024-04-02 00:00 BST"},
+		// 23:00 UTC is midnight of 04-01 in London
+		{"2024-03-31 00:00 GMT", "2024-04-01 00:00 BST"},
+	}
+	for i, w := range want {
+		p := fetched[i]
+		if got := [2]string{p.PeriodStart.Format("2006-01-02 15:04 MST"), p.PeriodEnd.Format("2006-01-02 15:04 MST")}; got != w {
+			t.Errorf("period %d read as %v, want %v", p.ID, got, w)
+		}
+	}
+	// 2 splits 1 on the short day, the rest of 1 resumes at local midnight after it
+	processed, err := periods.ProcessPeriods(fetched, periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 3 || processed[2].PeriodStart.Format("2006-01-02 15:04 MST") != "2024-04-01 00:00 BST" {
+		t.Errorf("processed %+v", processed)
+	}
+}
+
+func TestFetchPeriods(t *testing.T) {
+	start, end := day("2024-01-01"), day("2024-01-10")
+	tests := []struct {
+		name    string
+		columns []string
+		rows    [][]driver.Value
+		policy  string
+		rowErr  bool
+		want    []periods.Period
+		wantErr string
+	}{
+		{name: "empty result", columns: periodQueryColumns},
+		{
+			name:    "values",
+			columns: periodQueryColumns,
+			rows:    [][]driver.Value{{1, start, end, "10.50", 7, 2}},
+			want:    []periods.Period{{ID: 1, PeriodStart: start, PeriodEnd: end, Price: mustPrice("10.50"), ProdNum: 7, PeriodPriority: 2}},
+		},
+		{
+			name:    "null end is open, null priority takes the default",
+			columns: periodQueryColumns,
+			rows:    [][]driver.Value{{1, start, nil, "10", 7, nil}},
+			want:    []periods.Period{{ID: 1, PeriodStart: start, PeriodEnd: openPeriodEnd, Price: mustPrice("10"), ProdNum: 7, PeriodPriority: 5}},
+		},
+		{
+			name:    "null price rejected by default",
+			columns: periodQueryColumns,
+			rows:    [][]driver.Value{{1, start, end, nil, 7, 1}},
+			wantErr: "NULL price",
+		},
+		{
+			name:    "null price zeroed by policy",
+			columns: periodQueryColumns,
+			rows:    [][]driver.Value{{1, start, end, nil, 7, 1}},
+			policy:  "zero",
+			want:    []periods.Period{{ID: 1, PeriodStart: start, PeriodEnd: end, ProdNum: 7, PeriodPriority: 1}},
+		},
+		{
+			name:    "missing optional columns",
+			columns: []string{"ProdNum", "ID", "PeriodEnd", "PeriodStart"},
+			rows:    [][]driver.Value{{7, 1, end, start}},
+			want:    []periods.Period{{ID: 1, PeriodStart: start, PeriodEnd: end, ProdNum: 7, PeriodPriority: 5}},
+		},
+		{
+			name:    "too few columns",
+			columns: []string{"a", "b"},
+			wantErr: "query returned 2 columns",
+		},
+		{
+			name:    "scan error",
+			columns: periodQueryColumns,
+			rows:    [][]driver.Value{{"one", start, end, "10", 7, 1}},
+			wantErr: "error scanning period",
+		},
+		{
+			name:    "invalid metadata",
+			columns: append(slices.Clone(periodQueryColumns), "Metadata"),
+			rows:    [][]driver.Value{{1, start, end, "10", 7, 1, "{"}},
+			wantErr: "error parsing metadata of period 1",
+		},
+		{
+			name:    "row error",
+			columns: periodQueryColumns,
+			rows:    [][]driver.Value{{1, start, end, "10", 7, 1}},
+			rowErr:  true,
+			wantErr: "error reading rows",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := sqlmock.NewRows(tt.columns)
+			for _, row := range tt.rows {
+				rows.AddRow(row...)
+			}
+			if tt.rowErr {
+				rows.RowError(0, errors.New("connection reset"))
+			}
+			db, mock := mockQuery(t, rows)
+			config := &Config{Query: "SELECT periods"}
+			config.Processing.DefaultPriority = 5
+			config.Processing.NullPricePolicy = tt.policy
+			fetched, err := fetchPeriods(context.Background(), db, config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(fetched) > 0 || len(tt.want) > 0) && !reflect.DeepEqual(fetched, tt.want) {
+				t.Errorf("fetched\n%+v\nwant\n%+v", fetched, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestFetchPeriodsByProductRequiresOrder(t *testing.T) {
+	start, end := day("2024-01-01"), day("2024-01-10")
+	rows := sqlmock.NewRows(periodQueryColumns).
+		AddRow(1, start, end, "10", 2, 1).
+		AddRow(2, start, end, "10", 1, 1)
+	db, _ := mockQuery(t, rows)
+	var products []int
+	err := fetchPeriodsByProduct(context.Background(), db, &Config{Query: "SELECT periods"}, func(product []periods.Period) error {
+		products = append(products, product[0].ProdNum)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "not ordered by ProdNum") {
+		t.Errorf("error %v, want an ordering error", err)
+	}
+	if len(products) > 0 {
+		t.Errorf("processed products %v before the ordering error", products)
+	}
+}
+
+func TestFetchPeriodsAlignsToGranularity(t *testing.T) {
+	tests := []struct {
+		name               string
+		granularity, mode  string
+		dayAnchor          string
+		wantStart, wantEnd string
+	}{
+		{"hours half-open", "1h", "halfOpen", "", "2024-01-01 05:00", "2024-01-01 08:00"},
+		{"hours closed", "1h", "closed", "", "2024-01-01 05:00", "2024-01-01 07:00"},
+		{"days half-open", "", "halfOpen", "", "2024-01-01 00:00", "2024-01-02 00:00"},
+		{"days from an anchor", "", "closed", "06:00", "2023-12-31 06:00", "2024-01-01 06:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := sqlmock.NewRows(periodQueryColumns).
+				AddRow(1, day("2024-01-01 05:30").Add(123*time.Microsecond), day("2024-01-01 07:15"), "10.00", 1, 1)
+			db, _ := mockQuery(t, rows)
+			config := &Config{Query: "SELECT periods"}
+			config.Processing.Granularity = tt.granularity
+			config.Processing.IntervalMode = tt.mode
+			config.Processing.DayAnchor = tt.dayAnchor
+			fetched, err := fetchPeriods(context.Background(), db, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p := fetched[0]; !p.PeriodStart.Equal(day(tt.wantStart)) || !p.PeriodEnd.Equal(day(tt.wantEnd)) {
+				t.Errorf("period %v..%v, want %s..%s", p.PeriodStart, p.PeriodEnd, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestPrintQuery(t *testing.T) {
+	const query = "SELECT periods WHERE PeriodEnd >= @AsOfDate AND PeriodEnd >= @from AND (@to IS NULL OR PeriodStart <= @to)"
+	tests := []struct {
+		name     string
+		query    string
+		from, to string
+		scope    runScope
+		want     string
+	}{
+		{"no parameters", "SELECT periods", "", "", runScope{}, "Query:\nSELECT periods\n"},
+		{"bound values", query, "2024-01-01", "", runScope{},
+			"Query:\n" + query + "\n@AsOfDate = 2024-03-01\n@from = 2024-01-01\n@to = NULL\n"},
+		// the run scope is no query parameter, it filters the fetched periods
+		{"scope applied after the fetch", "SELECT periods", "", "", runScope{ProdNums: map[int]bool{9: true, 7: true}, Since: day("2024-02-01")},
+			"Query:\nSELECT periods\nApplied after the fetch: only prodnums 7, 9\nApplied after the fetch: only periods ending on or after 2024-02-01\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Query: tt.query, QueryFrom: tt.from, QueryTo: tt.to}
+			config.Processing.AsOfDate = ConfigDate{Time: day("2024-03-01")}
+			var b strings.Builder
+			if err := printQuery(&b, config, tt.scope); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("printed\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
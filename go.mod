@@ -2,10 +2,25 @@ module github.com/borowiak-m/file-processing-pricingperiods
 
 go 1.22.0
 
-require github.com/denisenkom/go-mssqldb v0.12.3
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/denisenkom/go-mssqldb v0.12.3
+	github.com/expr-lang/expr v1.16.9
+	github.com/segmentio/kafka-go v0.4.47
+	github.com/xuri/excelize/v2 v2.8.1
+)
 
 require (
 	github.com/golang-sql/civil v0.0.0-20190719163853-cb61b32ac6fe // indirect
 	github.com/golang-sql/sqlexp v0.1.0 // indirect
-	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	github.com/richardlehane/mscfb v1.0.4 // indirect
+	github.com/richardlehane/msoleps v1.0.3 // indirect
+	github.com/xuri/efp v0.0.0-20231025114914-d1ff6096ae53 // indirect
+	github.com/xuri/nfp v0.0.0-20230919160717-d98342af3f05 // indirect
+	golang.org/x/crypto v0.19.0 // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
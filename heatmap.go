@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// how conflicted a product's source periods are
+type OverlapHeat struct {
+	ProdNum int `json:"prodNum"`
+	// most periods covering the same day
+	MaxDepth int `json:"maxDepth"`
+	// distinct pairs of periods overlapping each other
+	OverlappingPairs int `json:"overlappingPairs"`
+}
+
+// Sweep over source periods computing the overlap depth and overlapping pairs of each product
+func overlapHeatmap(source []periods.Period, closed bool, granularity periods.Granularity) []OverlapHeat {
+	sorted := slices.Clone(source)
+	periods.SortPeriods(sorted)
+	var heatmap []OverlapHeat
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].ProdNum == sorted[start].ProdNum {
+			end++
+		}
+		product := sorted[start:end]
+		heat := OverlapHeat{ProdNum: product[0].ProdNum}
+		// depth: +1 at each start, -1 at each exclusive end, ends processed before starts at the same instant
+		type event struct {
+			at    time.Time
+			delta int
+		}
+		events := make([]event, 0, 2*len(product))
+		for _, p := range product {
+			exclusiveEnd := p.PeriodEnd
+			if closed {
+				exclusiveEnd = periods.AddGranules(exclusiveEnd, 1, granularity)
+			}
+			events = append(events, event{p.PeriodStart, 1}, event{exclusiveEnd, -1})
+		}
+		sort.Slice(events, func(i, j int) bool {
+			if !events[i].at.Equal(events[j].at) {
+				return events[i].at.Before(events[j].at)
+			}
+			return events[i].delta < events[j].delta
+		})
+		depth := 0
+		for _, e := range events {
+			depth += e.delta
+			heat.MaxDepth = max(heat.MaxDepth, depth)
+		}
+		// pairs: periods are sorted by start, so stop once a period starts after i ends
+		for i := range product {
+			for j := i + 1; j < len(product); j++ {
+				if !periods.Overlaps(product[i], product[j], closed) {
+					if product[j].PeriodStart.After(product[i].PeriodEnd) {
+						break
+					}
+					continue
+				}
+				heat.OverlappingPairs++
+			}
+		}
+		heatmap = append(heatmap, heat)
+		start = end
+	}
+	return heatmap
+}
+
+// Write the heatmap as CSV when path ends in .csv, as JSON otherwise
+func writeHeatmap(path string, heatmap []OverlapHeat) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating heatmap file: %w", err)
+	}
+	defer file.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		w := csv.NewWriter(file)
+		w.Write([]string{"ProdNum", "MaxDepth", "OverlappingPairs"})
+		for _, heat := range heatmap {
+			w.Write([]string{strconv.Itoa(heat.ProdNum), strconv.Itoa(heat.MaxDepth), strconv.Itoa(heat.OverlappingPairs)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("error writing heatmap: %w", err)
+		}
+	} else {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(heatmap); err != nil {
+			return fmt.Errorf("error writing heatmap: %w", err)
+		}
+	}
+	fmt.Printf("Overlap heatmap written to %s: %v products\n", path, len(heatmap))
+	return nil
+}
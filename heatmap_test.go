@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestOverlapHeatmap(t *testing.T) {
+	period := func(prodNum int, start, end string) periods.Period {
+		return periods.Period{ProdNum: prodNum, PeriodStart: day(start), PeriodEnd: day(end)}
+	}
+	tests := []struct {
+		name   string
+		input  []periods.Period
+		closed bool
+		want   []OverlapHeat
+	}{
+		{"nested", []periods.Period{period(1, "2024-01-01", "2024-01-31"), period(1, "2024-01-05", "2024-01-20"), period(1, "2024-01-10", "2024-01-15")}, false,
+			[]OverlapHeat{{ProdNum: 1, MaxDepth: 3, OverlappingPairs: 3}}},
+		{"chained", []periods.Period{period(1, "2024-01-01", "2024-01-10"), period(1, "2024-01-08", "2024-01-20"), period(1, "2024-01-18", "2024-01-31")}, false,
+			[]OverlapHeat{{ProdNum: 1, MaxDepth: 2, OverlappingPairs: 2}}},
+		{"shared boundary half-open", []periods.Period{period(1, "2024-01-01", "2024-01-10"), period(1, "2024-01-10", "2024-01-20")}, false,
+			[]OverlapHeat{{ProdNum: 1, MaxDepth: 1, OverlappingPairs: 0}}},
+		{"shared boundary closed", []periods.Period{period(1, "2024-01-01", "2024-01-10"), period(1, "2024-01-10", "2024-01-20")}, true,
+			[]OverlapHeat{{ProdNum: 1, MaxDepth: 2, OverlappingPairs: 1}}},
+		{"per product", []periods.Period{period(2, "2024-01-01", "2024-01-10"), period(1, "2024-01-01", "2024-01-10"), period(2, "2024-01-05", "2024-01-20")}, false,
+			[]OverlapHeat{{ProdNum: 1, MaxDepth: 1}, {ProdNum: 2, MaxDepth: 2, OverlappingPairs: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlapHeatmap(tt.input, tt.closed, periods.Day); !slices.Equal(got, tt.want) {
+				t.Errorf("heatmap %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteHeatmapCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heatmap.csv")
+	if err := writeHeatmap(path, []OverlapHeat{{ProdNum: 7, MaxDepth: 3, OverlappingPairs: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ProdNum,MaxDepth,OverlappingPairs\n7,3,2\n"; string(data) != want {
+		t.Errorf("heatmap file %q, want %q", data, want)
+	}
+}
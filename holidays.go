@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// holiday calendars already loaded this run, keyed by file and region
+var holidayCache = make(map[string]map[string]bool)
+
+// Load the holidays of a region from a JSON file ({"region": ["YYYY-MM-DD", ...]})
+// or a CSV file (region,date rows), dates are validated on load
+func loadHolidays(path, region string) (map[string]bool, error) {
+	key := path + "|" + region
+	if holidays, ok := holidayCache[key]; ok {
+		return holidays, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading holiday file: %w", err)
+	}
+	byRegion := make(map[string][]string)
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing holiday file: %w", err)
+		}
+		for i, record := range records {
+			if len(record) != 2 {
+				return nil, fmt.Errorf("holiday file line %d: expected region,date", i+1)
+			}
+			// optional header row
+			if i == 0 && strings.EqualFold(strings.TrimSpace(record[1]), "date") {
+				continue
+			}
+			recordRegion := strings.TrimSpace(record[0])
+			byRegion[recordRegion] = append(byRegion[recordRegion], strings.TrimSpace(record[1]))
+		}
+	} else if err := json.Unmarshal(data, &byRegion); err != nil {
+		return nil, fmt.Errorf("error parsing holiday file: %w", err)
+	}
+	dates, ok := byRegion[region]
+	if !ok {
+		return nil, fmt.Errorf("holiday file %s has no region %q", path, region)
+	}
+	holidays := make(map[string]bool, len(dates))
+	for _, value := range dates {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("holiday %q of region %q is not a YYYY-MM-DD date", value, region)
+		}
+		holidays[date.Format("2006-01-02")] = true
+	}
+	holidayCache[key] = holidays
+	return holidays, nil
+}
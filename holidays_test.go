@@ -0,0 +1,56 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadHolidays(t *testing.T) {
+	tests := []struct {
+		name, file, content, region string
+		want                        map[string]bool
+		wantErr                     bool
+	}{
+		{"json", "holidays.json", `{"PL": ["2024-01-01", "2024-01-06"], "DE": ["2024-10-03"]}`, "PL",
+			map[string]bool{"2024-01-01": true, "2024-01-06": true}, false},
+		{"csv with header", "holidays.csv", "region,date\nPL,2024-01-01\nDE, 2024-10-03\n", "DE",
+			map[string]bool{"2024-10-03": true}, false},
+		{"missing region", "holidays.json", `{"PL": ["2024-01-01"]}`, "DE", nil, true},
+		{"invalid date", "holidays.csv", "PL,01/06/2024\n", "PL", nil, true},
+		{"malformed csv row", "holidays.csv", "PL,2024-01-01,bank\n", "PL", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadHolidays(path, tt.region)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("holidays %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadHolidaysCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holidays.json")
+	if err := os.WriteFile(path, []byte(`{"PL": ["2024-01-01"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHolidays(path, "PL"); err != nil {
+		t.Fatal(err)
+	}
+	// the calendar is read once a run
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if holidays, err := loadHolidays(path, "PL"); err != nil || !holidays["2024-01-01"] {
+		t.Errorf("cached holidays %v (%v)", holidays, err)
+	}
+}
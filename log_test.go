@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestFormatLogEntry(t *testing.T) {
+	period := periods.Period{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10.50"), PeriodPriority: 2}
+	const timestamp = "2024-02-01 09:00:00"
+
+	entry, err := formatLogEntry("kv", timestamp, "processed", time.DateOnly, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`).FindAllStringSubmatch(entry, -1)
+	kv := map[string]string{}
+	for _, pair := range pairs {
+		value := pair[2]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		kv[pair[1]] = value
+	}
+	wantKV := map[string]string{"time": timestamp, "action": "processed", "product": "7", "start": "2024-01-01", "end": "2024-01-10", "price": "10.50", "priority": "2"}
+	if !maps.Equal(kv, wantKV) {
+		t.Errorf("kv entry %q parses to %v, want %v", entry, kv, wantKV)
+	}
+
+	entry, err = formatLogEntry("json", timestamp, "processed", time.DateOnly, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(entry), &decoded); err != nil {
+		t.Fatalf("json entry %q does not parse: %v", entry, err)
+	}
+	wantJSON := map[string]any{"time": timestamp, "action": "processed", "product": 7.0, "start": "2024-01-01", "end": "2024-01-10", "price": 10.5, "priority": 2.0}
+	if !maps.Equal(decoded, wantJSON) {
+		t.Errorf("json entry parses to %v, want %v", decoded, wantJSON)
+	}
+
+	if _, err := formatLogEntry("xml", timestamp, "processed", time.DateOnly, period); err == nil {
+		t.Error("no error for an unknown record format")
+	}
+}
+
+func TestLogRecordsetCount(t *testing.T) {
+	var config Config
+	config.Logging.FilePath = filepath.Join(t.TempDir(), "periods.log")
+	list := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")},
+		{ID: 2, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20")},
+		{ID: 3, ProdNum: 9, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31")},
+	}
+	// the log file is appended to, the count is of this call's periods
+	for _, tt := range []struct {
+		logged    []periods.Period
+		wantLines int
+	}{{list, 3}, {list[:1], 4}} {
+		var err error
+		logged := captureLog(t, func() { err = logRecordset(tt.logged, &config, "processed") })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "msg=\"all periods logged\" action=processed periods=" + strconv.Itoa(len(tt.logged)) + "\n"; !strings.HasSuffix(logged, want) {
+			t.Errorf("logged %q, want it to end with %q", logged, want)
+		}
+		data, err := os.ReadFile(config.Logging.FilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != tt.wantLines {
+			t.Errorf("log file has %d lines, want %d", lines, tt.wantLines)
+		}
+	}
+}
+
+func TestLogRecordsetWriteErrors(t *testing.T) {
+	// every write to /dev/full fails with no space left on device
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full on this system")
+	}
+	var config Config
+	config.Logging.FilePath = "/dev/full"
+	list := []periods.Period{{ID: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")}, {ID: 2, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20")}}
+	var err error
+	logged := captureLog(t, func() { err = logRecordset(list, &config, "processed") })
+	if err == nil || !strings.Contains(err.Error(), "logged 0 of 2 periods") {
+		t.Errorf("err = %v, want the periods not logged reported", err)
+	}
+	if strings.Contains(logged, "all periods logged") || strings.Count(logged, "level=WARN") != 2 {
+		t.Errorf("logged %q, want a warning per failed write and none reported as logged", logged)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		debug     bool
+		wantLines []string
+	}{
+		{"text at info", "", false, []string{`level=INFO msg=run prodnum=7`}},
+		{"json with debug", "json", true, []string{`"level":"DEBUG","msg":"decision","prodnum":7`, `"level":"INFO","msg":"run","prodnum":7`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			config.Logging.Format = tt.format
+			config.Logging.DebugMode = tt.debug
+			config.Logging.LogToFile = true
+			config.Logging.FilePath = filepath.Join(t.TempDir(), "run.log")
+			logger, closeLog, err := newLogger(&config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.Debug("decision", "prodnum", 7)
+			logger.Info("run", "prodnum", 7)
+			closeLog()
+			// the run log goes beside the period log, not into it
+			data, err := os.ReadFile(config.runLogPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if len(lines) != len(tt.wantLines) {
+				t.Fatalf("logged %q, want %d lines", lines, len(tt.wantLines))
+			}
+			for i, want := range tt.wantLines {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("line %q does not contain %s", lines[i], want)
+				}
+			}
+		})
+	}
+}
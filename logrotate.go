@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestamp suffix of rotated log files, sorts chronologically as text
+const rotatedLogFormat = "20060102-150405"
+
+// Open the log file for appending, first rotating it when it has grown past maxSizeMB (0 means no cap):
+// the full file is renamed with a timestamp suffix and only the newest maxBackups rotated files are kept (0 keeps all)
+func openLogFile(path string, maxSizeMB, maxBackups int) (*os.File, error) {
+	if maxSizeMB > 0 {
+		info, err := os.Stat(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("error checking log file size: %w", err)
+		}
+		if err == nil && info.Size() > int64(maxSizeMB)<<20 {
+			if err := rotateLogFile(path, maxBackups); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+}
+
+// Rename the log file with a timestamp suffix and remove rotated files beyond maxBackups, oldest first;
+// a rotation within the same second as an earlier one gets a counter after the timestamp instead of replacing it
+func rotateLogFile(path string, maxBackups int) error {
+	rotated := path + "." + time.Now().Format(rotatedLogFormat)
+	for n := 1; ; n++ {
+		_, err := os.Lstat(rotated)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error checking rotated log file: %w", err)
+		}
+		rotated = fmt.Sprintf("%s.%s-%d", path, time.Now().Format(rotatedLogFormat), n)
+	}
+	if err := os.Rename(path, rotated); err != nil {
+		return fmt.Errorf("error rotating log file: %w", err)
+	}
+	fmt.Printf("Log file %s rotated to %s\n", path, rotated)
+	if maxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return fmt.Errorf("error listing rotated log files: %w", err)
+	}
+	type backup struct {
+		name    string
+		rotated time.Time
+		n       int
+	}
+	var backups []backup
+	for _, match := range matches {
+		if rotated, n, ok := parseRotatedSuffix(strings.TrimPrefix(match, path+".")); ok {
+			backups = append(backups, backup{match, rotated, n})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].rotated.Equal(backups[j].rotated) {
+			return backups[i].rotated.Before(backups[j].rotated)
+		}
+		return backups[i].n < backups[j].n
+	})
+	for len(backups) > maxBackups {
+		if err := os.Remove(backups[0].name); err != nil {
+			return fmt.Errorf("error removing old log file: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Timestamp and counter (0 when absent) of a rotated log file suffix, ok is false for any other file
+func parseRotatedSuffix(suffix string) (rotated time.Time, n int, ok bool) {
+	if len(suffix) < len(rotatedLogFormat) {
+		return time.Time{}, 0, false
+	}
+	rotated, err := time.Parse(rotatedLogFormat, suffix[:len(rotatedLogFormat)])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if rest := suffix[len(rotatedLogFormat):]; rest != "" {
+		counter, found := strings.CutPrefix(rest, "-")
+		if n, err = strconv.Atoi(counter); !found || err != nil || n < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return rotated, n, true
+}
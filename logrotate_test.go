@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpenLogFileRotates(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		maxSizeMB   int
+		wantRotated bool
+	}{
+		{"under cap", 1 << 20, 1, false},
+		{"over cap", 1<<20 + 1, 1, true},
+		{"no cap", 1<<20 + 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "periods.log")
+			if err := os.WriteFile(path, make([]byte, tt.size), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := openLogFile(path, tt.maxSizeMB, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			backups, err := filepath.Glob(path + ".*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated := len(backups) == 1; rotated != tt.wantRotated || len(backups) > 1 {
+				t.Fatalf("rotated files %q, want rotated %v", backups, tt.wantRotated)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a rotated log starts afresh, otherwise it is appended to
+			wantSize := int64(tt.size)
+			if tt.wantRotated {
+				wantSize = 0
+			}
+			if info.Size() != wantSize {
+				t.Errorf("log file size %d after open, want %d", info.Size(), wantSize)
+			}
+		})
+	}
+}
+
+func TestOpenLogFileRotatesWithinSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "periods.log")
+	// runs in quick succession rotate within the same second, none may replace an earlier backup
+	for run := 0; run < 3; run++ {
+		if err := os.WriteFile(path, make([]byte, 1<<20+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := openLogFile(path, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("rotated files %q, want 3", backups)
+	}
+}
+
+func TestRotateLogFilePrunesOldest(t *testing.T) {
+	tests := []struct {
+		name    string
+		backups []string
+		want    []string
+	}{
+		{"dated backups", []string{"periods.log.20240101-120000", "periods.log.20240102-120000"}, []string{"periods.log.20240102-120000"}},
+		// the counter orders backups of the same second numerically
+		{"same second backups", []string{"periods.log.20240101-120000", "periods.log.20240101-120000-2", "periods.log.20240101-120000-10", "periods.log.20240101-120000-1"},
+			[]string{"periods.log.20240101-120000-10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "periods.log")
+			for _, name := range append(tt.backups, "periods.log.notes") {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := rotateLogFile(path, 2); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept []string
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Name(), "periods.log.2024") {
+					kept = append(kept, entry.Name())
+				}
+			}
+			// the new backup is the newest, only the oldest ones go
+			if !slices.Equal(kept, tt.want) {
+				t.Errorf("kept %q, want %q", kept, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "periods.log.notes")); err != nil {
+				t.Errorf("unrelated file removed: %v", err)
+			}
+		})
+	}
+}
@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
 	_ "github.com/denisenkom/go-mssqldb" // SQL server driver
 )
 
@@ -19,31 +35,442 @@ const (
 	PROD_CONFIG = "config.production.json"
 )
 
+// connection settings of a single database
+type DatabaseConfig struct {
+	Server             string `json:"serverName"`
+	Database           string `json:"databaseName"`
+	IntegratedSecurity bool   `json:"integratedSecurity"`
+	ApplicationIntent  string `json:"applicationIntent"`
+	ApplicationName    string `json:"applicationName"`
+	// SQL Server authentication when integrated security is off, falling back to
+	// the PRICINGPERIODS_DB_USER and PRICINGPERIODS_DB_PASSWORD environment variables
+	Username string `json:"username"`
+	Password Secret `json:"password"`
+	// "true", "false" or "disable", driver default when empty
+	Encrypt                string `json:"encrypt"`
+	TrustServerCertificate bool   `json:"trustServerCertificate"`
+	// dial and login timeout of the initial connection, separate from query timeouts (0 means driver default)
+	ConnectTimeoutSeconds int `json:"connectTimeoutSeconds"`
+	// connection pool limits, defaults apply when 0 so long runs do not pile up idle connections
+	MaxOpenConns           int `json:"maxOpenConns"`
+	MaxIdleConns           int `json:"maxIdleConns"`
+	ConnMaxLifetimeSeconds int `json:"connMaxLifetimeSeconds"`
+	// connection attempts on transient failures such as a failover, waiting retryBaseDelayMs doubled after each
+	RetryAttempts    int `json:"retryAttempts"`
+	RetryBaseDelayMs int `json:"retryBaseDelayMs"`
+}
+
+// pool limits used when not configured
+const (
+	defaultMaxOpenConns    = 10
+	defaultMaxIdleConns    = 2
+	defaultConnMaxLifetime = 30 * time.Minute
+)
+
+// secret config value, printed redacted
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+// Encode redacted, so configs logged by the JSON handler or written to files never carry the secret
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Log redacted when logged on its own
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
 type Config struct {
 	Database struct {
-		Server             string `json:"serverName"`
-		Database           string `json:"databaseName"`
-		IntegratedSecurity bool   `json:"integratedSecurity"`
-		ApplicationIntent  string `json:"applicationIntent"`
-		ApplicationName    string `json:"applicationName"`
+		DatabaseConfig
+		// bound on each query including reading its rows, and on the write-back transaction (0 means no timeout)
+		QueryTimeoutSeconds int `json:"queryTimeoutSeconds"`
+		// optional separate connections for reading (replica) and writing (primary)
+		Read  *DatabaseConfig `json:"read"`
+		Write *DatabaseConfig `json:"write"`
+		// periods are read from all shards (products never cross shards), at most maxParallelShards at a time,
+		// a failing shard fails the run or is skipped with shardFailurePolicy "skip"
+		Shards             []DatabaseConfig `json:"shards"`
+		MaxParallelShards  int              `json:"maxParallelShards"`
+		ShardFailurePolicy string           `json:"shardFailurePolicy"`
+		// isolation level of write-back transactions, e.g. "ReadCommitted" or "Snapshot"
+		IsolationLevel string `json:"isolationLevel"`
 	} `json:"database"`
+	// sql query inline, used instead of reading queryPath when set
+	Query     string `json:"query"`
 	QueryPath string `json:"queryPath"`
-	Logging   struct {
+	// optional date window ("YYYY-MM-DD") passed to queries referencing @from and @to, overriden by -from and -to;
+	// a bound that is not set is passed as NULL, so with only one bound the query should guard the other,
+	// e.g. "(@to IS NULL OR PeriodStart <= @to)", queries not referencing them run as before
+	QueryFrom string `json:"queryFrom"`
+	QueryTo   string `json:"queryTo"`
+	// optional named sources processed together, each with its own query, used instead of queryPath
+	Sources []struct {
+		Name      string `json:"name"`
+		QueryPath string `json:"queryPath"`
+	} `json:"sources"`
+	// table processed periods are written back to, replacing the stored rows of the processed products
+	WriteTable string `json:"writeTable"`
+	// column names of the write table when they differ from the Period field names
+	WriteColumns ColumnMapping `json:"writeColumns"`
+	// only used when QueryPath is an http(s):// URL
+	QueryURL struct {
+		AuthHeader     Secret `json:"authHeader"`
+		TimeoutSeconds int    `json:"timeoutSeconds"`
+	} `json:"queryUrl"`
+	Processing struct {
+		// safety cap on rows fetched from db (0 means no cap)
+		MaxRows    int `json:"maxRows"`
+		AllowLarge bool
+		// "closed" (default) when period end dates are inclusive, or "halfOpen" when they are exclusive
+		IntervalMode string `json:"intervalMode"`
+		// IANA location period boundaries are read and counted in, e.g. "Europe/Warsaw", UTC when not set
+		TimeZone string `json:"timeZone"`
+		// fetch and process one product at a time, query must be ordered by ProdNum
+		StreamByProduct bool `json:"streamByProduct"`
+		// with streamByProduct, write each product to csv or log output as soon as it is resolved instead of
+		// keeping all output in memory, so memory stays bounded by the largest product; whole-run steps
+		// (gap filling, write-back and the reports comparing input and output) are not available
+		StreamOutput bool `json:"streamOutput"`
+		// overlap resolution algorithm: "pairwise" (default) or "sweepline"
+		Resolver string `json:"resolver"`
+		// equal priority tie break: "id" (lower wins), "price" (higher wins), "source" (earlier source wins),
+		// earlier start wins when not set
+		TieBreak string `json:"tieBreak"`
+		// boolean expression over current and next periods, true when current wins an overlap
+		ResolutionRule string `json:"resolutionRule"`
+		// which of two overlapping periods wins when no resolution rule is set:
+		// "priority" (default, lower number wins), "highestPrice" or "lowestPrice"
+		ResolutionStrategy string `json:"resolutionStrategy"`
+		// plausible range of period dates ("YYYY-MM-DD", default 2000-01-01 to 2100-12-31)
+		MinDate string `json:"minDate"`
+		MaxDate string `json:"maxDate"`
+		// date passed to templated queries as @AsOfDate ("YYYY-MM-DD", default today)
+		AsOfDate ConfigDate `json:"asOfDate"`
+		// JSON file of expected {min, max} price per ProdNum, checked after processing
+		PriceBandsPath string `json:"priceBandsPath"`
+		// low memory mode streams by product reusing one product buffer, trading speed for bounded memory,
+		// returning memory to the OS every freeOSMemoryEvery products when set
+		LowMemory         bool
+		FreeOSMemoryEvery int `json:"freeOSMemoryEvery"`
+		// "error" (default), "skip", "zero" or "carry-forward"
+		NullPricePolicy string `json:"nullPricePolicy"`
+		// priority of periods fetched by a query without a PeriodPriority column
+		DefaultPriority int `json:"defaultPriority"`
+		// boundary shifts skip weekends and the listed holidays ("YYYY-MM-DD")
+		BusinessDaysOnly bool     `json:"businessDaysOnly"`
+		Holidays         []string `json:"holidays"`
+		// holiday calendar file (JSON or CSV) with dates per region, merged with holidays
+		HolidayFile string `json:"holidayFile"`
+		Region      string `json:"region"`
+		// snap adjusted boundaries to the day grid anchored at gridEpoch (RFC3339, default 1970-01-01T00:00:00Z)
+		SnapToGrid bool   `json:"snapToGrid"`
+		GridEpoch  string `json:"gridEpoch"`
+		// client normalization after resolution: "month" snaps boundaries to calendar month starts
+		SnapBoundariesTo string `json:"snapBoundariesTo"`
+		// time of day ("HH:MM") days start at, midnight by default
+		DayAnchor string `json:"dayAnchor"`
+		// step between adjacent periods: "day" (default), "month" or a duration, e.g. "1h" for hourly feeds
+		Granularity string `json:"granularity"`
+		// abort when a product splits periods more often than this (0 means no cap)
+		MaxSplitsPerProduct int `json:"maxSplitsPerProduct"`
+		// overlaps up to this many seconds are treated as adjacent, optionally overriden per ProdNum
+		OverlapToleranceSeconds        int         `json:"overlapToleranceSeconds"`
+		ProductOverlapToleranceSeconds map[int]int `json:"productOverlapToleranceSeconds"`
+		// fill days left uncovered between a product's periods after processing: "extend" the period
+		// before the gap or add a "default" period priced at gapPrice, gaps are only reported when not set
+		FillGaps string        `json:"fillGaps"`
+		GapPrice periods.Price `json:"gapPrice"`
+		// products resolved concurrently, all CPUs when not set
+		Workers int `json:"workers"`
+		// skip inverted and zero length periods instead of failing the run on them
+		SkipInvalidPeriods bool `json:"skipInvalidPeriods"`
+		// fail the run on conflicts processing could not resolve instead of logging them and writing the best-effort result
+		AbortOnConflicts bool `json:"abortOnConflicts"`
+	} `json:"processing"`
+	Output struct {
+		// base directory for all generated files
+		Dir string `json:"dir"`
+		// "xlsx", "csv", "json" (array of periods), "log" (log entries in logging.recordFormat),
+		// "timeline" (JSON price segments per product), "table" (aligned text on stdout) or "queue"
+		Format   string `json:"format"`
+		FilePath string `json:"filePath"`
+		// write the periods processed so far when -max-runtime is exceeded, instead of exiting without output
+		WritePartialOnTimeout bool `json:"writePartialOnTimeout"`
+		// write end dates as inclusive (processing uses exclusive ends)
+		EndDateInclusive bool `json:"endDateInclusive"`
+		// write a .sha256 sidecar next to each output file when -output-hash is set
+		HashSidecar bool `json:"hashSidecar"`
+		// used when format is "queue"
+		Queue struct {
+			Brokers          []string `json:"brokers"`
+			Topic            string   `json:"topic"`
+			RetryAttempts    int      `json:"retryAttempts"`
+			RetryBaseDelayMs int      `json:"retryBaseDelayMs"`
+		} `json:"queue"`
+	} `json:"output"`
+	// optional webhook notified with the run summary after each run
+	Notify struct {
+		WebhookURL       string `json:"webhookUrl"`
+		TimeoutSeconds   int    `json:"timeoutSeconds"`
+		RetryAttempts    int    `json:"retryAttempts"`
+		RetryBaseDelayMs int    `json:"retryBaseDelayMs"`
+	} `json:"notify"`
+	// HTTP server of -serve mode
+	Serve struct {
+		// listen address, ":8080" when not set
+		Address string `json:"address"`
+	} `json:"serve"`
+	Logging struct {
 		DebugMode                 bool
 		LogDbResultsToFile        bool   `json:"logDbResultsToFile"`
 		LogProcessedResultsToFile bool   `json:"logProcessedResultsToFile"`
 		FilePath                  string `json:"filePath"`
+		// rotate the log file once it grows past maxLogSizeMB (0 means never), keeping maxLogBackups rotated files (0 keeps all)
+		MaxLogSizeMB  int `json:"maxLogSizeMB"`
+		MaxLogBackups int `json:"maxLogBackups"`
+		// "text" (default), "kv" or "json"
+		RecordFormat string `json:"recordFormat"`
+		// run log handler: "text" (default) or "json", written to stderr or with logToFile appended to runLogPath,
+		// by default "<filePath name>.run<ext>" next to filePath, a file of its own as records are appended to filePath
+		Format     string `json:"format"`
+		LogToFile  bool   `json:"logToFile"`
+		RunLogPath string `json:"runLogPath"`
 	} `json:"logging"`
 }
 
-// object corresponding to a row of data returned from db
-type Period struct {
-	ID             int
-	PeriodStart    time.Time
-	PeriodEnd      time.Time
-	Price          float64
-	ProdNum        int
-	PeriodPriority int
+// Check required fields and allowed values of the config, reporting every problem found.
+// Only the config itself is checked: no files are read and the db is not contacted, see checkFiles.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.connection(ReadConnection).Server == "" && len(c.Database.Shards) == 0 {
+		errs = append(errs, errors.New("database.serverName is required"))
+	}
+	if c.connection(ReadConnection).Database == "" && len(c.Database.Shards) == 0 {
+		errs = append(errs, errors.New("database.databaseName is required"))
+	}
+	for i, shard := range c.Database.Shards {
+		if shard.Server == "" || shard.Database == "" {
+			errs = append(errs, fmt.Errorf("database.shards[%d]: serverName and databaseName are required", i))
+		}
+	}
+	// read and write connections are often the same one, report each server once
+	badIntent := make(map[string]bool)
+	for _, db := range append([]DatabaseConfig{c.connection(ReadConnection), c.connection(WriteConnection)}, c.Database.Shards...) {
+		if !slices.Contains([]string{"", "ReadOnly", "ReadWrite"}, db.ApplicationIntent) && !badIntent[db.Server] {
+			badIntent[db.Server] = true
+			errs = append(errs, fmt.Errorf("database applicationIntent %q of server %s must be ReadOnly or ReadWrite", db.ApplicationIntent, db.Server))
+		}
+	}
+	if db := c.Database.DatabaseConfig; db.MaxOpenConns < 0 || db.MaxIdleConns < 0 || db.ConnMaxLifetimeSeconds < 0 {
+		errs = append(errs, errors.New("database.maxOpenConns, maxIdleConns and connMaxLifetimeSeconds must not be negative"))
+	}
+	if db := c.Database.DatabaseConfig; db.RetryAttempts < 0 || db.RetryBaseDelayMs < 0 {
+		errs = append(errs, errors.New("database.retryAttempts and retryBaseDelayMs must not be negative"))
+	}
+	if !slices.Contains([]string{"", "fail-fast", "skip"}, c.Database.ShardFailurePolicy) {
+		errs = append(errs, fmt.Errorf("database.shardFailurePolicy %q must be fail-fast or skip", c.Database.ShardFailurePolicy))
+	}
+	if len(c.Database.Shards) > 0 && c.Processing.StreamByProduct {
+		errs = append(errs, errors.New("processing.streamByProduct is not supported with database.shards"))
+	}
+	if _, err := parseIsolationLevel(c.Database.IsolationLevel); err != nil {
+		errs = append(errs, fmt.Errorf("database.isolationLevel: %w", err))
+	}
+	if c.connection(ReadConnection).ConnectTimeoutSeconds < 0 || c.connection(WriteConnection).ConnectTimeoutSeconds < 0 {
+		errs = append(errs, errors.New("database.connectTimeoutSeconds must not be negative"))
+	}
+	if c.Query == "" && c.QueryPath == "" && len(c.Sources) == 0 {
+		errs = append(errs, errors.New("query, queryPath or sources is required"))
+	}
+	for i, source := range c.Sources {
+		if source.Name == "" || source.QueryPath == "" {
+			errs = append(errs, fmt.Errorf("sources[%d] requires a name and a queryPath", i))
+		}
+	}
+	if len(c.Sources) > 0 && c.Processing.StreamByProduct {
+		errs = append(errs, errors.New("processing.streamByProduct is not supported with multiple sources"))
+	}
+	if c.Processing.StreamOutput {
+		if !c.Processing.StreamByProduct {
+			errs = append(errs, errors.New("processing.streamOutput requires processing.streamByProduct"))
+		}
+		if c.Output.Format != "csv" && c.Output.Format != "log" {
+			errs = append(errs, fmt.Errorf("processing.streamOutput supports csv and log output, not %q", c.Output.Format))
+		}
+		if c.Processing.FillGaps != "" || c.WriteTable != "" {
+			errs = append(errs, errors.New("processing.streamOutput cannot be combined with processing.fillGaps or writeTable"))
+		}
+	}
+	if (c.Logging.LogDbResultsToFile || c.Logging.LogProcessedResultsToFile) && c.Logging.FilePath == "" && c.Output.Dir == "" {
+		errs = append(errs, errors.New("logging.filePath is required when logging results to file"))
+	}
+	if !slices.Contains([]string{"", "text", "json"}, c.Logging.Format) {
+		errs = append(errs, fmt.Errorf("logging.format %q must be text or json", c.Logging.Format))
+	}
+	if c.Logging.MaxLogSizeMB < 0 || c.Logging.MaxLogBackups < 0 {
+		errs = append(errs, errors.New("logging.maxLogSizeMB and maxLogBackups must not be negative"))
+	}
+	if c.Logging.LogToFile && c.Logging.FilePath == "" && c.Logging.RunLogPath == "" && c.Output.Dir == "" {
+		errs = append(errs, errors.New("logging.runLogPath or filePath is required with logging.logToFile"))
+	}
+	if c.Logging.RunLogPath != "" && c.Logging.RunLogPath == c.Logging.FilePath {
+		errs = append(errs, errors.New("logging.runLogPath must not be logging.filePath, records are appended and rotated there"))
+	}
+	if !slices.Contains([]string{"", "text", "kv", "json"}, c.Logging.RecordFormat) {
+		errs = append(errs, fmt.Errorf("logging.recordFormat %q must be text, kv or json", c.Logging.RecordFormat))
+	}
+	if _, err := c.location(); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains([]string{"", "halfOpen", "closed"}, c.Processing.IntervalMode) {
+		errs = append(errs, fmt.Errorf("processing.intervalMode %q must be halfOpen or closed", c.Processing.IntervalMode))
+	}
+	if !slices.Contains([]string{"", "error", "skip", "zero", "carry-forward"}, c.Processing.NullPricePolicy) {
+		errs = append(errs, fmt.Errorf("processing.nullPricePolicy %q must be error, skip, zero or carry-forward", c.Processing.NullPricePolicy))
+	}
+	for _, holiday := range c.Processing.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			errs = append(errs, fmt.Errorf("processing.holidays %q is not a YYYY-MM-DD date", holiday))
+		}
+	}
+	if err := c.Processing.AsOfDate.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("processing.asOfDate %w", err))
+	}
+	if _, _, err := c.queryWindow(); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains([]string{"", "extend", "default"}, c.Processing.FillGaps) {
+		errs = append(errs, fmt.Errorf("processing.fillGaps %q must be extend or default", c.Processing.FillGaps))
+	}
+	if !slices.Contains([]string{"", "month"}, c.Processing.SnapBoundariesTo) {
+		errs = append(errs, fmt.Errorf("processing.snapBoundariesTo %q must be month", c.Processing.SnapBoundariesTo))
+	}
+	if _, err := c.granularity(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Processing.MaxSplitsPerProduct < 0 {
+		errs = append(errs, errors.New("processing.maxSplitsPerProduct must not be negative"))
+	}
+	if c.Processing.HolidayFile != "" && c.Processing.Region == "" {
+		errs = append(errs, errors.New("processing.region is required with processing.holidayFile"))
+	}
+	if !slices.Contains([]string{"", "id", "price", "source"}, c.Processing.TieBreak) {
+		errs = append(errs, fmt.Errorf("processing.tieBreak %q must be id, price or source", c.Processing.TieBreak))
+	}
+	if _, err := periods.ResolutionRuleByName(c.Processing.ResolutionStrategy, periods.ProcessOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("processing.resolutionStrategy: %w", err))
+	} else if c.Processing.ResolutionStrategy != "" && c.Processing.ResolutionRule != "" {
+		errs = append(errs, errors.New("processing.resolutionStrategy and resolutionRule cannot both be set"))
+	}
+	if _, err := periods.ResolverByName(c.Processing.Resolver); err != nil {
+		errs = append(errs, fmt.Errorf("processing.resolver: %w", err))
+	}
+	for _, date := range []struct{ name, value string }{{"minDate", c.Processing.MinDate}, {"maxDate", c.Processing.MaxDate}} {
+		if _, err := time.Parse("2006-01-02", date.value); date.value != "" && err != nil {
+			errs = append(errs, fmt.Errorf("processing.%s %q is not a YYYY-MM-DD date", date.name, date.value))
+		}
+	}
+	if c.Processing.DayAnchor != "" {
+		if _, err := periods.ParseDayAnchor(c.Processing.DayAnchor); err != nil {
+			errs = append(errs, fmt.Errorf("processing.dayAnchor: %w", err))
+		}
+	}
+	if c.Processing.GridEpoch != "" {
+		if _, err := time.Parse(time.RFC3339, c.Processing.GridEpoch); err != nil {
+			errs = append(errs, fmt.Errorf("processing.gridEpoch %q is not an RFC3339 timestamp", c.Processing.GridEpoch))
+		}
+	}
+	switch c.Output.Format {
+	case "", "table":
+	case "queue":
+		if len(c.Output.Queue.Brokers) == 0 || c.Output.Queue.Topic == "" {
+			errs = append(errs, errors.New("output.queue.brokers and output.queue.topic are required for queue output"))
+		}
+	default:
+		if _, ok := fileWriters[c.Output.Format]; !ok {
+			formats := make([]string, 0, len(fileWriters))
+			for format := range fileWriters {
+				formats = append(formats, format)
+			}
+			sort.Strings(formats)
+			errs = append(errs, fmt.Errorf("output.format %q must be one of %s, table or queue", c.Output.Format, strings.Join(formats, ", ")))
+		} else if c.Output.FilePath == "" && c.Output.Dir == "" {
+			errs = append(errs, fmt.Errorf("output.filePath is required for %s output", c.Output.Format))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Look for the config file in CWD, then the user config dir, then /etc
+func findConfig(name string) (string, error) {
+	searchDirs := []string{"."}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		searchDirs = append(searchDirs, filepath.Join(configHome, "pricingperiods"))
+	}
+	searchDirs = append(searchDirs, "/etc/pricingperiods")
+	for _, dir := range searchDirs {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("config file %s not found in %v", name, searchDirs)
+}
+
+// Check the set run flags (by name) against streamed output, which is written product by product
+// and ends the run there: flags that skip writing or need the whole output cannot be honoured
+func (c *Config) checkStreamOutputFlags(set map[string]bool) error {
+	if !c.Processing.StreamOutput {
+		return nil
+	}
+	var conflicting []string
+	for name, isSet := range set {
+		if isSet {
+			conflicting = append(conflicting, name)
+		}
+	}
+	if len(conflicting) == 0 {
+		return nil
+	}
+	slices.Sort(conflicting)
+	return fmt.Errorf("processing.streamOutput cannot be combined with %s", strings.Join(conflicting, ", "))
+}
+
+// Check that the local files the config references exist, reporting every missing one;
+// query URLs are not fetched
+func (c *Config) checkFiles() error {
+	var errs []error
+	check := func(field, path string) {
+		if path == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+			return
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+	if c.Query == "" && len(c.Sources) == 0 {
+		check("queryPath", c.QueryPath)
+	}
+	for i, source := range c.Sources {
+		check(fmt.Sprintf("sources[%d].queryPath", i), source.QueryPath)
+	}
+	check("processing.holidayFile", c.Processing.HolidayFile)
+	check("processing.priceBandsPath", c.Processing.PriceBandsPath)
+	return errors.Join(errs...)
 }
 
 // Read config from a JSON file
@@ -58,301 +485,1762 @@ func readConfig(path string) (*Config, error) {
 	if err := json.Unmarshal(file, &config); err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
+	if config.Processing.AsOfDate.IsZero() && config.Processing.AsOfDate.Err() == nil {
+		config.Processing.AsOfDate = today()
+	}
 	// return pointer to new config objects and no error
 	return &config, nil
 }
 
-// Connect to the dabatase
-func connectDB(cfg Config) (*sql.DB, error) {
-	connStr := fmt.Sprintf("server=%s;database=%s;integrated security=%t;application intent=%s; application name=%s",
-		cfg.Database.Server,
-		cfg.Database.Database,
-		cfg.Database.IntegratedSecurity,
-		cfg.Database.ApplicationIntent,
-		cfg.Database.ApplicationName)
-	// debug mode: log connection string
-	if cfg.Logging.DebugMode {
-		fmt.Printf("Connection string: %s\n", connStr)
+// Resolve a generated file path against the output dir (absolute paths are kept as is)
+func resolveOutputPath(dir, path, defaultName string) string {
+	if path == "" {
+		path = defaultName
 	}
-	// open connection
-	db, err := sql.Open("mssql", connStr)
-	// check for error
-	if err != nil {
-		return nil, fmt.Errorf("error connecting to the database: %w", err)
+	if dir == "" || filepath.IsAbs(path) {
+		return path
 	}
-	// return db object and no error
-	return db, nil
+	return filepath.Join(dir, path)
 }
 
-func fetchPeriods(db *sql.DB, config *Config) ([]Period, error) {
-	// read sql query from file
-	query, err := os.ReadFile(config.QueryPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read query from file: %w", err)
+// database connection roles
+const (
+	ReadConnection  = "read"
+	WriteConnection = "write"
+)
+
+// Connection settings for a role, falling back to the other role's block
+// and then to the top level database block when not configured
+func (c *Config) connection(role string) DatabaseConfig {
+	primary, secondary := c.Database.Read, c.Database.Write
+	if role == WriteConnection {
+		primary, secondary = secondary, primary
 	}
-	// debug mode: log query read from file
-	if config.Logging.DebugMode {
-		fmt.Println("Query: ", string(query))
+	if primary != nil {
+		return *primary
 	}
-
-	// execute sql query
-	rows, err := db.Query(string(query))
-	if err != nil {
-		return nil, fmt.Errorf("query execution failed: %w", err)
+	if secondary != nil {
+		return *secondary
 	}
-	defer rows.Close() // close rows after processing
-
-	// results read from db will be stored in the slice of Period objects
-	var periods []Period
+	return c.Database.DatabaseConfig
+}
 
-	for rows.Next() {
-		var p Period // scan each rows into Period struct
-		// Scan field order must match sql query field order
-		if err := rows.Scan(
-			&p.ID,
-			&p.PeriodStart,
-			&p.PeriodEnd,
-			&p.Price,
-			&p.ProdNum,
-			&p.PeriodPriority); err != nil {
-			// if error return no results and an error
-			return nil, fmt.Errorf("error scanning period: %w", err)
+// Build the connection string of a database as a sqlserver:// URL, the URL escapes user and password so any
+// character in them reaches the driver as is; "host\instance" and "host,port" server names map onto the URL
+func connectionString(dbCfg DatabaseConfig) string {
+	host, instance, _ := strings.Cut(dbCfg.Server, `\`)
+	if name, port, ok := strings.Cut(host, ","); ok {
+		host = net.JoinHostPort(strings.TrimSpace(name), strings.TrimSpace(port))
+	}
+	u := url.URL{Scheme: "sqlserver", Host: host}
+	if instance != "" {
+		u.Path = "/" + instance
+	}
+	query := url.Values{}
+	query.Set("database", dbCfg.Database)
+	if dbCfg.ApplicationIntent != "" {
+		query.Set("ApplicationIntent", dbCfg.ApplicationIntent)
+	}
+	if dbCfg.ApplicationName != "" {
+		query.Set("app name", dbCfg.ApplicationName)
+	}
+	// without a user the driver logs in with integrated security
+	if !dbCfg.IntegratedSecurity {
+		username, password := dbCfg.Username, string(dbCfg.Password)
+		if username == "" {
+			username = os.Getenv("PRICINGPERIODS_DB_USER")
+		}
+		if password == "" {
+			password = os.Getenv("PRICINGPERIODS_DB_PASSWORD")
 		}
-		periods = append(periods, p)
+		u.User = url.UserPassword(username, password)
 	}
-	// if error reading rows
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error reading rows: %w", err)
+	if dbCfg.Encrypt != "" {
+		query.Set("encrypt", dbCfg.Encrypt)
 	}
-	// return slice of Period objects and no error
-	return periods, nil
+	if dbCfg.TrustServerCertificate {
+		query.Set("TrustServerCertificate", "true")
+	}
+	if dbCfg.ConnectTimeoutSeconds > 0 {
+		query.Set("dial timeout", strconv.Itoa(dbCfg.ConnectTimeoutSeconds))
+		query.Set("connection timeout", strconv.Itoa(dbCfg.ConnectTimeoutSeconds))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
 }
 
-func logRecordset(periods []Period, config *Config) error {
-	// open log file in append mode (or create it if does not exist)
-	file, err := os.OpenFile(config.Logging.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// Replace the password of a connection string URL
+func redactPassword(connStr string) string {
+	u, err := url.Parse(connStr)
 	if err != nil {
-		err = fmt.Errorf("error opening log file: %v", err)
-		return err
+		return "(invalid connection string)"
 	}
-	defer file.Close()
-	var totalPeriodsLogged int
-	// datetime format to be used for timestamps
-	timestampFormat := "2006-01-02 15:04:05"
-	// write all fetched periods to log file like there is no tomorrow
-	for count, period := range periods {
-		timestamp := time.Now().Format(timestampFormat)
-		logEntry := fmt.Sprintf("%s - Period %v to %v, Prodnum: %d, Price %.2f, Priority %d\n",
-			timestamp,
-			period.PeriodStart.Format("2006-01-02"),
-			period.PeriodEnd.Format("2006-01-02"),
-			period.ProdNum, period.Price, period.PeriodPriority)
-		_, err := file.WriteString(logEntry)
-		if err != nil {
-			fmt.Printf("error writing to file: %v\n", err)
-			continue
-		}
-		totalPeriodsLogged = count + 1
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
 	}
-	fmt.Printf("All periods logged correctly.\nPeriods logged: %v\n", totalPeriodsLogged)
-	return nil
+	return u.String()
+}
+
+// Connect to the dabatase
+func connectDB(ctx context.Context, dbCfg DatabaseConfig) (*sql.DB, error) {
+	connStr := connectionString(dbCfg)
+	// debug mode: log connection string, without the password
+	slog.Debug("connecting", "connectionString", redactPassword(connStr))
+	// open connection
+	db, err := sql.Open("mssql", connStr)
+	// check for error
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the database: %w", err)
+	}
+	maxOpen, maxIdle, maxLifetime := defaultMaxOpenConns, defaultMaxIdleConns, defaultConnMaxLifetime
+	if dbCfg.MaxOpenConns > 0 {
+		maxOpen = dbCfg.MaxOpenConns
+	}
+	if dbCfg.MaxIdleConns > 0 {
+		maxIdle = dbCfg.MaxIdleConns
+	}
+	if dbCfg.ConnMaxLifetimeSeconds > 0 {
+		maxLifetime = time.Duration(dbCfg.ConnMaxLifetimeSeconds) * time.Second
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(min(maxIdle, maxOpen))
+	db.SetConnMaxLifetime(maxLifetime)
+	// sql.Open does not connect, ping so an unreachable server fails here, within the connect timeout when set
+	if err := pingWithRetry(ctx, dbCfg, db.PingContext); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to the database %s: %w", dbCfg.Server, err)
+	}
+	// return db object and no error
+	return db, nil
 }
 
-func SortPeriods(periods []Period) {
-	sort.Slice(periods, func(i, j int) bool {
-		if periods[i].ProdNum != periods[j].ProdNum {
-			return periods[i].ProdNum < periods[j].ProdNum
+// Ping until the server answers, retrying transient failures with backoff,
+// each attempt gets its own connect timeout
+func pingWithRetry(ctx context.Context, dbCfg DatabaseConfig, ping func(context.Context) error) error {
+	attempt := 0
+	baseDelay := time.Duration(dbCfg.RetryBaseDelayMs) * time.Millisecond
+	return retryWithBackoff(ctx, dbCfg.RetryAttempts, baseDelay, func() error {
+		attempt++
+		slog.Debug("connecting to the database", "server", dbCfg.Server, "attempt", attempt)
+		attemptCtx := ctx
+		if dbCfg.ConnectTimeoutSeconds > 0 {
+			var cancel context.CancelFunc
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(dbCfg.ConnectTimeoutSeconds)*time.Second)
+			defer cancel()
 		}
-		if periods[i].PeriodStart != periods[j].PeriodStart {
-			return periods[i].PeriodStart.Before(periods[j].PeriodStart)
+		err := ping(attemptCtx)
+		if err == nil {
+			return nil
 		}
-		if periods[i].PeriodPriority != periods[j].PeriodPriority {
-			return periods[i].PeriodPriority < periods[j].PeriodPriority
+		err = timeoutError(attemptCtx, err)
+		// a cancelled run is not retried, nor is a server error such as a failed login
+		if ctx.Err() != nil || !isTransientDBError(err) {
+			return permanentError{err}
 		}
-		return true
+		return err
 	})
 }
 
-func ProcessPeriods(periods []Period, debugMode bool) []Period {
+// Network and timeout failures, which a failover or a busy server can cause, as opposed to
+// login, permission and configuration errors the server reports
+func isTransientDBError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// the driver reports dial failures as plain text
+	return strings.Contains(err.Error(), "unable to open tcp connection")
+}
 
-	SortPeriods(periods)
+// Context of one query, bounded by the configured query timeout
+func (c *Config) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Database.QueryTimeoutSeconds > 0 {
+		return context.WithTimeout(ctx, time.Duration(c.Database.QueryTimeoutSeconds)*time.Second)
+	}
+	return context.WithCancel(ctx)
+}
 
-	for i := 0; i < len(periods)-1; i++ {
-		current := periods[i]
-		next := periods[i+1]
-		periodsOverlap := current.PeriodEnd.After(next.PeriodStart)
-		currentPeriodOfLowerPriority := current.PeriodPriority > next.PeriodPriority
-		periodEndsAfterNext := current.PeriodEnd.After(next.PeriodEnd)
-		samePeriodEnd := current.PeriodEnd.Equal(next.PeriodEnd)
+// Wrap a db error with the context error when the context ended, so timeouts
+// match context.DeadlineExceeded whatever error the driver returned
+func timeoutError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
+}
 
-		if current.ProdNum != next.ProdNum {
-			// skip if two neighbouring entries are from different product
-			continue
-		}
-		if debugMode {
-			fmt.Printf("\n\nCurrent period: prodnum %v starts %s ends %s priority %v\nNext period: prodnum %v starts %s ends %s priority %v\n",
-				current.ProdNum, current.PeriodStart.Format("2006-01-02"), current.PeriodEnd.Format("2006-01-02"), current.PeriodPriority,
-				next.ProdNum, next.PeriodStart.Format("2006-01-02"), next.PeriodEnd.Format("2006-01-02"), next.PeriodPriority)
-		}
-		if !periodsOverlap {
-			if debugMode {
-				fmt.Printf("  No overlap between current (ends on %s) and next period (starts on %s)\n", current.PeriodEnd.Format("2006-01-02"), next.PeriodStart.Format("2006-01-02"))
-			}
-			// if no overlap, move to next item
-			continue
+// query already loaded during this run, with the file modtime it was read at
+type cachedQuery struct {
+	query   string
+	modTime time.Time
+}
+
+// queries already loaded during this run, keyed by path or URL
+var (
+	queryCache   = map[string]cachedQuery{}
+	queryCacheMu sync.Mutex
+)
+
+// Load the sql query inline from config, or else from a local file or from an http(s) URL
+func loadQuery(config *Config) (string, error) {
+	if config.Query != "" {
+		return config.Query, nil
+	}
+	if config.QueryPath == "" {
+		return "", errors.New("no query configured: set query or queryPath")
+	}
+	queryCacheMu.Lock()
+	defer queryCacheMu.Unlock()
+	path := config.QueryPath
+	cached, isCached := queryCache[path]
+	// non URL paths are read from local file, and re-read only when the file changed
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read query from file: %w", err)
 		}
-		// current period ends ater next one starts = OVERLAP
-		if debugMode {
-			fmt.Printf("  Overlap detected between current (ends on %s) and next period (starts on %s)\n", current.PeriodEnd.Format("2006-01-02"), next.PeriodStart.Format("2006-01-02"))
+		if isCached && info.ModTime().Equal(cached.modTime) {
+			return cached.query, nil
 		}
-		if currentPeriodOfLowerPriority {
-			// current period is of lower priority (bigger number)
-			if debugMode {
-				fmt.Printf("  Current period has lower priority (%v) and next period has higher priority (%v)\n", current.PeriodPriority, next.PeriodPriority)
-			}
-			if periodEndsAfterNext {
-				// current period of lower priority ends after the next one = SPLIT current period
-				if debugMode {
-					fmt.Printf("  Current period ends (%s) after the next period ends (%s)\n", current.PeriodEnd.Format("2006-01-02"), next.PeriodEnd.Format("2006-01-02"))
-				}
-				// need to split the longer lower priority period into two,
-				// one that ends before the higher priority starts,
-				// and one that starts after the shorter higher priority period ends
-				// new period:
-				splitPeriod := Period{
-					ID:             current.ID,
-					PeriodStart:    next.PeriodEnd.Add(time.Hour * 24), // split period starts day after the next periods ends
-					PeriodEnd:      current.PeriodEnd,
-					Price:          current.Price,
-					ProdNum:        current.ProdNum,
-					PeriodPriority: current.PeriodPriority,
-				}
-				if debugMode {
-					fmt.Printf("  Adding a split period that starts on %s and ends on %s with priority %v, after the next period ends (%s)\n",
-						splitPeriod.PeriodStart.Format("2006-01-02"), splitPeriod.PeriodEnd.Format("2006-01-02"), splitPeriod.PeriodPriority, next.PeriodEnd.Format("2006-01-02"))
-				}
-				// add the split period to processed array just after the next (i+1) period which is i+2
-				periods = slices.Insert(periods, i+2, splitPeriod)
-				// existing period adjusted:
-				current.PeriodEnd = next.PeriodStart.Add(-time.Hour * 24) // adjust current periods end to day before next one starts
-				if debugMode {
-					fmt.Printf("  Adjusting current period to end on %s with priority %v, after the next period starts (%s)\n",
-						current.PeriodEnd.Format("2006-01-02"), current.PeriodPriority, next.PeriodStart.Format("2006-01-02"))
-				}
-				periods[i] = current // update in the array
-			} else {
-				if debugMode {
-					fmt.Printf("  Current period ends (%s) before the next period ends (%s)\n", current.PeriodEnd.Format("2006-01-02"), next.PeriodEnd.Format("2006-01-02"))
-				}
-				// lower priority period that started earlier, needs to end before the higher priority period starts
-				current.PeriodEnd = next.PeriodStart.Add(-time.Hour * 24) // adjust current periods end to day before next one starts
-				if debugMode {
-					fmt.Printf("  Adjusting current period to end on %s with priority %v, after the next period starts (%s)\n",
-						current.PeriodEnd.Format("2006-01-02"), current.PeriodPriority, next.PeriodStart.Format("2006-01-02"))
-				}
-				periods[i] = current // update in the array
-			}
-		} else {
-			if debugMode {
-				fmt.Println("  Current period has higher priority and next period has lower priority")
-			}
-			if periodEndsAfterNext || samePeriodEnd {
-				if debugMode {
-					fmt.Println("  Current period ends after the next period ends. Next period will be removed")
-				}
-				// remove the lower priority next period entirely since the period with higher priority encompases the its entirety
-				// next = i+1
-				periods[i+1] = periods[len(periods)-1] // replace next period with last period in array
-				periods = periods[:len(periods)-1]     // replace array with its subset without the last element
-				if debugMode {
-					fmt.Print("  Removed entirely reduced period")
-					fmt.Println(next)
-				}
-			} else {
-				// if current higher priority period ends before the next one:
-				next.PeriodStart = current.PeriodEnd.Add(time.Hour * 24) // we adjust the next one to start after it
-				if debugMode {
-					fmt.Printf("  Adjusting next period to start on %s with priority %v, after the current period ends (%s)\n",
-						next.PeriodStart.Format("2006-01-02"), next.PeriodPriority, current.PeriodEnd.Format("2006-01-02"))
-				}
-				periods[i+1] = next // update in the array
-			}
+		query, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read query from file: %w", err)
 		}
-		if debugMode {
-			fmt.Println("* * * Resorting all results  * * *")
+		if isCached {
+			slog.Info("query file changed, reloaded", "path", path)
 		}
-		SortPeriods(periods)
+		queryCache[path] = cachedQuery{query: string(query), modTime: info.ModTime()}
+		return string(query), nil
+	}
+	// urls are fetched once per run
+	if isCached {
+		return cached.query, nil
+	}
+	// default timeout if not set in config
+	timeout := 30 * time.Second
+	if config.QueryURL.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.QueryURL.TimeoutSeconds) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build query request: %w", err)
+	}
+	// optional auth header from config
+	if config.QueryURL.AuthHeader != "" {
+		req.Header.Set("Authorization", string(config.QueryURL.AuthHeader))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch query from url: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch query from url: unexpected status %s", resp.Status)
+	}
+	query, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read query from url: %w", err)
 	}
-	return periods
+	queryCache[path] = cachedQuery{query: string(query)}
+	return string(query), nil
 }
 
-func main() {
-	// execution flag "-dev" for development environment variables
-	devFlag := flag.Bool("dev", false, "Set to true to run in development mode.")
-	// execution flag "-dev" for development environment variables
-	prodFlag := flag.Bool("prod", false, "Set to true to run in development mode.")
-	// execution flag "-debug" for enhanced logging
-	debugFlag := flag.Bool("debug", false, "Set true to run in debug mode.")
-
-	flag.Parse()
+// Location period boundaries are normalized to, UTC when not configured
+func (c *Config) location() (*time.Location, error) {
+	loc, err := time.LoadLocation(c.Processing.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("processing.timeZone %q: %w", c.Processing.TimeZone, err)
+	}
+	return loc, nil
+}
 
-	if !*devFlag && !*prodFlag {
-		log.Fatal("No environment flag was set (-dev or -prod)")
+// Step between adjacent periods, a day when not configured
+func (c *Config) granularity() (periods.Granularity, error) {
+	if c.Processing.Granularity == "" {
+		return periods.Day, nil
 	}
+	granularity, err := periods.ParseGranularity(c.Processing.Granularity)
+	if err != nil {
+		return periods.Granularity{}, fmt.Errorf("processing.granularity: %w", err)
+	}
+	return granularity, nil
+}
 
-	var envConfig string
+// Period end dates are inclusive unless the interval mode is halfOpen, as they were before the mode was configurable
+func (c *Config) closedIntervals() bool {
+	return c.Processing.IntervalMode != "halfOpen"
+}
 
-	// add correct env flag
-	if *devFlag {
-		fmt.Println("Running in development mode")
-		envConfig = DEV_CONFIG
+// Granule grid of the configured processing (granularity, day anchor and interval mode) scanned boundaries are aligned to
+func (c *Config) boundaryGrid() (periods.ProcessOptions, error) {
+	grid := periods.ProcessOptions{ClosedIntervals: c.closedIntervals()}
+	var err error
+	if grid.Granularity, err = c.granularity(); err != nil {
+		return grid, err
 	}
-	if *prodFlag {
-		fmt.Println("Running in production mode")
-		envConfig = PROD_CONFIG
+	if c.Processing.DayAnchor != "" {
+		if grid.DayAnchor, err = periods.ParseDayAnchor(c.Processing.DayAnchor); err != nil {
+			return grid, fmt.Errorf("processing.dayAnchor: %w", err)
+		}
 	}
+	return grid, nil
+}
 
-	// load correct environment config variables
-	config, err := readConfig(envConfig)
-	if err != nil {
-		log.Fatal("Config error: ", err)
+// Apply the client specific normalization to resolved periods: boundaries snapped to months, then the granules
+// no period prices filled when configured; returns the gaps found either way
+func normalizeResolved(resolved []periods.Period, config *Config, opts periods.ProcessOptions) ([]periods.Period, []periods.Gap) {
+	if config.Processing.SnapBoundariesTo == "month" {
+		resolved = snapBoundariesToMonth(resolved, opts.ClosedIntervals)
 	}
-
-	// update dev flag to config object if set when executing
-	config.Logging.DebugMode = *debugFlag
-	// debug mode: log config object
-	if config.Logging.DebugMode {
-		fmt.Println(config)
+	gaps := periods.FindGaps(resolved, opts)
+	if len(gaps) > 0 && config.Processing.FillGaps != "" {
+		resolved = periods.FillGaps(resolved, gaps, config.Processing.FillGaps, config.Processing.GapPrice, opts)
 	}
+	return resolved, gaps
+}
 
-	// connect to db
-	db, err := connectDB(*config)
-	if err != nil {
-		log.Fatal("Database connection error: ", err)
-	} else if config.Logging.DebugMode {
-		// debug mode: log successfull connections with params
-		fmt.Printf("Connected successfully to server %s, database name %s.\n", config.Database.Server, config.Database.Database)
+// Set the configured resolver and resolution rule on opts, which are not part of a recorded run's options,
+// a custom rule overrides the strategy
+func (c *Config) resolution(opts *periods.ProcessOptions) error {
+	var err error
+	if opts.Resolver, err = periods.ResolverByName(c.Processing.Resolver); err != nil {
+		return err
 	}
-	defer db.Close() // defer close connection to end of program
-
-	// fetch data
-	periods, err := fetchPeriods(db, config)
-	if err != nil {
-		log.Fatalf("Failed to fetch periods from the database: %v", err)
+	if opts.ResolutionRule, err = periods.ResolutionRuleByName(c.Processing.ResolutionStrategy, *opts); err != nil {
+		return err
+	}
+	if c.Processing.ResolutionRule != "" {
+		if opts.ResolutionRule, err = periods.CompileResolutionRule(c.Processing.ResolutionRule); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// log to file: log fetched data
-	if config.Logging.LogDbResultsToFile {
-		logRecordset(periods, config)
+// Query date window as @from and @to parameter values, nil for a bound that is not set
+func (c *Config) queryWindow() (from, to any, err error) {
+	var dates [2]time.Time
+	for i, value := range []string{c.QueryFrom, c.QueryTo} {
+		if value == "" {
+			continue
+		}
+		if dates[i], err = time.Parse("2006-01-02", value); err != nil {
+			return nil, nil, fmt.Errorf("query window date %q is not a YYYY-MM-DD date", value)
+		}
+	}
+	if c.QueryFrom != "" {
+		from = dates[0]
+	}
+	if c.QueryTo != "" {
+		to = dates[1]
+		if dates[1].Before(dates[0]) {
+			return nil, nil, fmt.Errorf("query window from %s is after to %s", c.QueryFrom, c.QueryTo)
+		}
 	}
+	return from, to, nil
+}
 
-	// process data
-	flattenedPeriods := ProcessPeriods(periods, config.Logging.DebugMode)
+// runs read queries, satisfied by *sql.DB, *sql.Conn and *sql.Tx, or a fake returning canned rows
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
 
-	// log to file: log fetched data
-	if config.Logging.LogProcessedResultsToFile {
-		logRecordset(flattenedPeriods, config)
+// Named parameters a query may reference, matched as whole identifiers so @to does not match @today
+var (
+	asOfDateParam = regexp.MustCompile(`@AsOfDate\b`)
+	fromParam     = regexp.MustCompile(`@from\b`)
+	toParam       = regexp.MustCompile(`@to\b`)
+)
+
+// Values bound to the parameters a query references: the as-of date and the query window bounds
+func queryArgs(query string, config *Config) ([]any, error) {
+	// templated queries get the as-of date as @AsOfDate
+	var args []any
+	if asOfDateParam.MatchString(query) {
+		args = append(args, sql.Named("AsOfDate", config.Processing.AsOfDate.Time))
+	}
+	// date window bounds for queries that reference them
+	from, to, err := config.queryWindow()
+	if err != nil {
+		return nil, err
+	}
+	if fromParam.MatchString(query) {
+		args = append(args, sql.Named("from", from))
+	}
+	if toParam.MatchString(query) {
+		args = append(args, sql.Named("to", to))
+	}
+	return args, nil
+}
+
+// Print the final query with the values bound to its parameters; the run scope (-prodnums, -since)
+// is not part of the query, it is applied to the periods after the fetch
+func printQuery(w io.Writer, config *Config, scope runScope) error {
+	query, err := loadQuery(config)
+	if err != nil {
+		return err
+	}
+	args, err := queryArgs(query, config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Query:\n%s\n", query)
+	for _, arg := range args {
+		named := arg.(sql.NamedArg)
+		value := "NULL"
+		if t, ok := named.Value.(time.Time); ok {
+			value = t.Format(time.DateOnly)
+		}
+		fmt.Fprintf(w, "@%s = %s\n", named.Name, value)
+	}
+	if len(scope.ProdNums) > 0 {
+		prodNums := make([]int, 0, len(scope.ProdNums))
+		for prodNum := range scope.ProdNums {
+			prodNums = append(prodNums, prodNum)
+		}
+		slices.Sort(prodNums)
+		list := make([]string, len(prodNums))
+		for i, prodNum := range prodNums {
+			list[i] = strconv.Itoa(prodNum)
+		}
+		fmt.Fprintf(w, "Applied after the fetch: only prodnums %s\n", strings.Join(list, ", "))
+	}
+	if !scope.Since.IsZero() {
+		fmt.Fprintf(w, "Applied after the fetch: only periods ending on or after %s\n", scope.Since.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// Load and execute the periods query
+func queryPeriods(ctx context.Context, db Querier, config *Config) (*sql.Rows, error) {
+	// read sql query from config, file or url
+	query, err := loadQuery(config)
+	if err != nil {
+		return nil, err
+	}
+	// debug mode: log query as loaded
+	slog.Debug("loaded query", "query", query, "inline", config.Query != "")
+
+	args, err := queryArgs(query, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.QueryFrom != "" && !fromParam.MatchString(query) {
+		slog.Warn("query window set but not referenced by the query", "param", "@from", "value", config.QueryFrom)
+	}
+	if config.QueryTo != "" && !toParam.MatchString(query) {
+		slog.Warn("query window set but not referenced by the query", "param", "@to", "value", config.QueryTo)
+	}
+	// execute sql query
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", timeoutError(ctx, err))
+	}
+	return rows, nil
+}
+
+// scans rows into periods, optional columns are detected once from the result set
+type periodScanner struct {
+	rows *sql.Rows
+	// destination per result column, nil for legacy positional scanning
+	named []string
+	// priority of periods when the result set has no PeriodPriority column
+	defaultPriority int
+	hasMetadata     bool
+	// location boundaries are normalized to, UTC when nil
+	location *time.Location
+	// granule grid boundaries are aligned to
+	grid periods.ProcessOptions
+}
+
+// period columns a query may return by name, price and priority are optional
+var periodColumns = []string{"ID", "PeriodStart", "PeriodEnd", "Price", "ProdNum", "PeriodPriority", "Metadata"}
+
+// Scanner of rows into periods in the time zone and granule grid of the config
+func newPeriodScanner(rows *sql.Rows, config *Config, defaultPriority int) (*periodScanner, error) {
+	loc, err := config.location()
+	if err != nil {
+		return nil, err
+	}
+	grid, err := config.boundaryGrid()
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns: %w", err)
+	}
+	s := &periodScanner{rows: rows, defaultPriority: defaultPriority, location: loc, grid: grid}
+	// columns named after the period fields are matched by name, in any order
+	named := make([]string, len(columns))
+	present := make(map[string]bool)
+	for i, column := range columns {
+		for _, name := range periodColumns {
+			if strings.EqualFold(column, name) {
+				named[i] = name
+				present[name] = true
+			}
+		}
+	}
+	if present["ID"] && present["PeriodStart"] && present["PeriodEnd"] && present["ProdNum"] {
+		s.named = named
+		return s, nil
+	}
+	if len(columns) < 6 {
+		return nil, fmt.Errorf("query returned %d columns: expected ID, PeriodStart, PeriodEnd and ProdNum by name, or the six period columns in order", len(columns))
+	}
+	// optional JSON metadata column after the six period columns
+	s.hasMetadata = len(columns) > 6 && strings.EqualFold(columns[6], "Metadata")
+	return s, nil
+}
+
+// end of an open-ended period, a NULL PeriodEnd is read as this date so it outlasts every dated period
+// in overlap resolution, and is written back as NULL
+var openPeriodEnd = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Scan current row into a Period, NULL end dates are open ends and NULL priorities take the default priority
+func (s *periodScanner) scan() (periods.Period, error) {
+	var p periods.Period
+	var end sql.NullTime
+	// decimal and money prices are read as exact text, not through float
+	var price sql.Null[periods.Price]
+	var priority sql.NullInt64
+	var metadata sql.NullString
+	var dest []any
+	if s.named != nil {
+		// missing price defaults to 0, missing priority to the configured default
+		price.Valid = true
+		fields := map[string]any{
+			"ID":             &p.ID,
+			"PeriodStart":    &p.PeriodStart,
+			"PeriodEnd":      &end,
+			"Price":          &price,
+			"ProdNum":        &p.ProdNum,
+			"PeriodPriority": &priority,
+			"Metadata":       &metadata,
+		}
+		dest = make([]any, len(s.named))
+		for i, name := range s.named {
+			if name == "" {
+				// unknown column, read and dropped
+				dest[i] = new(any)
+				continue
+			}
+			dest[i] = fields[name]
+		}
+	} else {
+		// Scan field order must match sql query field order
+		dest = []any{
+			&p.ID,
+			&p.PeriodStart,
+			&end,
+			&price,
+			&p.ProdNum,
+			&priority}
+		if s.hasMetadata {
+			dest = append(dest, &metadata)
+		}
+	}
+	if err := s.rows.Scan(dest...); err != nil {
+		return periods.Period{}, fmt.Errorf("error scanning period: %w", err)
+	}
+	p.PeriodEnd = openPeriodEnd
+	if end.Valid {
+		p.PeriodEnd = end.Time
+	}
+	p.Price = price.V
+	p.PriceNull = !price.Valid
+	p.PeriodPriority = s.defaultPriority
+	if priority.Valid {
+		p.PeriodPriority = int(priority.Int64)
+	}
+	if metadata.Valid && metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &p.Metadata); err != nil {
+			return periods.Period{}, fmt.Errorf("error parsing metadata of period %d: %w", p.ID, err)
+		}
+	}
+	// datetime2 carries sub-second precision and feeds may carry times within a granule, align boundaries
+	// to whole granules so boundaries in the same granule compare as equal in overlap checks and shifts
+	p.PeriodStart = periods.GranuleStart(inLocation(p.PeriodStart, s.location), s.grid)
+	if end.Valid {
+		p.PeriodEnd = periods.GranuleEnd(inLocation(p.PeriodEnd, s.location), s.grid)
+	}
+	return p, nil
+}
+
+// Normalize a scanned time to loc: datetime and datetime2 values carry no zone and come back
+// from the driver as UTC, their wall clock is read as a time in loc, datetimeoffset values are converted
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	if t.Location() == time.UTC {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+	return t.In(loc)
+}
+
+// Resolve NULL prices per policy: "error" (default), "skip", "zero" or "carry-forward"
+// (use the price of the previous period of the same product)
+func applyNullPricePolicy(fetched []periods.Period, policy string) ([]periods.Period, error) {
+	if policy == "carry-forward" {
+		periods.SortPeriods(fetched)
+	}
+	resolved := fetched[:0]
+	for i, p := range fetched {
+		if !p.PriceNull {
+			resolved = append(resolved, p)
+			continue
+		}
+		switch policy {
+		case "", "error":
+			return nil, fmt.Errorf("period id %d (prodnum %d) has a NULL price", p.ID, p.ProdNum)
+		case "skip":
+			slog.Warn("null price, skipping period", "policy", policy, "id", p.ID, "prodnum", p.ProdNum)
+			continue
+		case "zero":
+			slog.Warn("null price, setting it to 0", "policy", policy, "id", p.ID, "prodnum", p.ProdNum)
+		case "carry-forward":
+			// resolved prices carry over chains of NULL periods
+			if len(resolved) == 0 || resolved[len(resolved)-1].ProdNum != p.ProdNum {
+				slog.Warn("null price with no earlier price to carry forward, skipping period", "policy", policy, "id", p.ID, "prodnum", p.ProdNum)
+				continue
+			}
+			p.Price = resolved[len(resolved)-1].Price
+			slog.Info("null price, carrying forward the earlier price", "policy", policy, "id", p.ID, "prodnum", p.ProdNum, "price", p.Price)
+		default:
+			return nil, fmt.Errorf("unknown null price policy %q at period index %d", policy, i)
+		}
+		p.PriceNull = false
+		resolved = append(resolved, p)
+	}
+	return resolved, nil
+}
+
+// Check the safety cap on number of fetched rows, unless explicitly overriden
+func checkMaxRows(config *Config, count int) error {
+	if config.Processing.MaxRows > 0 && !config.Processing.AllowLarge && count >= config.Processing.MaxRows {
+		return fmt.Errorf("query returned more than %d rows (maxRows), use -allow-large to override", config.Processing.MaxRows)
+	}
+	return nil
+}
+
+func fetchPeriods(ctx context.Context, db Querier, config *Config) ([]periods.Period, error) {
+	ctx, cancel := config.queryContext(ctx)
+	defer cancel()
+	rows, err := queryPeriods(ctx, db, config)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // close rows after processing
+
+	scanner, err := newPeriodScanner(rows, config, config.Processing.DefaultPriority)
+	if err != nil {
+		return nil, err
+	}
+
+	// results read from db will be stored in the slice of Period objects
+	var fetched []periods.Period
+
+	for rows.Next() {
+		// abort once safety cap is hit
+		if err := checkMaxRows(config, len(fetched)); err != nil {
+			return nil, err
+		}
+		p, err := scanner.scan() // scan each rows into Period struct
+		if err != nil {
+			// if error return no results and an error
+			return nil, err
+		}
+		fetched = append(fetched, p)
+	}
+	// if error reading rows
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rows: %w", timeoutError(ctx, err))
+	}
+	// return slice of Period objects and no error
+	return applyNullPricePolicy(fetched, config.Processing.NullPricePolicy)
+}
+
+// Fetch periods from every configured source, tagging each period with its source name
+func fetchSources(ctx context.Context, db Querier, config *Config) ([]periods.Period, error) {
+	var fetched []periods.Period
+	for _, source := range config.Sources {
+		sourceConfig := *config
+		sourceConfig.Query, sourceConfig.QueryPath = "", source.QueryPath
+		sourcePeriods, err := fetchPeriods(ctx, db, &sourceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+		for i := range sourcePeriods {
+			sourcePeriods[i].Source = source.Name
+		}
+		slog.Debug("fetched source", "source", source.Name, "periods", len(sourcePeriods))
+		fetched = append(fetched, sourcePeriods...)
+	}
+	return fetched, nil
+}
+
+// Fetch periods from a query ordered by ProdNum and hand each product's periods
+// to process as soon as the product is complete, so only one product is kept in memory
+func fetchPeriodsByProduct(ctx context.Context, db Querier, config *Config, process func(product []periods.Period) error) error {
+	// the query timeout bounds the whole stream, processing included
+	ctx, cancel := config.queryContext(ctx)
+	defer cancel()
+	rows, err := queryPeriods(ctx, db, config)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // close rows after processing
+
+	scanner, err := newPeriodScanner(rows, config, config.Processing.DefaultPriority)
+	if err != nil {
+		return err
+	}
+
+	var product []periods.Period
+	var total, products int
+	for rows.Next() {
+		// abort once safety cap is hit
+		if err := checkMaxRows(config, total); err != nil {
+			return err
+		}
+		p, err := scanner.scan()
+		if err != nil {
+			return err
+		}
+		total++
+		if len(product) > 0 && p.ProdNum != product[0].ProdNum {
+			// products must arrive in order, otherwise a product could be split across groups
+			if p.ProdNum < product[0].ProdNum {
+				return fmt.Errorf("query is not ordered by ProdNum: prodnum %d returned after %d", p.ProdNum, product[0].ProdNum)
+			}
+			// product changed: flush previous product
+			if product, err = applyNullPricePolicy(product, config.Processing.NullPricePolicy); err != nil {
+				return err
+			}
+			if err := process(product); err != nil {
+				return err
+			}
+			products++
+			if config.Processing.LowMemory {
+				// reuse the buffer for the next product, process must not keep a reference to it
+				product = product[:0]
+				if config.Processing.FreeOSMemoryEvery > 0 && products%config.Processing.FreeOSMemoryEvery == 0 {
+					debug.FreeOSMemory()
+				}
+			} else {
+				product = nil
+			}
+		}
+		product = append(product, p)
+	}
+	// if error reading rows
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error reading rows: %w", timeoutError(ctx, err))
+	}
+	// flush last product
+	if len(product) > 0 {
+		if product, err = applyNullPricePolicy(product, config.Processing.NullPricePolicy); err != nil {
+			return err
+		}
+		return process(product)
+	}
+	return nil
+}
+
+// Format a period log entry as "text" (default), "kv" (key=value pairs) or "json", boundaries in the given layout
+func formatLogEntry(format, timestamp, action, layout string, period periods.Period) (string, error) {
+	start := period.PeriodStart.Format(layout)
+	end := period.PeriodEnd.Format(layout)
+	switch format {
+	case "", "text":
+		return fmt.Sprintf("%s - Period %v to %v, Prodnum: %d, Price %v, Priority %d\n",
+			timestamp, start, end, period.ProdNum, period.Price, period.PeriodPriority), nil
+	case "kv":
+		return fmt.Sprintf("time=%q action=%s product=%d start=%s end=%s price=%v priority=%d\n",
+			timestamp, action, period.ProdNum, start, end, period.Price, period.PeriodPriority), nil
+	case "json":
+		entry, err := json.Marshal(struct {
+			Time     string        `json:"time"`
+			Action   string        `json:"action"`
+			Product  int           `json:"product"`
+			Start    string        `json:"start"`
+			End      string        `json:"end"`
+			Price    periods.Price `json:"price"`
+			Priority int           `json:"priority"`
+		}{timestamp, action, period.ProdNum, start, end, period.Price, period.PeriodPriority})
+		if err != nil {
+			return "", err
+		}
+		return string(entry) + "\n", nil
+	}
+	return "", fmt.Errorf("unknown record format %q", format)
+}
+
+// Write periods as log entries in the given record format to a new file at path
+func writeLogOutput(list []periods.Period, path, recordFormat, layout string) error {
+	var out strings.Builder
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	for _, period := range list {
+		logEntry, err := formatLogEntry(recordFormat, timestamp, "processed", layout, period)
+		if err != nil {
+			return fmt.Errorf("error formatting log entry: %w", err)
+		}
+		out.WriteString(logEntry)
+	}
+	if err := os.WriteFile(path, []byte(out.String()), 0644); err != nil {
+		return fmt.Errorf("error writing log output: %w", err)
+	}
+	fmt.Printf("Periods written to %s: %v\n", path, len(list))
+	return nil
+}
+
+// logger for repeated processing runs whose decisions are not of interest
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// Path of the run log file: runLogPath, by default filePath with ".run" before its extension
+func (c *Config) runLogPath() string {
+	if c.Logging.RunLogPath != "" {
+		return c.Logging.RunLogPath
+	}
+	ext := filepath.Ext(c.Logging.FilePath)
+	return strings.TrimSuffix(c.Logging.FilePath, ext) + ".run" + ext
+}
+
+// Build the run logger per logging config, returning a func closing its log file
+func newLogger(config *Config) (*slog.Logger, func(), error) {
+	level := slog.LevelInfo
+	if config.Logging.DebugMode {
+		level = slog.LevelDebug
+	}
+	var w io.Writer = os.Stderr
+	closeLog := func() {}
+	if config.Logging.LogToFile {
+		file, err := openLogFile(config.runLogPath(), config.Logging.MaxLogSizeMB, config.Logging.MaxLogBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening log file: %w", err)
+		}
+		w = file
+		closeLog = func() { file.Close() }
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if config.Logging.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts)), closeLog, nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), closeLog, nil
+}
+
+// Append periods to the log file, action tells which stage they come from (fetched, processed)
+func logRecordset(logged []periods.Period, config *Config, action string) error {
+	// open log file in append mode (or create it if does not exist), rotating it first when too large
+	file, err := openLogFile(config.Logging.FilePath, config.Logging.MaxLogSizeMB, config.Logging.MaxLogBackups)
+	if err != nil {
+		err = fmt.Errorf("error opening log file: %v", err)
+		return err
+	}
+	defer file.Close()
+	granularity, err := config.granularity()
+	if err != nil {
+		return err
+	}
+	var totalPeriodsLogged int
+	var writeErrs []error
+	// datetime format to be used for timestamps
+	timestampFormat := "2006-01-02 15:04:05"
+	// write all fetched periods to log file like there is no tomorrow
+	for _, period := range logged {
+		timestamp := time.Now().Format(timestampFormat)
+		logEntry, err := formatLogEntry(config.Logging.RecordFormat, timestamp, action, boundaryLayout(granularity), period)
+		if err != nil {
+			return fmt.Errorf("error formatting log entry: %w", err)
+		}
+		_, err = file.WriteString(logEntry)
+		if err != nil {
+			slog.Warn("error writing to log file", "path", config.Logging.FilePath, "id", period.ID, "error", err)
+			writeErrs = append(writeErrs, err)
+			continue
+		}
+		totalPeriodsLogged++
+	}
+	if len(writeErrs) > 0 {
+		return fmt.Errorf("logged %d of %d periods: %w", totalPeriodsLogged, len(logged), errors.Join(writeErrs...))
+	}
+	slog.Info("all periods logged", "action", action, "periods", totalPeriodsLogged)
+	return nil
+}
+
+// Print number of input and output periods, in total and per product
+func printCounts(input, output []periods.Period) {
+	inputCounts := make(map[int]int)
+	outputCounts := make(map[int]int)
+	for _, p := range input {
+		inputCounts[p.ProdNum]++
+	}
+	for _, p := range output {
+		outputCounts[p.ProdNum]++
+	}
+	prodNums := make([]int, 0, len(inputCounts))
+	for prodNum := range inputCounts {
+		prodNums = append(prodNums, prodNum)
+	}
+	sort.Ints(prodNums)
+	fmt.Printf("Input periods: %d, output periods: %d, products: %d\n", len(input), len(output), len(prodNums))
+	for _, prodNum := range prodNums {
+		fmt.Printf("  Prodnum %d: input %d, output %d\n", prodNum, inputCounts[prodNum], outputCounts[prodNum])
+	}
+}
+
+// periods a run is limited to, zero values do not limit
+type runScope struct {
+	ProdNums map[int]bool
+	Since    time.Time
+}
+
+// Parse -prodnums (comma separated) and -since (YYYY-MM-DD) flags
+func parseScope(prodNums, since string) (runScope, error) {
+	var scope runScope
+	if prodNums != "" {
+		scope.ProdNums = make(map[int]bool)
+		for _, value := range strings.Split(prodNums, ",") {
+			prodNum, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return scope, fmt.Errorf("invalid prodnum %q: %w", value, err)
+			}
+			scope.ProdNums[prodNum] = true
+		}
+	}
+	if since != "" {
+		date, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return scope, fmt.Errorf("invalid since date %q: %w", since, err)
+		}
+		scope.Since = date
+	}
+	return scope, nil
+}
+
+// Check if the scope limits the run at all
+func (s runScope) limited() bool {
+	return len(s.ProdNums) > 0 || !s.Since.IsZero()
+}
+
+// Keep periods of the scoped products that end on or after the since date
+func (s runScope) filter(input []periods.Period) []periods.Period {
+	if !s.limited() {
+		return input
+	}
+	scoped := input[:0]
+	for _, p := range input {
+		if len(s.ProdNums) > 0 && !s.ProdNums[p.ProdNum] {
+			continue
+		}
+		if !s.Since.IsZero() && p.PeriodEnd.Before(s.Since) {
+			continue
+		}
+		scoped = append(scoped, p)
+	}
+	return scoped
+}
+
+// exit code of a run aborted by -max-runtime
+const exitTimedOut = 3
+
+// Report a run over its max runtime, true when the partial output is still to be written, otherwise
+// the run is to return and exit with exitTimedOut
+func reportTimeout(maxRuntime time.Duration, writePartial bool) bool {
+	if !writePartial {
+		log.Printf("Run exceeded max runtime of %v, aborting", maxRuntime)
+		return false
+	}
+	log.Printf("Run exceeded max runtime of %v, writing periods processed so far", maxRuntime)
+	return true
+}
+
+// Log unresolved conflicts of a processing run and drop them from the error unless the run aborts on them,
+// any other error is returned as is
+func checkConflicts(err error, abort bool) error {
+	var conflicts *periods.ConflictsError
+	if !errors.As(err, &conflicts) || abort {
+		return err
+	}
+	log.Printf("Processing left %v", conflicts)
+	return nil
+}
+
+// Keep only the first n periods (in output order) when sampling is requested,
+// the sample is a sorted copy and processed keeps all its periods in their order
+func samplePeriods(processed []periods.Period, n int) []periods.Period {
+	if n <= 0 || len(processed) <= n {
+		return processed
+	}
+	sample := slices.Clone(processed)
+	periods.SortPeriods(sample)
+	return sample[:n]
+}
+
+func main() {
+	// execution flag "-dev" for development environment variables
+	devFlag := flag.Bool("dev", false, "Set to true to run in development mode.")
+	// execution flag "-dev" for development environment variables
+	prodFlag := flag.Bool("prod", false, "Set to true to run in development mode.")
+	// execution flag "-config" for a config file of any environment, replacing -dev and -prod
+	configFlag := flag.String("config", "", "Path of the config file to load, overrides -dev and -prod.")
+	// execution flag "-debug" for enhanced logging
+	debugFlag := flag.Bool("debug", false, "Set true to run in debug mode.")
+	// execution flag "-output-sample" to only output the first N processed periods
+	outputSampleFlag := flag.Int("output-sample", 0, "Only output the first N processed periods (0 outputs all).")
+	// execution flag "-allow-large" to override the maxRows safety cap
+	allowLargeFlag := flag.Bool("allow-large", false, "Set true to fetch more rows than the maxRows safety cap.")
+	// execution flag "-verify" to fail the run when processed periods still overlap
+	verifyFlag := flag.Bool("verify", false, "Set true to fail the run when processed periods of a product still overlap.")
+	// execution flag "-strict" to abort on processing conflicts
+	strictFlag := flag.Bool("strict", false, "Set true to abort on processing conflicts instead of logging them.")
+	// execution flag "-validate-only" to only report data quality issues
+	validateOnlyFlag := flag.Bool("validate-only", false, "Set true to only validate fetched periods and print issue counts per rule as JSON.")
+	// execution flag "-record" to capture inputs and outputs of the run
+	recordFlag := flag.String("record", "", "Write a JSON record of the run (config, input and output periods) to this path.")
+	// execution flag "-replay" to re-run processing from a recorded run without the db
+	replayFlag := flag.String("replay", "", "Re-run processing from a JSON run record at this path.")
+	// execution flag "-print-query" to print the final sql query before running it
+	printQueryFlag := flag.Bool("print-query", false, "Set true to print the final sql query.")
+	// execution flag "-print-query-only" to print the final sql query and exit
+	printQueryOnlyFlag := flag.Bool("print-query-only", false, "Set true to print the final sql query and exit without running it.")
+	// execution flag "-output-hash" to print checksums of written output files
+	outputHashFlag := flag.Bool("output-hash", false, "Set true to print the SHA-256 checksum of each written output file.")
+	// execution flag "-sort-output-by-id" to output periods in ID order
+	sortOutputByIDFlag := flag.Bool("sort-output-by-id", false, "Set true to output periods in ascending ID order.")
+	// execution flag "-trace-product" to trace processing decisions for one product
+	traceProductFlag := flag.Int("trace-product", 0, "Trace processing decisions for this prodnum.")
+	// execution flag "-trace-dot" to write the product trace as a graphviz graph
+	traceDotFlag := flag.String("trace-dot", "trace.dot", "Path of the graphviz .dot file written for -trace-product.")
+	// execution flag "-count-only" to only report period counts
+	countOnlyFlag := flag.Bool("count-only", false, "Set true to only report input and output period counts, without writing any output.")
+	// execution flag "-serve" to serve runs over HTTP instead of running once
+	serveFlag := flag.Bool("serve", false, "Set true to serve on-demand runs over HTTP (POST /process, GET /healthz) instead of running once.")
+	// execution flag "-dryrun" to report what writing would change without writing
+	dryRunFlag := flag.Bool("dryrun", false, "Set true to run the full pipeline and print what writing would change compared to the input, without writing anything.")
+	// execution flag "-diff-against-db" to compare processed periods with the write table
+	diffAgainstDBFlag := flag.Bool("diff-against-db", false, "Set true to report how processed periods differ from those stored in writeTable, without writing.")
+	// execution flag "-validate-config" to only check the config file
+	validateConfigFlag := flag.Bool("validate-config", false, "Set true to only validate the config file and exit, without reading the query or connecting to the db.")
+	// execution flag "-explain-removal" to report which period caused each removal
+	explainRemovalFlag := flag.Bool("explain-removal", false, "Set true to write removals.json explaining which period and rule removed each period.")
+	// execution flag "-low-memory" to bound memory use on constrained machines
+	lowMemoryFlag := flag.Bool("low-memory", false, "Set true to stream and process one product at a time with bounded memory (slower), query must be ordered by ProdNum.")
+	// execution flag "-strict-dates" to reject periods with implausible dates
+	strictDatesFlag := flag.Bool("strict-dates", false, "Set true to fail on periods dated outside of the plausible range instead of skipping them.")
+	// execution flag "-diff" to export how processing changed each input period
+	diffFlag := flag.String("diff", "", "Write how processing changed each input period (unchanged, adjusted, split or removed) to this path, - prints it.")
+	// execution flag "-heatmap" to export how conflicted each product's source periods are
+	heatmapFlag := flag.String("heatmap", "", "Write overlap depth and overlapping pairs per product of the source periods to this path (.csv or .json).")
+	// execution flags "-prodnums" and "-since" to limit the run scope
+	prodNumsFlag := flag.String("prodnums", "", "Only process these comma separated prodnums.")
+	sinceFlag := flag.String("since", "", "Only process periods ending on or after this date (YYYY-MM-DD).")
+	// execution flag "-reprocess-all" to allow an unscoped run against the write table
+	reprocessAllFlag := flag.Bool("reprocess-all", false, "Set true to allow processing everything when a writeTable is configured, without -since or -prodnums.")
+	// execution flag "-shuffle-test" to self-check processing is independent of input order
+	shuffleTestFlag := flag.Int("shuffle-test", 0, "Self-check: process N shuffled copies of the input and report if outputs differ, without writing any output.")
+	// execution flag "-benchmark" to time the configured resolver on generated data
+	benchmarkFlag := flag.Bool("benchmark", false, "Set true to run the configured resolver on generated datasets of increasing size and print timings, without db access.")
+	// execution flag "-changed-prior" to export segments whose price changed since a prior run's timeline
+	changedPriorFlag := flag.String("changed-prior", "", "Prior run's timeline JSON; writes segments with a changed price to changed.json.")
+	// execution flag "-max-runtime" to bound the wall-clock time of the run
+	maxRuntimeFlag := flag.Duration("max-runtime", 0, "Abort the run with exit code 3 once it runs longer than this, e.g. 15m (0 means no limit).")
+	// execution flag "-from" to pass the start of the query range as @from
+	fromFlag := flag.String("from", "", "Pass this date (YYYY-MM-DD) to the query as @from, overrides queryFrom.")
+	// execution flag "-to" to pass the end of the query range as @to
+	toFlag := flag.String("to", "", "Pass this date (YYYY-MM-DD) to the query as @to, overrides queryTo.")
+	// execution flag "-query-url" to load the sql query from a URL instead of QueryPath
+	queryURLFlag := flag.String("query-url", "", "Load the sql query from this http(s) URL instead of queryPath.")
+
+	flag.Parse()
+	runStart := time.Now()
+	// exit code of a run ending without a fatal error, applied once all deferred cleanup ran
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// replay a recorded run, no config or db needed
+	if *replayFlag != "" {
+		record, err := readRunRecord(*replayFlag)
+		if err != nil {
+			log.Fatal("Replay error: ", err)
+		}
+		if _, err := replayRunRecord(record); err != nil {
+			log.Fatal("Replay error: ", err)
+		}
+		return
+	}
+
+	if *configFlag == "" && !*devFlag && !*prodFlag {
+		log.Fatal("No environment flag was set (-config, -dev or -prod)")
+	}
+
+	var envConfig string
+
+	// add correct env flag, -config bypasses the environment switch
+	if *devFlag && *configFlag == "" {
+		fmt.Println("Running in development mode")
+		envConfig = DEV_CONFIG
+	}
+	if *prodFlag && *configFlag == "" {
+		fmt.Println("Running in production mode")
+		envConfig = PROD_CONFIG
+	}
+
+	// load correct environment config variables, an explicit config file is used as is
+	configPath := *configFlag
+	var err error
+	if configPath != "" {
+		if _, err := os.Stat(configPath); err != nil {
+			log.Fatalf("Config error: config file %s not found: %v", configPath, err)
+		}
+	} else if configPath, err = findConfig(envConfig); err != nil {
+		log.Fatal("Config error: ", err)
+	}
+	config, err := readConfig(configPath)
+	if err != nil {
+		log.Fatal("Config error: ", err)
+	}
+	fmt.Printf("Loaded config from %s\n", configPath)
+
+	// query url flag overrides query and query path from config
+	if *queryURLFlag != "" {
+		config.Query, config.QueryPath = "", *queryURLFlag
+	}
+	// date window flags override the configured window
+	if *fromFlag != "" {
+		config.QueryFrom = *fromFlag
+	}
+	if *toFlag != "" {
+		config.QueryTo = *toFlag
+	}
+
+	// fail fast on an invalid config, listing every problem found
+	if err := errors.Join(config.Validate(), config.checkFiles()); err != nil {
+		fmt.Printf("Config %s is invalid:\n%v\n", configPath, err)
+		os.Exit(1)
+	}
+	// validate config only: no query or db access
+	if *validateConfigFlag {
+		fmt.Printf("Config %s is valid\n", configPath)
+		return
+	}
+
+	// update dev flag to config object if set when executing
+	config.Logging.DebugMode = *debugFlag
+	config.Processing.AllowLarge = *allowLargeFlag
+	if *lowMemoryFlag {
+		config.Processing.LowMemory = true
+		config.Processing.StreamByProduct = true
+	}
+	if _, err := parseIsolationLevel(config.Database.IsolationLevel); err != nil {
+		log.Fatal("Config error: ", err)
+	}
+	err = config.checkStreamOutputFlags(map[string]bool{
+		"-dryrun":          *dryRunFlag,
+		"-diff":            *diffFlag != "",
+		"-record":          *recordFlag != "",
+		"-count-only":      *countOnlyFlag,
+		"-diff-against-db": *diffAgainstDBFlag,
+	})
+	if err != nil {
+		log.Fatal("Config error: ", err)
+	}
+	// benchmark: generated data only, no db access
+	if *benchmarkFlag {
+		resolver, err := periods.ResolverByName(config.Processing.Resolver)
+		if err != nil {
+			log.Fatal("Config error: ", err)
+		}
+		opts := periods.ProcessOptions{ClosedIntervals: config.closedIntervals(), Resolver: resolver}
+		results, err := runBenchmark([]int{250, 500, 1000, 2000}, opts)
+		if err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+		printBenchmark(results)
+		return
+	}
+	scope, err := parseScope(*prodNumsFlag, *sinceFlag)
+	if err != nil {
+		log.Fatal("Scope error: ", err)
+	}
+	// safety interlock: a full run against the write table has to be asked for explicitly
+	if config.WriteTable != "" && !scope.limited() && !*reprocessAllFlag {
+		log.Fatalf("Refusing to process all periods against write table %s: pass -since or -prodnums to limit the run, or -reprocess-all to process everything", config.WriteTable)
+	}
+	// place all generated files under output dir
+	if config.Output.Dir != "" {
+		if err := os.MkdirAll(config.Output.Dir, 0755); err != nil {
+			log.Fatal("Output dir error: ", err)
+		}
+		config.Logging.FilePath = resolveOutputPath(config.Output.Dir, config.Logging.FilePath, "periods.log")
+		if config.Logging.RunLogPath != "" {
+			config.Logging.RunLogPath = resolveOutputPath(config.Output.Dir, config.Logging.RunLogPath, "")
+		}
+		if _, ok := fileWriters[config.Output.Format]; ok {
+			defaultName := "periods." + config.Output.Format
+			switch config.Output.Format {
+			case "timeline":
+				defaultName = "timeline.json"
+			case "log":
+				// periods.log is the default logging file
+				defaultName = "processed.log"
+			}
+			config.Output.FilePath = resolveOutputPath(config.Output.Dir, config.Output.FilePath, defaultName)
+		}
+	}
+	// run log: debug level in debug mode, also picks up the standard logger
+	logger, closeLog, err := newLogger(config)
+	if err != nil {
+		log.Fatal("Log error: ", err)
+	}
+	defer closeLog()
+	slog.SetDefault(logger)
+	// count only: no output files of any kind
+	if *countOnlyFlag {
+		config.Logging.LogDbResultsToFile = false
+		config.Logging.LogProcessedResultsToFile = false
+	}
+	// debug mode: log config object
+	slog.Debug("config", "config", config)
+
+	// print final query, optionally without running anything
+	if *printQueryFlag || *printQueryOnlyFlag {
+		if err := printQuery(os.Stdout, config, scope); err != nil {
+			log.Fatal("Query error: ", err)
+		}
+		if *printQueryOnlyFlag {
+			return
+		}
+	}
+
+	// summary of the run for the webhook, failures from here on are reported before exiting
+	var stats ProcessStats
+	report := &runReport{config: config, start: runStart, stats: &stats}
+	fatalf := func(format string, v ...any) {
+		report.notify("failure", fmt.Errorf(format, v...))
+		log.Fatalf(format, v...)
+	}
+
+	// root context of the run, cancelled on interrupt and, with -max-runtime, when the deadline passes
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *maxRuntimeFlag > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, *maxRuntimeFlag-time.Since(runStart))
+		defer cancel()
+	}
+
+	// connect to db
+	readDB := config.connection(ReadConnection)
+	db, err := connectDB(runCtx, readDB)
+	if err != nil {
+		fatalf("Database connection error: %v", err)
+	}
+	slog.Debug("connected", "server", readDB.Server, "database", readDB.Database)
+	defer db.Close() // defer close connection to end of program
+
+	processOpts := periods.ProcessOptions{
+		Logger:              slog.Default(),
+		Strict:              *strictFlag,
+		ClosedIntervals:     config.closedIntervals(),
+		BusinessDaysOnly:    config.Processing.BusinessDaysOnly,
+		Holidays:            make(map[string]bool),
+		OverlapTolerance:    time.Duration(config.Processing.OverlapToleranceSeconds) * time.Second,
+		SnapToGrid:          config.Processing.SnapToGrid,
+		GridEpoch:           time.Unix(0, 0).UTC(),
+		MaxSplitsPerProduct: config.Processing.MaxSplitsPerProduct,
+		Workers:             config.Processing.Workers,
+	}
+	if processOpts.Granularity, err = config.granularity(); err != nil {
+		fatalf("Invalid granularity: %v", err)
+	}
+	if config.Processing.DayAnchor != "" {
+		if processOpts.DayAnchor, err = periods.ParseDayAnchor(config.Processing.DayAnchor); err != nil {
+			fatalf("Config error: %v", err)
+		}
+	}
+	if config.Processing.GridEpoch != "" {
+		epoch, err := time.Parse(time.RFC3339, config.Processing.GridEpoch)
+		if err != nil {
+			fatalf("Invalid grid epoch %q: %v", config.Processing.GridEpoch, err)
+		}
+		processOpts.GridEpoch = epoch
+	}
+	if len(config.Processing.ProductOverlapToleranceSeconds) > 0 {
+		processOpts.ProductOverlapTolerance = make(map[int]time.Duration)
+		for prodNum, seconds := range config.Processing.ProductOverlapToleranceSeconds {
+			processOpts.ProductOverlapTolerance[prodNum] = time.Duration(seconds) * time.Second
+		}
+	}
+	for _, holiday := range config.Processing.Holidays {
+		date, err := time.Parse("2006-01-02", holiday)
+		if err != nil {
+			fatalf("Invalid holiday %q: %v", holiday, err)
+		}
+		processOpts.Holidays[date.Format("2006-01-02")] = true
+	}
+	if config.Processing.HolidayFile != "" {
+		holidays, err := loadHolidays(config.Processing.HolidayFile, config.Processing.Region)
+		if err != nil {
+			fatalf("Holiday calendar error: %v", err)
+		}
+		for date := range holidays {
+			processOpts.Holidays[date] = true
+		}
+		slog.Debug("loaded holidays", "region", config.Processing.Region, "holidays", len(holidays))
+	}
+	// plausible range of period dates
+	minDate, maxDate := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2100, 12, 31, 0, 0, 0, 0, time.UTC)
+	if config.Processing.MinDate != "" {
+		if minDate, err = time.Parse("2006-01-02", config.Processing.MinDate); err != nil {
+			fatalf("Invalid min date %q: %v", config.Processing.MinDate, err)
+		}
+	}
+	if config.Processing.MaxDate != "" {
+		if maxDate, err = time.Parse("2006-01-02", config.Processing.MaxDate); err != nil {
+			fatalf("Invalid max date %q: %v", config.Processing.MaxDate, err)
+		}
+	}
+	processOpts.TieBreak = config.Processing.TieBreak
+	processOpts.SourceRank = make(map[string]int)
+	for rank, source := range config.Sources {
+		processOpts.SourceRank[source.Name] = rank
+	}
+	if err := config.resolution(&processOpts); err != nil {
+		fatalf("Config error: %v", err)
+	}
+	if *explainRemovalFlag {
+		processOpts.Removals = &periods.RemovalLog{}
+	}
+	if *traceProductFlag != 0 {
+		processOpts.Trace = &periods.DecisionTrace{ProdNum: *traceProductFlag}
+	}
+
+	// serve mode: runs on request over the connection pool until interrupted, no max runtime
+	if *serveFlag {
+		if len(config.Database.Shards) > 0 || config.Output.Format == "table" || config.Output.Format == "queue" {
+			fatalf("Config error: -serve supports a single database and file output formats only")
+		}
+		serveCtx, stopServe := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stopServe()
+		// collectors of a single run are not shared between requests
+		serveOpts := processOpts
+		serveOpts.Trace, serveOpts.Removals, serveOpts.Iterations = nil, nil, nil
+		server := &processServer{db: db, config: config, opts: serveOpts, minDate: minDate, maxDate: maxDate, strictDates: *strictDatesFlag}
+		if err := server.serve(serveCtx, config.Serve.Address); err != nil {
+			fatalf("Serve error: %v", err)
+		}
+		return
+	}
+	// every other way the run ends is reported as it exits, a timed out run under its own status
+	defer func() {
+		status := "success"
+		if exitCode == exitTimedOut {
+			status = "timeout"
+		}
+		report.notify(status, nil)
+	}()
+	var flattenedPeriods []periods.Period
+	// max runtime hit and the work done so far is still written
+	var timedOut bool
+	// copy of fetched periods kept for the run record and trace, processing modifies them in place
+	var recordedInput []periods.Period
+	keepInput := *recordFlag != "" || *dryRunFlag || processOpts.Trace != nil || *countOnlyFlag || *heatmapFlag != "" || *diffFlag != "" || config.Output.Format == "table"
+	if config.Processing.StreamByProduct && !*validateOnlyFlag {
+		// fragment IDs continue across the products processed one at a time
+		processOpts.SplitIDs = new(int)
+		// streamed output: each product is written once resolved and not kept
+		var out *streamOutput
+		if config.Processing.StreamOutput {
+			if out, err = newStreamOutput(config); err != nil {
+				fatalf("Failed to write output: %v", err)
+			}
+		}
+		// fetch and process data one product at a time
+		err = fetchPeriodsByProduct(runCtx, db, config, func(product []periods.Period) error {
+			// log to file: log fetched data
+			if config.Logging.LogDbResultsToFile {
+				if err := logRecordset(product, config, "fetched"); err != nil {
+					log.Printf("Failed to log fetched periods: %v", err)
+				}
+			}
+			product = scope.filter(product)
+			if len(product) == 0 {
+				return nil
+			}
+			product, err := checkDateRange(product, minDate, maxDate, *strictDatesFlag)
+			if err != nil {
+				return err
+			}
+			product, err = checkPeriodLengths(product, processOpts.ClosedIntervals, config.Processing.SkipInvalidPeriods)
+			if err != nil {
+				return err
+			}
+			// out of time: keep what is processed so far
+			if err := runCtx.Err(); err != nil {
+				return err
+			}
+			if keepInput {
+				recordedInput = append(recordedInput, product...)
+			}
+			processed, err := stats.timeProcessing(runCtx, product, processOpts)
+			if err := checkConflicts(err, config.Processing.AbortOnConflicts); err != nil {
+				return err
+			}
+			if out != nil {
+				if config.Logging.LogProcessedResultsToFile {
+					if err := logRecordset(processed, config, "processed"); err != nil {
+						log.Printf("Failed to log processed periods: %v", err)
+					}
+				}
+				return out.write(processed, processOpts, *verifyFlag)
+			}
+			flattenedPeriods = append(flattenedPeriods, processed...)
+			return nil
+		})
+		if out != nil {
+			if closeErr := out.close(); err == nil && closeErr != nil {
+				err = closeErr
+			}
+		}
+		if errors.Is(err, context.DeadlineExceeded) && runCtx.Err() != nil {
+			timedOut = true
+			if !reportTimeout(*maxRuntimeFlag, config.Output.WritePartialOnTimeout) {
+				exitCode = exitTimedOut
+				return
+			}
+		} else if err != nil {
+			fatalf("Failed to fetch and process periods from the database: %v", err)
+		}
+		// streamed output is already written, the rest of the run needs the whole output
+		if out != nil {
+			stats.print()
+			stats.printProducts()
+			if timedOut {
+				exitCode = exitTimedOut
+			}
+			return
+		}
+	} else {
+		// fetch data, from all shards and sources when configured
+		fetch := func(db *sql.DB) ([]periods.Period, error) {
+			if len(config.Sources) > 0 {
+				return fetchSources(runCtx, db, config)
+			}
+			return fetchPeriods(runCtx, db, config)
+		}
+		var fetchedPeriods []periods.Period
+		if len(config.Database.Shards) > 0 {
+			fetchedPeriods, err = fetchShards(config.Database.Shards, config.Database.ShardFailurePolicy, config.Database.MaxParallelShards, func(shard DatabaseConfig) ([]periods.Period, error) {
+				shardDB, err := connectDB(runCtx, shard)
+				if err != nil {
+					return nil, err
+				}
+				defer shardDB.Close()
+				return fetch(shardDB)
+			})
+		} else {
+			fetchedPeriods, err = fetch(db)
+		}
+		if errors.Is(err, context.DeadlineExceeded) && runCtx.Err() != nil {
+			// nothing processed yet, no partial output to write
+			reportTimeout(*maxRuntimeFlag, false)
+			exitCode = exitTimedOut
+			return
+		}
+		if err != nil {
+			fatalf("Failed to fetch periods from the database: %v", err)
+		}
+
+		// validate only: report issue counts per rule, no processing or output
+		if *validateOnlyFlag {
+			counts, err := json.MarshalIndent(countIssuesByRule(validatePeriods(fetchedPeriods)), "", "  ")
+			if err != nil {
+				fatalf("Failed to encode validation report: %v", err)
+			}
+			fmt.Println(string(counts))
+			return
+		}
+
+		// log to file: log fetched data
+		if config.Logging.LogDbResultsToFile {
+			if err := logRecordset(fetchedPeriods, config, "fetched"); err != nil {
+				log.Printf("Failed to log fetched periods: %v", err)
+			}
+		}
+
+		fetchedPeriods = scope.filter(fetchedPeriods)
+
+		// drop or reject periods with implausible dates
+		fetchedPeriods, err = checkDateRange(fetchedPeriods, minDate, maxDate, *strictDatesFlag)
+		if err != nil {
+			fatalf("Invalid period dates: %v", err)
+		}
+		// drop or reject inverted and zero length periods
+		fetchedPeriods, err = checkPeriodLengths(fetchedPeriods, processOpts.ClosedIntervals, config.Processing.SkipInvalidPeriods)
+		if err != nil {
+			fatalf("Invalid periods: %v", err)
+		}
+
+		// shuffle test: same input in random orders has to give the same output
+		if *shuffleTestFlag > 0 {
+			if err := shuffleCheck(fetchedPeriods, processOpts, *shuffleTestFlag); err != nil {
+				fatalf("Shuffle test failed: %v", err)
+			}
+			fmt.Printf("Shuffle test passed: %d runs\n", *shuffleTestFlag)
+			return
+		}
+
+		if keepInput {
+			recordedInput = slices.Clone(fetchedPeriods)
+		}
+
+		// process data
+		flattenedPeriods, err = stats.timeProcessing(runCtx, fetchedPeriods, processOpts)
+		if errors.Is(err, context.DeadlineExceeded) && runCtx.Err() != nil {
+			// processing stopped within a product, no complete output to write
+			reportTimeout(*maxRuntimeFlag, false)
+			exitCode = exitTimedOut
+			return
+		}
+		if err := checkConflicts(err, config.Processing.AbortOnConflicts); err != nil {
+			fatalf("Failed to process periods: %v", err)
+		}
+	}
+
+	// month snapping and gap filling when configured
+	var gaps []periods.Gap
+	flattenedPeriods, gaps = normalizeResolved(flattenedPeriods, config, processOpts)
+	if config.Processing.SnapBoundariesTo == "month" || len(gaps) > 0 && config.Processing.FillGaps != "" {
+		stats.OutputRows = len(flattenedPeriods)
+	}
+	for _, gap := range gaps {
+		layout := boundaryLayout(processOpts.Granule())
+		fmt.Printf("Gap in prodnum %d from %s to %s\n", gap.ProdNum, gap.From.Format(layout), gap.To.Format(layout))
+	}
+	if len(gaps) > 0 && config.Processing.FillGaps != "" {
+		fmt.Printf("Filled %d gaps (%s)\n", len(gaps), config.Processing.FillGaps)
+	}
+
+	// post-condition: processing left no overlaps
+	if *verifyFlag {
+		if err := periods.AssertNoOverlaps(flattenedPeriods, processOpts); err != nil {
+			fatalf("Verification failed: %v", err)
+		}
+		fmt.Printf("Verified no overlaps in %d processed periods\n", len(flattenedPeriods))
+	}
+
+	// processing ran past the deadline: the processed periods are complete, write them only when configured
+	if runCtx.Err() != nil && !timedOut {
+		timedOut = true
+		if !reportTimeout(*maxRuntimeFlag, config.Output.WritePartialOnTimeout) {
+			exitCode = exitTimedOut
+			return
+		}
+	}
+
+	// summary: counts and processing throughput, and what processing did to each product
+	stats.print()
+	stats.printProducts()
+
+	// flag processed prices outside of their product's expected range
+	if config.Processing.PriceBandsPath != "" {
+		bands, err := loadPriceBands(config.Processing.PriceBandsPath)
+		if err != nil {
+			fatalf("Failed to load price bands: %v", err)
+		}
+		issues := checkPriceBands(flattenedPeriods, bands)
+		for _, issue := range issues {
+			band := bands[issue.Period.ProdNum]
+			warning := fmt.Sprintf("period id %d (prodnum %d) price %v outside of expected range %v to %v",
+				issue.Period.ID, issue.Period.ProdNum, issue.Period.Price, band.Min, band.Max)
+			fmt.Printf("Warning: %s\n", warning)
+			report.warnings = append(report.warnings, warning)
+		}
+		if len(issues) > 0 && *strictFlag {
+			fatalf("%d processed periods priced outside of expected range", len(issues))
+		}
+	}
+
+	// dry run: summarize changes to the input and skip all writers, the write table included
+	if *dryRunFlag {
+		printDryRun(dryRunChanges(recordedInput, flattenedPeriods))
+		return
+	}
+
+	// diff against db: preview changes to the write table and skip all writers
+	if *diffAgainstDBFlag {
+		if config.WriteTable == "" {
+			fatalf("No writeTable configured to diff against")
+		}
+		writeDB, err := connectDB(runCtx, config.connection(WriteConnection))
+		if err != nil {
+			fatalf("Database connection error: %v", err)
+		}
+		defer writeDB.Close()
+		queryCtx, cancel := config.queryContext(runCtx)
+		existing, err := fetchTablePeriods(queryCtx, writeDB, config, scope)
+		cancel()
+		if err != nil {
+			fatalf("Failed to fetch stored periods: %v", err)
+		}
+		printDiff(diffPeriods(existing, flattenedPeriods))
+		return
+	}
+
+	// count only: report counts and skip all writers
+	if *countOnlyFlag {
+		printCounts(recordedInput, flattenedPeriods)
+		return
+	}
+
+	// write trace graph for traced product
+	if processOpts.Trace != nil {
+		if err := writeTraceDot(resolveOutputPath(config.Output.Dir, *traceDotFlag, "trace.dot"), processOpts.Trace, recordedInput, flattenedPeriods); err != nil {
+			fatalf("Failed to write trace: %v", err)
+		}
+	}
+
+	// write overlap heatmap of source periods
+	if *heatmapFlag != "" {
+		heatmap := overlapHeatmap(recordedInput, processOpts.ClosedIntervals, processOpts.Granule())
+		if err := writeHeatmap(resolveOutputPath(config.Output.Dir, *heatmapFlag, ""), heatmap); err != nil {
+			fatalf("Failed to write heatmap: %v", err)
+		}
+	}
+
+	// write what processing changed per input period
+	if *diffFlag != "" {
+		path := *diffFlag
+		if path != "-" {
+			path = resolveOutputPath(config.Output.Dir, path, "")
+		}
+		if err := writeDiff(path, periods.DiffPeriods(recordedInput, flattenedPeriods)); err != nil {
+			fatalf("Failed to write diff: %v", err)
+		}
+	}
+
+	// write removal explanations
+	if processOpts.Removals != nil {
+		if err := writeRemovals(resolveOutputPath(config.Output.Dir, "", "removals.json"), processOpts.Removals); err != nil {
+			fatalf("Failed to write removals: %v", err)
+		}
+	}
+
+	// record run before any output sampling
+	if *recordFlag != "" {
+		record := RunRecord{Config: *config, Options: processOpts, Input: recordedInput, Output: flattenedPeriods, Stats: stats.Products, Trace: processOpts.Trace}
+		if err := writeRunRecord(*recordFlag, record); err != nil {
+			fatalf("Failed to record run: %v", err)
+		}
+		if *outputHashFlag {
+			if _, err := hashOutputFile(*recordFlag, config.Output.HashSidecar); err != nil {
+				fatalf("Failed to hash run record: %v", err)
+			}
+		}
+	}
+
+	// output sample: only keep the first N processed periods in the outputs,
+	// the write-back still replaces the stored periods with all of them
+	sampledPeriods := flattenedPeriods
+	if *outputSampleFlag > 0 {
+		fmt.Printf("Output sampling active: outputting first %d of %d processed periods\n",
+			min(*outputSampleFlag, len(flattenedPeriods)), len(flattenedPeriods))
+		sampledPeriods = samplePeriods(flattenedPeriods, *outputSampleFlag)
+	}
+
+	// log to file: log fetched data
+	if config.Logging.LogProcessedResultsToFile {
+		if err := logRecordset(sampledPeriods, config, "processed"); err != nil {
+			log.Printf("Failed to log processed periods: %v", err)
+		}
 	}
 
 	// output processed data
+	outputPeriods := sampledPeriods
+	if config.Output.EndDateInclusive {
+		outputPeriods = inclusiveEndDates(sampledPeriods, processOpts)
+	}
+	if *sortOutputByIDFlag {
+		// sort a copy, processed periods keep their processing order
+		outputPeriods = slices.Clone(outputPeriods)
+		sortPeriodsByID(outputPeriods)
+	}
+	// what changed feed: segments priced differently than in the prior run
+	if *changedPriorFlag != "" {
+		prior, err := readTimeline(*changedPriorFlag)
+		if err != nil {
+			fatalf("Failed to read prior timeline: %v", err)
+		}
+		if prior == nil {
+			fmt.Printf("No prior timeline at %s, all segments are changed\n", *changedPriorFlag)
+		}
+		// output periods and the prior timeline share the end date convention
+		closed := processOpts.ClosedIntervals || config.Output.EndDateInclusive
+		changed := changedSegments(priceTimeline(outputPeriods), prior, closed, processOpts.Granule())
+		if err := writeTimelineSegments(changed, resolveOutputPath(config.Output.Dir, "", "changed.json")); err != nil {
+			fatalf("Failed to write changed segments: %v", err)
+		}
+	}
+	switch config.Output.Format {
+	case "":
+		// no output configured
+	case "table":
+		// reasons compare against the input in the same end date convention
+		input := recordedInput
+		if config.Output.EndDateInclusive {
+			input = inclusiveEndDates(recordedInput, processOpts)
+		}
+		if err := writeTable(os.Stdout, outputPeriods, input, processOpts.Granule(), terminalWidth()); err != nil {
+			fatalf("Failed to write output: %v", err)
+		}
+	case "queue":
+		pub := newKafkaPublisher(config.Output.Queue.Brokers, config.Output.Queue.Topic)
+		defer pub.Close()
+		if err := publishPeriods(runCtx, pub, outputPeriods, config); err != nil {
+			fatalf("Failed to publish output: %v", err)
+		}
+	default:
+		write, ok := fileWriters[config.Output.Format]
+		if !ok {
+			fatalf("Unknown output format: %s", config.Output.Format)
+		}
+		// predictable row order unless ID order was asked for
+		if !*sortOutputByIDFlag {
+			outputPeriods = slices.Clone(outputPeriods)
+			periods.SortPeriods(outputPeriods)
+		}
+		if err := write(outputPeriods, config.Output.FilePath, config); err != nil {
+			fatalf("Failed to write output: %v", err)
+		}
+		if *outputHashFlag {
+			if _, err := hashOutputFile(config.Output.FilePath, config.Output.HashSidecar); err != nil {
+				fatalf("Failed to hash output: %v", err)
+			}
+		}
+	}
+
+	// write back to the write table, replacing the stored periods of the processed products
+	if config.WriteTable != "" {
+		writeDB, err := connectDB(runCtx, config.connection(WriteConnection))
+		if err != nil {
+			fatalf("Database connection error: %v", err)
+		}
+		defer writeDB.Close()
+		if err := writePeriods(runCtx, writeDB, flattenedPeriods, config, scope.Since, *sortOutputByIDFlag); err != nil {
+			fatalf("Failed to write periods back to the database: %v", err)
+		}
+	}
+
+	if timedOut {
+		exitCode = exitTimedOut
+	}
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// summary of a run posted to the notification webhook
+type RunSummary struct {
+	RunID      string   `json:"runId"`
+	Status     string   `json:"status"`
+	InputRows  int      `json:"inputRows"`
+	OutputRows int      `json:"outputRows"`
+	DurationMs int64    `json:"durationMs"`
+	Warnings   []string `json:"warnings"`
+	// what ended a failed run
+	Error string `json:"error,omitempty"`
+}
+
+// outcome of a run, reported to the webhook once on whichever path the run ends
+type runReport struct {
+	config   *Config
+	start    time.Time
+	stats    *ProcessStats
+	warnings []string
+	sent     bool
+}
+
+// Post the run summary under status, err is what ended a failed run;
+// nothing is posted without a webhook or when the run was already reported
+func (r *runReport) notify(status string, err error) {
+	if r.sent || r.config.Notify.WebhookURL == "" {
+		return
+	}
+	r.sent = true
+	summary := RunSummary{
+		RunID:      newRunID(),
+		Status:     status,
+		InputRows:  r.stats.InputRows,
+		OutputRows: r.stats.OutputRows,
+		DurationMs: time.Since(r.start).Milliseconds(),
+		Warnings:   r.warnings,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	// not the run's context, a timed out or interrupted run still reports its summary
+	if err := notifyWebhook(context.Background(), r.config, summary); err != nil {
+		log.Printf("Failed to notify webhook: %v", err)
+	}
+}
+
+// Random id identifying a run in notifications
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405")
+	}
+	return hex.EncodeToString(b)
+}
+
+// POST the run summary as JSON to the webhook, retrying with backoff on failure
+func notifyWebhook(ctx context.Context, config *Config, summary RunSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("error encoding run summary: %w", err)
+	}
+	timeout := 10 * time.Second
+	if config.Notify.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.Notify.TimeoutSeconds) * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+	baseDelay := time.Duration(config.Notify.RetryBaseDelayMs) * time.Millisecond
+	return retryWithBackoff(ctx, config.Notify.RetryAttempts, baseDelay, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.Notify.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			return permanentError{fmt.Errorf("error posting run summary: %w", err)}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("error posting run summary: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("error posting run summary: unexpected status %s", resp.Status)
+		}
+		return nil
+	})
+}
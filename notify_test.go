@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunReportNotify(t *testing.T) {
+	var received []RunSummary
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the first delivery fails, the retry gets through
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var summary RunSummary
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			t.Errorf("decoding summary: %v", err)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("content type %q", contentType)
+		}
+		received = append(received, summary)
+	}))
+	defer server.Close()
+
+	var config Config
+	config.Notify.WebhookURL = server.URL
+	config.Notify.RetryAttempts = 2
+	config.Notify.RetryBaseDelayMs = 1
+	stats := ProcessStats{InputRows: 12, OutputRows: 9}
+	report := &runReport{config: &config, start: time.Now(), stats: &stats, warnings: []string{"price outside of range"}}
+	report.notify("failure", errors.New("Failed to write output: disk full"))
+	// a run is reported once, the exit path after a failure does not report it again
+	report.notify("success", nil)
+
+	if len(received) != 1 {
+		t.Fatalf("received %d summaries, want 1", len(received))
+	}
+	got := received[0]
+	if got.RunID == "" || got.DurationMs < 0 {
+		t.Errorf("summary without run id or duration: %+v", got)
+	}
+	got.RunID, got.DurationMs = "", 0
+	want := RunSummary{Status: "failure", InputRows: 12, OutputRows: 9, Warnings: []string{"price outside of range"},
+		Error: "Failed to write output: disk full"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunReportNotifyDisabled(t *testing.T) {
+	// no webhook configured: nothing to post to, and nothing fails
+	report := &runReport{config: &Config{}, start: time.Now(), stats: &ProcessStats{}}
+	report.notify("success", nil)
+	if report.sent {
+		t.Error("run reported without a webhook")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+	"github.com/xuri/excelize/v2"
+)
+
+// writer of an output format written to output.filePath
+type outputWriter func(list []periods.Period, path string, config *Config) error
+
+// output formats written to a file, by config name
+var fileWriters = map[string]outputWriter{
+	"xlsx":     withGranularity(writeXLSX),
+	"csv":      withGranularity(writeCSV),
+	"json":     withoutConfig(writeJSON),
+	"timeline": withoutConfig(writeTimeline),
+	"log": func(list []periods.Period, path string, config *Config) error {
+		granularity, err := config.granularity()
+		if err != nil {
+			return err
+		}
+		return writeLogOutput(list, path, config.Logging.RecordFormat, boundaryLayout(granularity))
+	},
+}
+
+// Adapt a writer that needs no config
+func withoutConfig(write func([]periods.Period, string) error) outputWriter {
+	return func(list []periods.Period, path string, _ *Config) error {
+		return write(list, path)
+	}
+}
+
+// Adapt a writer formatting boundaries per the configured granularity
+func withGranularity(write func([]periods.Period, string, periods.Granularity) error) outputWriter {
+	return func(list []periods.Period, path string, config *Config) error {
+		granularity, err := config.granularity()
+		if err != nil {
+			return err
+		}
+		return write(list, path, granularity)
+	}
+}
+
+// Layout of period boundaries in text outputs: dates, with the time of day when granules are shorter than a day
+func boundaryLayout(granularity periods.Granularity) string {
+	if granularity.SubDay() {
+		return "2006-01-02 15:04"
+	}
+	return "2006-01-02"
+}
+
+// Copy periods for output with inclusive end dates (one granule before the exclusive end),
+// a period shorter than a granule keeps its end on its start rather than being inverted;
+// periods processed in closed mode already end inclusively and are returned as they are
+func inclusiveEndDates(input []periods.Period, opts periods.ProcessOptions) []periods.Period {
+	if opts.ClosedIntervals {
+		return input
+	}
+	out := make([]periods.Period, len(input))
+	for i, p := range input {
+		// open ends stay open
+		if p.PeriodEnd.Equal(openPeriodEnd) {
+			out[i] = p
+			continue
+		}
+		p.PeriodEnd = periods.AddGranules(p.PeriodEnd, -1, opts.Granule())
+		if p.PeriodEnd.Before(p.PeriodStart) {
+			p.PeriodEnd = p.PeriodStart
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// Sort periods by ID ascending for output, split fragments follow the period
+// they were cut from in PeriodStart order
+func sortPeriodsByID(list []periods.Period) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].SourceID() != list[j].SourceID() {
+			return list[i].SourceID() < list[j].SourceID()
+		}
+		return list[i].PeriodStart.Before(list[j].PeriodStart)
+	})
+}
+
+// Write processed periods to an Excel report with a header row, boundaries as dates or with the time of day
+// when granules are shorter than a day
+func writeXLSX(list []periods.Period, path string, granularity periods.Granularity) error {
+	const sheet = "Periods"
+	f := excelize.NewFile()
+	defer f.Close()
+	// rename default sheet
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return fmt.Errorf("error creating sheet: %w", err)
+	}
+	// header row
+	header := []interface{}{"ID", "ProdNum", "PeriodStart", "PeriodEnd", "Price", "PeriodPriority"}
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	// keep header visible when scrolling
+	if err := f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return fmt.Errorf("error freezing header: %w", err)
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("error creating style: %w", err)
+	}
+	dateFormat := "yyyy-mm-dd"
+	if granularity.SubDay() {
+		dateFormat = "yyyy-mm-dd hh:mm"
+	}
+	dateStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		return fmt.Errorf("error creating style: %w", err)
+	}
+	currencyFormat := "#,##0.00"
+	priceStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &currencyFormat})
+	if err != nil {
+		return fmt.Errorf("error creating style: %w", err)
+	}
+	// one row per period, starting below header
+	for i, p := range list {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return fmt.Errorf("error writing row: %w", err)
+		}
+		row := []interface{}{p.ID, p.ProdNum, p.PeriodStart, p.PeriodEnd, p.Price.Float64(), p.PeriodPriority}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return fmt.Errorf("error writing row: %w", err)
+		}
+	}
+	// apply styles to whole columns of data
+	lastRow := len(list) + 1
+	if err := f.SetCellStyle(sheet, "A1", "F1", headerStyle); err != nil {
+		return fmt.Errorf("error applying style: %w", err)
+	}
+	if lastRow > 1 {
+		if err := f.SetCellStyle(sheet, "C2", fmt.Sprintf("D%d", lastRow), dateStyle); err != nil {
+			return fmt.Errorf("error applying style: %w", err)
+		}
+		if err := f.SetCellStyle(sheet, "E2", fmt.Sprintf("E%d", lastRow), priceStyle); err != nil {
+			return fmt.Errorf("error applying style: %w", err)
+		}
+	}
+	if err := f.SaveAs(path); err != nil {
+		return fmt.Errorf("error saving xlsx file: %w", err)
+	}
+	fmt.Printf("Periods written to %s: %v\n", path, len(list))
+	return nil
+}
+
+// columns of csv output
+var csvHeader = []string{"ID", "ProdNum", "PeriodStart", "PeriodEnd", "Price", "PeriodPriority"}
+
+// Period as a csv row with boundaries in the given layout
+func csvRow(p periods.Period, layout string) []string {
+	return []string{
+		strconv.Itoa(p.ID),
+		strconv.Itoa(p.ProdNum),
+		p.PeriodStart.Format(layout),
+		p.PeriodEnd.Format(layout),
+		p.Price.String(),
+		strconv.Itoa(p.PeriodPriority),
+	}
+}
+
+// Write periods to a CSV file with a header row and ISO dates, with the time of day when granules
+// are shorter than a day, replacing any existing file
+func writeCSV(list []periods.Period, path string, granularity periods.Granularity) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating csv file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing csv file: %w", closeErr)
+		}
+	}()
+	w := csv.NewWriter(file)
+	if err := w.Write(csvHeader); err != nil {
+		return fmt.Errorf("error writing header: %w", err)
+	}
+	for _, p := range list {
+		if err := w.Write(csvRow(p, boundaryLayout(granularity))); err != nil {
+			return fmt.Errorf("error writing row: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing csv file: %w", err)
+	}
+	fmt.Printf("Periods written to %s: %v\n", path, len(list))
+	return nil
+}
+
+// Write periods to a JSON file as an array, dates in RFC3339
+func writeJSON(list []periods.Period, path string) error {
+	if list == nil {
+		list = []periods.Period{}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding periods: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing json file: %w", err)
+	}
+	fmt.Printf("Periods written to %s: %v\n", path, len(list))
+	return nil
+}
+
+// Compute and print the SHA-256 checksum of a written file,
+// optionally also writing it to a "<file>.sha256" sidecar
+func hashOutputFile(path string, sidecar bool) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file to hash: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error hashing file: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	fmt.Printf("SHA-256 %s: %s\n", path, sum)
+	if sidecar {
+		// same layout as sha256sum output so it can be checked with sha256sum -c
+		line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+		if err := os.WriteFile(path+".sha256", []byte(line), 0644); err != nil {
+			return "", fmt.Errorf("error writing hash sidecar: %w", err)
+		}
+	}
+	return sum, nil
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Parse a "YYYY-MM-DD" or "YYYY-MM-DD hh:mm" UTC time
+func day(s string) time.Time {
+	layout := "2006-01-02"
+	if len(s) > len(layout) {
+		layout = "2006-01-02 15:04"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Periods as "id start..end" lines in output order, compact enough to compare whole results
+func spans(list []periods.Period) []string {
+	out := make([]string, len(list))
+	for i, p := range list {
+		out[i] = fmt.Sprintf("%d %s..%s", p.ID, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"))
+	}
+	return out
+}
+
+// Run f and return what it printed to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// Run f with the default logger writing text records into the returned buffer
+func captureLog(t *testing.T, f func()) string {
+	t.Helper()
+	var out strings.Builder
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&out, nil)))
+	defer slog.SetDefault(logger)
+	f()
+	return out.String()
+}
+
+func TestInclusiveEndDates(t *testing.T) {
+	tests := []struct {
+		name        string
+		closed      bool
+		granularity time.Duration
+		start, end  string
+		want        string
+	}{
+		{"multiple days", false, 0, "2024-01-01", "2024-01-10", "2024-01-09"},
+		{"single day", false, 0, "2024-01-01", "2024-01-02", "2024-01-01"},
+		{"closed days already inclusive", true, 0, "2024-01-01", "2024-01-10", "2024-01-10"},
+		{"half-open hours", false, time.Hour, "2024-01-01 00:00", "2024-01-01 06:00", "2024-01-01 05:00"},
+		{"shorter than a day", false, 0, "2024-01-01 00:00", "2024-01-01 06:00", "2024-01-01 00:00"},
+		{"open end", false, 0, "2024-01-01", "9999-12-31", "9999-12-31"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []periods.Period{{ID: 1, PeriodStart: day(tt.start), PeriodEnd: day(tt.end)}}
+			out := inclusiveEndDates(input, periods.ProcessOptions{ClosedIntervals: tt.closed, Granularity: periods.GranularityOf(tt.granularity)})
+			if !out[0].PeriodEnd.Equal(day(tt.want)) {
+				t.Errorf("end %v, want %s", out[0].PeriodEnd, tt.want)
+			}
+			if !input[0].PeriodEnd.Equal(day(tt.end)) {
+				t.Errorf("processed end changed to %v", input[0].PeriodEnd)
+			}
+		})
+	}
+}
+
+func TestSamplePeriods(t *testing.T) {
+	processed := []periods.Period{
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")},
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20")},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-09")},
+	}
+	tests := []struct {
+		name    string
+		n       int
+		wantIDs []int
+	}{
+		{"first of the output order", 2, []int{2, 1}},
+		{"more than processed", 5, []int{3, 1, 2}},
+		{"disabled", 0, []int{3, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			config.Logging.FilePath = filepath.Join(t.TempDir(), "periods.log")
+			sample := samplePeriods(append([]periods.Period(nil), processed...), tt.n)
+			if err := logRecordset(sample, &config, "processed"); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(config.Logging.FilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Count(string(data), "\n"); lines != len(tt.wantIDs) {
+				t.Errorf("logged %d periods, want %d", lines, len(tt.wantIDs))
+			}
+			for i, p := range sample {
+				if p.ID != tt.wantIDs[i] {
+					t.Errorf("sample[%d] is period %d, want %d", i, p.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "periods.xlsx")
+	list := []periods.Period{{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("1234.50"), PeriodPriority: 2}}
+	if err := writeXLSX(list, path, periods.Day); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows("Periods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ID", "ProdNum", "PeriodStart", "PeriodEnd", "Price", "PeriodPriority"}; len(rows) != 2 || strings.Join(rows[0], ",") != strings.Join(want, ",") {
+		t.Fatalf("rows %q, want header %q and one period", rows, want)
+	}
+	// dates and prices are stored as numbers shown through their number formats
+	tests := []struct {
+		cell               string
+		wantValue, wantRaw string
+	}{
+		{"C2", "2024-01-01", "45292"},
+		{"E2", "1,234.50", "1234.5"},
+	}
+	for _, tt := range tests {
+		value, err := f.GetCellValue("Periods", tt.cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := f.GetCellValue("Periods", tt.cell, excelize.Options{RawCellValue: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != tt.wantValue || raw != tt.wantRaw {
+			t.Errorf("%s = %q (raw %q), want %q (raw %q)", tt.cell, value, raw, tt.wantValue, tt.wantRaw)
+		}
+	}
+}
+
+func TestResolveOutputPath(t *testing.T) {
+	tests := []struct {
+		name, dir, path, want string
+	}{
+		{"default name under dir", "out", "", "out/periods.log"},
+		{"relative path under dir", "out", "logs/run.log", "out/logs/run.log"},
+		{"absolute path kept", "out", "/var/log/run.log", "/var/log/run.log"},
+		{"no dir", "", "run.log", "run.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveOutputPath(tt.dir, tt.path, "periods.log"); got != tt.want {
+				t.Errorf("resolveOutputPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputDirHoldsGeneratedFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	config.Logging.FilePath = resolveOutputPath(dir, config.Logging.FilePath, "periods.log")
+	config.Output.FilePath = resolveOutputPath(dir, config.Output.FilePath, "periods.xlsx")
+	list := []periods.Period{{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")}}
+	if err := logRecordset(list, &config, "processed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeXLSX(list, config.Output.FilePath, periods.Day); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := "periods.log,periods.xlsx"; strings.Join(names, ",") != want {
+		t.Errorf("output dir holds %q, want %s", names, want)
+	}
+}
+
+func TestHashOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "periods.xlsx")
+	list := []periods.Period{{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")}}
+	if err := writeXLSX(list, path, periods.Day); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+
+	var got string
+	printed := captureStdout(t, func() { got, err = hashOutputFile(path, true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want || printed != "SHA-256 "+path+": "+want+"\n" {
+		t.Errorf("hash %s printed as %q, want %s", got, printed, want)
+	}
+	sidecar, err := os.ReadFile(path + ".sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sidecar) != want+"  periods.xlsx\n" {
+		t.Errorf("sidecar %q, want the sha256sum line of %s", sidecar, want)
+	}
+}
+
+func TestSortPeriodsByID(t *testing.T) {
+	// fragments of split period 1 share its ID and follow in start order
+	list := []periods.Period{
+		{ID: 3, ProdNum: 1, PeriodStart: day("2024-01-01")},
+		{ID: 1, ProdNum: 2, PeriodStart: day("2024-01-21")},
+		{ID: 2, ProdNum: 2, PeriodStart: day("2024-01-15")},
+		{ID: 1, ProdNum: 2, PeriodStart: day("2024-01-01")},
+	}
+	sortPeriodsByID(list)
+	want := []string{"1 2024-01-01", "1 2024-01-21", "2 2024-01-15", "3 2024-01-01"}
+	for i, p := range list {
+		if got := fmt.Sprintf("%d %s", p.ID, p.PeriodStart.Format("2006-01-02")); got != want[i] {
+			t.Errorf("list[%d] = %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestPrintCounts(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	input := []periods.Period{
+		{ID: 1, ProdNum: 9, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 9, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), PeriodPriority: 2},
+	}
+	output, err := periods.ProcessPeriods(append([]periods.Period(nil), input...), periods.ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed := captureStdout(t, func() { printCounts(input, output) })
+	want := "Input periods: 4, output periods: 4, products: 2\n" +
+		"  Prodnum 7: input 2, output 1\n" +
+		"  Prodnum 9: input 2, output 3\n"
+	if printed != want {
+		t.Errorf("printed\n%s\nwant\n%s", printed, want)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("counting created files %v (%v)", entries, err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "periods.csv")
+	list := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("19.99"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 7, PeriodStart: day("2024-01-11"), PeriodEnd: day("2024-01-31"), Price: mustPrice("5.125"), PeriodPriority: 1},
+	}
+	if err := writeCSV(list, path, periods.Day); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,ProdNum,PeriodStart,PeriodEnd,Price,PeriodPriority\n" +
+		"1,7,2024-01-01,2024-01-10,19.99,2\n" +
+		"2,7,2024-01-11,2024-01-31,5.125,1\n"
+	if string(data) != want {
+		t.Errorf("csv\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestWriteCSVHourly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "periods.csv")
+	list := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01 00:00"), PeriodEnd: day("2024-01-01 06:00")},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-01 06:00"), PeriodEnd: day("2024-01-01 12:00")},
+	}
+	if err := writeCSV(list, path, periods.GranularityOf(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,ProdNum,PeriodStart,PeriodEnd,Price,PeriodPriority\n" +
+		"1,1,2024-01-01 00:00,2024-01-01 06:00,0.00,0\n" +
+		"2,1,2024-01-01 06:00,2024-01-01 12:00,0.00,0\n"
+	if string(data) != want {
+		t.Errorf("csv\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestBoundaryLayout(t *testing.T) {
+	tests := []struct {
+		granularity periods.Granularity
+		want        string
+	}{
+		{periods.Day, "2006-01-02"},
+		{periods.Month, "2006-01-02"},
+		{periods.GranularityOf(time.Hour), "2006-01-02 15:04"},
+	}
+	for _, tt := range tests {
+		if got := boundaryLayout(tt.granularity); got != tt.want {
+			t.Errorf("boundaryLayout(%v) = %q, want %q", tt.granularity, got, tt.want)
+		}
+	}
+}
+
+func TestStreamOutputMatchesWriteCSV(t *testing.T) {
+	products := [][]periods.Period{
+		{
+			{ID: 2, ProdNum: 7, PeriodStart: day("2024-01-11"), PeriodEnd: day("2024-01-31"), Price: mustPrice("5.125"), PeriodPriority: 1},
+			{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("19.99"), PeriodPriority: 2},
+		},
+		{{ID: 3, ProdNum: 9, PeriodStart: day("2024-02-01"), PeriodEnd: day("2024-02-29"), Price: mustPrice("1"), PeriodPriority: 1}},
+	}
+	dir := t.TempDir()
+	config := &Config{}
+	config.Output.Format, config.Output.FilePath = "csv", filepath.Join(dir, "streamed.csv")
+	out, err := newStreamOutput(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []periods.Period
+	for _, product := range products {
+		all = append(all, product...)
+		if err := out.write(slices.Clone(product), periods.ProcessOptions{}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.close(); err != nil {
+		t.Fatal(err)
+	}
+	// products streamed one at a time give the file a full run writes
+	periods.SortPeriods(all)
+	full := filepath.Join(dir, "full.csv")
+	if err := writeCSV(all, full, periods.Day); err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := os.ReadFile(config.Output.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(streamed) != string(want) || out.rows != 3 {
+		t.Errorf("streamed %d rows\n%s\nwant\n%s", out.rows, streamed, want)
+	}
+}
+
+func TestWriteJSONRoundTrip(t *testing.T) {
+	list := []periods.Period{
+		{ID: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10.50"), ProdNum: 7, PeriodPriority: 2},
+		{ID: 2, PeriodStart: day("2024-01-20 06:00"), PeriodEnd: day("2024-01-31"), Price: mustPrice("10.50"), ProdNum: 7, PeriodPriority: 2,
+			Source: "erp", Metadata: map[string]any{"channel": "web"}},
+	}
+	path := filepath.Join(t.TempDir(), "periods.json")
+	if err := fileWriters["json"](list, path, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stable field names and RFC3339 dates
+	for _, field := range []string{`"ID": 2`, `"PeriodStart": "2024-01-20T06:00:00Z"`, `"Source": "erp"`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("output misses %s:\n%s", field, data)
+		}
+	}
+	var read []periods.Period
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, list) {
+		t.Errorf("read back\n%+v\nwant\n%+v", read, list)
+	}
+
+	// no periods is an empty array, not null
+	if err := writeJSON(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || strings.TrimSpace(string(data)) != "[]" {
+		t.Errorf("empty output %q, %v", data, err)
+	}
+}
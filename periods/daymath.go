@@ -0,0 +1,133 @@
+package periods
+
+import (
+	"fmt"
+	"time"
+)
+
+// Parse a "HH:MM" time of day into the offset from midnight
+func ParseDayAnchor(anchor string) (time.Duration, error) {
+	t, err := time.Parse("15:04", anchor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid day anchor %q: %w", anchor, err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Round t to the nearest multiple of step counted from epoch
+func SnapToGrid(t, epoch time.Time, step time.Duration) time.Time {
+	offset := t.Sub(epoch)
+	snapped := offset.Round(step)
+	return t.Add(snapped - offset)
+}
+
+// Move t by n granules: calendar granularities step days or months in t's location, so days of 23 or 25 hours
+// around DST changes keep the time of day, other granularities step fixed durations
+func AddGranules(t time.Time, n int, granularity Granularity) time.Time {
+	switch {
+	case granularity.Months > 0:
+		return t.AddDate(0, n*granularity.Months, 0)
+	case granularity.Days > 0:
+		return t.AddDate(0, 0, n*granularity.Days)
+	}
+	return t.Add(time.Duration(n) * granularity.Duration)
+}
+
+// Shift a boundary by one granule (a day by default) in the given direction (1 or -1),
+// in business days only mode it keeps going until it lands on a business day
+func ShiftBoundary(t time.Time, direction int, opts ProcessOptions) time.Time {
+	t = AddGranules(t, direction, opts.Granule())
+	if opts.SnapToGrid {
+		t = snapToGranule(t, opts)
+	}
+	if !opts.BusinessDaysOnly {
+		return t
+	}
+	for IsNonBusinessDay(t, opts) {
+		t = AddGranules(t, direction, opts.Granule())
+	}
+	return t
+}
+
+// End of a period ending right before a period starting at start, in the end convention of the interval mode:
+// the granule before start for inclusive ends, start itself for exclusive ends, so no granule is left uncovered
+func endBefore(start time.Time, opts ProcessOptions) time.Time {
+	end := ShiftBoundary(start, -1, opts)
+	if !opts.ClosedIntervals {
+		end = AddGranules(end, 1, opts.Granule())
+	}
+	return end
+}
+
+// Start of a period beginning right after a period ending at end: the granule after an inclusive end,
+// an exclusive end itself
+func startAfter(end time.Time, opts ProcessOptions) time.Time {
+	if !opts.ClosedIntervals {
+		end = AddGranules(end, -1, opts.Granule())
+	}
+	return ShiftBoundary(end, 1, opts)
+}
+
+// Check if the day bucket of t (starting at the day anchor) is a weekend day or holiday
+func IsNonBusinessDay(t time.Time, opts ProcessOptions) bool {
+	day := t.Add(-opts.DayAnchor)
+	return day.Weekday() == time.Saturday || day.Weekday() == time.Sunday || opts.Holidays[day.Format("2006-01-02")]
+}
+
+// Round t to the nearest granule boundary, buckets start at the day anchor, not at midnight:
+// fixed steps and days are counted from the grid epoch, months round to the nearer first of a month
+func snapToGranule(t time.Time, opts ProcessOptions) time.Time {
+	g := opts.Granule()
+	switch {
+	case g.Months > 0:
+		start := granuleOf(t, opts).Add(opts.DayAnchor)
+		if next := AddGranules(start, 1, g); next.Sub(t) <= t.Sub(start) {
+			return next
+		}
+		return start
+	case g.Days > 0:
+		return SnapToGrid(t, opts.GridEpoch.Add(opts.DayAnchor), time.Duration(g.Days)*time.Hour*24)
+	}
+	return SnapToGrid(t, opts.GridEpoch.Add(opts.DayAnchor), g.Duration)
+}
+
+// Granule of t: its calendar day or month for calendar granularities, with days starting at the day anchor,
+// otherwise t truncated to the granularity
+func granuleOf(t time.Time, opts ProcessOptions) time.Time {
+	t = t.Add(-opts.DayAnchor)
+	g := opts.Granule()
+	switch {
+	case g.Months > 0:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case g.Days > 0:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(g.Duration)
+}
+
+// Start of the granule t falls in, days and months starting at the day anchor
+func GranuleStart(t time.Time, opts ProcessOptions) time.Time {
+	return granuleOf(t, opts).Add(opts.DayAnchor)
+}
+
+// End t aligned to whole granules in the end convention of the interval mode: an inclusive end to the start of
+// the granule it falls in, an exclusive end up to the next granule boundary, so it still covers the same granules
+func GranuleEnd(t time.Time, opts ProcessOptions) time.Time {
+	start := GranuleStart(t, opts)
+	if opts.ClosedIntervals || start.Equal(t) {
+		return start
+	}
+	return AddGranules(start, 1, opts.Granule())
+}
+
+// Check if a period ending at end covers the granule starting at start, in whole granules and in the same end
+// convention as endBefore and startAfter: an inclusive end covers its own granule, an exclusive end the granule
+// of the instant before it, so an inclusive end on the day the next period starts overlaps it
+// while an exclusive one is adjacent, and a period ending the granule before the next starts never overlaps it
+func overlapsDay(end, start time.Time, opts ProcessOptions) bool {
+	lastCovered := end
+	if !opts.ClosedIntervals {
+		lastCovered = end.Add(-time.Nanosecond)
+	}
+	return !granuleOf(lastCovered, opts).Before(granuleOf(start, opts))
+}
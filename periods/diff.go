@@ -0,0 +1,58 @@
+package periods
+
+// how processing changed a period
+type ChangeKind string
+
+const (
+	Unchanged ChangeKind = "unchanged"
+	// same ID with changed boundaries or price
+	Adjusted ChangeKind = "adjusted"
+	// fragment cut from an input period, under a new ID
+	Split ChangeKind = "split"
+	// input period with nothing left in the output
+	Removed ChangeKind = "removed"
+)
+
+// one classified period: the input period, or for a split fragment the parent it was cut from,
+// and the resolved period, which is zero for removed periods
+type PeriodChange struct {
+	Kind   ChangeKind
+	Before Period
+	After  Period
+}
+
+// classified changes keyed by ProdNum, each input period followed by the fragments split from it
+type Diff map[int][]PeriodChange
+
+// Classify what processing did to each input period, matching resolved periods by ID and split
+// fragments to their parent by ParentID; resolved periods of no input period (e.g. gap fills) are left out
+func DiffPeriods(before, after []Period) Diff {
+	byID := make(map[int]Period, len(after))
+	fragments := make(map[int][]Period)
+	for _, p := range after {
+		if p.ParentID != 0 {
+			fragments[p.ParentID] = append(fragments[p.ParentID], p)
+			continue
+		}
+		byID[p.ID] = p
+	}
+	sorted := make([]Period, len(before))
+	copy(sorted, before)
+	SortPeriods(sorted)
+	diff := make(Diff)
+	for _, p := range sorted {
+		resolved, kept := byID[p.ID]
+		change := PeriodChange{Kind: Unchanged, Before: p, After: resolved}
+		switch {
+		case !kept:
+			change.Kind = Removed
+		case !resolved.PeriodStart.Equal(p.PeriodStart) || !resolved.PeriodEnd.Equal(p.PeriodEnd) || resolved.Price != p.Price:
+			change.Kind = Adjusted
+		}
+		diff[p.ProdNum] = append(diff[p.ProdNum], change)
+		for _, fragment := range fragments[p.ID] {
+			diff[p.ProdNum] = append(diff[p.ProdNum], PeriodChange{Kind: Split, Before: p, After: fragment})
+		}
+	}
+	return diff
+}
@@ -0,0 +1,53 @@
+package periods
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDiffPeriods(t *testing.T) {
+	period := func(id, prodNum int, start, end string) Period {
+		return Period{ID: id, ProdNum: prodNum, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: 1}
+	}
+	input := []Period{
+		period(1, 1, "2024-01-01", "2024-01-31"),
+		period(2, 1, "2024-01-10", "2024-01-20"),
+		period(3, 1, "2024-01-12", "2024-01-15"),
+		period(5, 1, "2024-01-25", "2024-02-05"),
+		period(4, 2, "2024-01-01", "2024-01-31"),
+	}
+	fragment := period(-1, 1, "2024-01-21", "2024-01-31")
+	fragment.ParentID = 1
+	repriced := period(4, 2, "2024-01-01", "2024-01-31")
+	repriced.Price = Price(5 * priceScale)
+	processed := []Period{
+		period(1, 1, "2024-01-01", "2024-01-09"), period(2, 1, "2024-01-10", "2024-01-20"), fragment,
+		period(5, 1, "2024-02-01", "2024-02-05"), repriced,
+		// a gap fill belongs to no input period and is left out
+		period(-2, 1, "2024-02-06", "2024-02-10"),
+	}
+
+	diff := DiffPeriods(input, processed)
+	want := map[int][]string{
+		1: {"adjusted 1 -> 1 2024-01-01..2024-01-09", "split 1 -> -1 2024-01-21..2024-01-31", "unchanged 2 -> 2 2024-01-10..2024-01-20",
+			"removed 3", "adjusted 5 -> 5 2024-02-01..2024-02-05"},
+		2: {"adjusted 4 -> 4 2024-01-01..2024-01-31"},
+	}
+	if len(diff) != len(want) {
+		t.Errorf("diff of %d products, want %d", len(diff), len(want))
+	}
+	for prodNum, w := range want {
+		var got []string
+		for _, change := range diff[prodNum] {
+			if change.Kind == Removed {
+				got = append(got, fmt.Sprintf("%s %d", change.Kind, change.Before.ID))
+				continue
+			}
+			got = append(got, fmt.Sprintf("%s %d -> %s", change.Kind, change.Before.ID, spans([]Period{change.After})[0]))
+		}
+		if !slices.Equal(got, w) {
+			t.Errorf("product %d diff\n got %q\nwant %q", prodNum, got, w)
+		}
+	}
+}
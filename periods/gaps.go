@@ -0,0 +1,90 @@
+package periods
+
+import (
+	"slices"
+	"time"
+)
+
+// range of granules within a product's periods that no period covers, From and To are boundaries in the
+// end convention of the interval mode, so a period from From to To covers exactly the gap
+type Gap struct {
+	ProdNum int
+	From    time.Time
+	To      time.Time
+}
+
+// Find the granules left uncovered between the periods of each product, in whole granules like overlaps:
+// a period ending in the granule before the next starts leaves no gap; periods of different products
+// never leave a gap between each other
+func FindGaps(periods []Period, opts ProcessOptions) []Gap {
+	sorted := slices.Clone(periods)
+	SortPeriods(sorted)
+	var gaps []Gap
+	for i := 0; i < len(sorted); {
+		// walk the merged covered range of one product, a gap is a start after the covered end
+		prodNum := sorted[i].ProdNum
+		end := sorted[i].PeriodEnd
+		i++
+		for ; i < len(sorted) && sorted[i].ProdNum == prodNum; i++ {
+			start := sorted[i].PeriodStart
+			if !overlapsDay(end, AddGranules(start, -1, opts.Granule()), opts) {
+				gaps = append(gaps, Gap{ProdNum: prodNum, From: gapFrom(end, opts), To: gapTo(start, opts)})
+			}
+			if sorted[i].PeriodEnd.After(end) {
+				end = sorted[i].PeriodEnd
+			}
+		}
+	}
+	return gaps
+}
+
+// Start of a gap after a period ending at end: the granule after an inclusive end, an exclusive end itself
+func gapFrom(end time.Time, opts ProcessOptions) time.Time {
+	if opts.ClosedIntervals {
+		return AddGranules(end, 1, opts.Granule())
+	}
+	return end
+}
+
+// End of a gap before a period starting at start: the granule before it for inclusive ends, start itself for exclusive ends
+func gapTo(start time.Time, opts ProcessOptions) time.Time {
+	if opts.ClosedIntervals {
+		return AddGranules(start, -1, opts.Granule())
+	}
+	return start
+}
+
+// Fill gaps per mode: "extend" extends the period before a gap up to the period after it,
+// "default" adds a period priced at price over the gap with the lower priority of its neighbours
+// and a negative ID of its own; periods are returned sorted
+func FillGaps(periods []Period, gaps []Gap, mode string, price Price, opts ProcessOptions) []Period {
+	filled := slices.Clone(periods)
+	SortPeriods(filled)
+	nextID := 0
+	for _, p := range filled {
+		nextID = min(nextID, p.ID)
+	}
+	for _, gap := range gaps {
+		// period ending right before the gap and the one starting right after it
+		before := slices.IndexFunc(filled, func(p Period) bool { return p.ProdNum == gap.ProdNum && gapFrom(p.PeriodEnd, opts).Equal(gap.From) })
+		after := slices.IndexFunc(filled, func(p Period) bool { return p.ProdNum == gap.ProdNum && gapTo(p.PeriodStart, opts).Equal(gap.To) })
+		if before == -1 || after == -1 {
+			continue
+		}
+		if mode == "extend" {
+			filled[before].PeriodEnd = gap.To
+			continue
+		}
+		nextID--
+		filled = append(filled, Period{
+			ID:             nextID,
+			PeriodStart:    gap.From,
+			PeriodEnd:      gap.To,
+			Price:          price,
+			ProdNum:        gap.ProdNum,
+			PeriodPriority: max(filled[before].PeriodPriority, filled[after].PeriodPriority),
+		})
+	}
+	SortPeriods(filled)
+	return filled
+}
@@ -0,0 +1,123 @@
+package periods
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Gaps as "prodnum from..to" lines
+func gapSpans(gaps []Gap) []string {
+	var out []string
+	for _, gap := range gaps {
+		out = append(out, fmt.Sprintf("%d %s..%s", gap.ProdNum, gap.From.Format("2006-01-02 15:04"), gap.To.Format("2006-01-02 15:04")))
+	}
+	return out
+}
+
+// Period of product 1 priced 10.00
+func gapTestPeriod(id int, start, end string, priority int) Period {
+	return Period{ID: id, ProdNum: 1, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: priority, Price: 10 * priceScale}
+}
+
+func TestFindGaps(t *testing.T) {
+	other := gapTestPeriod(3, "2024-01-20", "2024-01-31", 1)
+	other.ProdNum = 2
+	tests := []struct {
+		name        string
+		closed      bool
+		granularity time.Duration
+		input       []Period
+		want        []string
+	}{
+		{
+			name:  "nothing before the first period",
+			input: []Period{gapTestPeriod(1, "2024-01-10", "2024-01-20", 1)},
+		},
+		{
+			name:  "gap at the start half-open",
+			input: []Period{gapTestPeriod(1, "2024-01-01", "2024-01-05", 1), gapTestPeriod(2, "2024-01-08", "2024-01-20", 1)},
+			want:  []string{"1 2024-01-05 00:00..2024-01-08 00:00"},
+		},
+		{
+			name:   "gap at the start closed",
+			closed: true,
+			input:  []Period{gapTestPeriod(1, "2024-01-01", "2024-01-04", 1), gapTestPeriod(2, "2024-01-08", "2024-01-20", 1)},
+			want:   []string{"1 2024-01-05 00:00..2024-01-07 00:00"},
+		},
+		{
+			name: "gap in the middle after overlapping periods",
+			input: []Period{gapTestPeriod(1, "2024-01-01", "2024-01-10", 1), gapTestPeriod(2, "2024-01-05", "2024-01-12", 1),
+				gapTestPeriod(3, "2024-01-12", "2024-01-15", 1), gapTestPeriod(4, "2024-01-20", "2024-01-31", 1)},
+			want: []string{"1 2024-01-15 00:00..2024-01-20 00:00"},
+		},
+		{
+			name:   "adjacent periods closed",
+			closed: true,
+			input:  []Period{gapTestPeriod(1, "2024-01-01", "2024-01-09", 1), gapTestPeriod(2, "2024-01-10", "2024-01-20", 1)},
+		},
+		{
+			name:  "adjacent periods half-open",
+			input: []Period{gapTestPeriod(1, "2024-01-01", "2024-01-10", 1), gapTestPeriod(2, "2024-01-10", "2024-01-20", 1)},
+		},
+		{
+			name:  "no gap between products",
+			input: []Period{gapTestPeriod(1, "2024-01-01", "2024-01-10", 1), other},
+		},
+		{
+			name:        "gap in hours",
+			granularity: time.Hour,
+			input:       []Period{gapTestPeriod(1, "2024-01-01 00:00", "2024-01-01 05:00", 1), gapTestPeriod(2, "2024-01-01 07:00", "2024-01-01 12:00", 1)},
+			want:        []string{"1 2024-01-01 05:00..2024-01-01 07:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ProcessOptions{ClosedIntervals: tt.closed, Granularity: GranularityOf(tt.granularity)}
+			if got := gapSpans(FindGaps(tt.input, opts)); !slices.Equal(got, tt.want) {
+				t.Errorf("gaps %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	tests := []struct {
+		name   string
+		closed bool
+		mode   string
+		input  []Period
+		want   []string
+	}{
+		{"extend half-open", false, "extend", []Period{gapTestPeriod(1, "2024-01-01", "2024-01-05", 1), gapTestPeriod(2, "2024-01-08", "2024-01-20", 2)},
+			[]string{"1 2024-01-01..2024-01-08", "2 2024-01-08..2024-01-20"}},
+		{"extend closed", true, "extend", []Period{gapTestPeriod(1, "2024-01-01", "2024-01-04", 1), gapTestPeriod(2, "2024-01-08", "2024-01-20", 2)},
+			[]string{"1 2024-01-01..2024-01-07", "2 2024-01-08..2024-01-20"}},
+		{"default half-open", false, "default", []Period{gapTestPeriod(1, "2024-01-01", "2024-01-05", 1), gapTestPeriod(2, "2024-01-08", "2024-01-20", 2)},
+			[]string{"1 2024-01-01..2024-01-05", "-1 2024-01-05..2024-01-08", "2 2024-01-08..2024-01-20"}},
+		{"default closed", true, "default", []Period{gapTestPeriod(1, "2024-01-01", "2024-01-04", 1), gapTestPeriod(2, "2024-01-08", "2024-01-20", 2)},
+			[]string{"1 2024-01-01..2024-01-04", "-1 2024-01-05..2024-01-07", "2 2024-01-08..2024-01-20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ProcessOptions{ClosedIntervals: tt.closed}
+			filled := FillGaps(tt.input, FindGaps(tt.input, opts), tt.mode, Price(5*priceScale), opts)
+			if got := spans(filled); !slices.Equal(got, tt.want) {
+				t.Errorf("filled %q, want %q", got, tt.want)
+			}
+			if gaps := FindGaps(filled, opts); len(gaps) > 0 {
+				t.Errorf("gaps left: %q", gapSpans(gaps))
+			}
+			if err := AssertNoOverlaps(filled, opts); err != nil {
+				t.Errorf("filling overlaps: %v", err)
+			}
+			// the default period takes the lower priority of its neighbours and the default price
+			for _, p := range filled {
+				if p.ID < 0 && (p.PeriodPriority != 2 || p.Price != Price(5*priceScale)) {
+					t.Errorf("gap period priority %d price %s, want 2 and 5.00", p.PeriodPriority, p.Price)
+				}
+			}
+		})
+	}
+}
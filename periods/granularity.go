@@ -0,0 +1,58 @@
+package periods
+
+import (
+	"fmt"
+	"time"
+)
+
+// step boundaries are moved by: a fixed duration, or a calendar unit of whole days, which keep the time of day
+// across DST changes, or whole months, which follow month lengths (month boundaries are expected on the first)
+type Granularity struct {
+	Duration time.Duration
+	Days     int
+	Months   int
+}
+
+// calendar granularities
+var (
+	Day   = Granularity{Days: 1}
+	Month = Granularity{Months: 1}
+)
+
+// Parse a granularity config value: "day", "month" or a positive duration such as "1h", "24h" being a calendar day
+func ParseGranularity(value string) (Granularity, error) {
+	switch value {
+	case "day":
+		return Day, nil
+	case "month":
+		return Month, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return Granularity{}, fmt.Errorf("invalid granularity %q, must be day, month or a positive duration such as 1h", value)
+	}
+	return GranularityOf(duration), nil
+}
+
+// Granularity of a fixed duration, a whole day being a calendar day
+func GranularityOf(duration time.Duration) Granularity {
+	if duration == time.Hour*24 {
+		return Day
+	}
+	return Granularity{Duration: duration}
+}
+
+// Check if granules are shorter than a day, so boundaries carry a time of day
+func (g Granularity) SubDay() bool {
+	return g.Days == 0 && g.Months == 0 && g.Duration < time.Hour*24
+}
+
+func (g Granularity) String() string {
+	switch {
+	case g.Months > 0:
+		return fmt.Sprintf("%d month", g.Months)
+	case g.Days > 0:
+		return fmt.Sprintf("%d day", g.Days)
+	}
+	return g.Duration.String()
+}
@@ -0,0 +1,74 @@
+package periods
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseGranularity(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Granularity
+		wantErr bool
+	}{
+		{"day", Day, false},
+		{"24h", Day, false},
+		{"month", Month, false},
+		{"1h", Granularity{Duration: time.Hour}, false},
+		{"0s", Granularity{}, true},
+		{"weekly", Granularity{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGranularity(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseGranularity(%q) = %v, %v, want %v (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAddGranulesMonth(t *testing.T) {
+	tests := []struct {
+		from string
+		n    int
+		want string
+	}{
+		{"2024-01-01", 1, "2024-02-01"},
+		{"2024-03-01", -1, "2024-02-01"},
+		{"2024-11-01", 2, "2025-01-01"},
+	}
+	for _, tt := range tests {
+		if got := AddGranules(date(tt.from), tt.n, Month); !got.Equal(date(tt.want)) {
+			t.Errorf("AddGranules(%s, %d, Month) = %v, want %s", tt.from, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestProcessPeriodsMonthly(t *testing.T) {
+	input := []Period{gapTestPeriod(1, "2024-01-01", "2024-12-01", 2), gapTestPeriod(2, "2024-03-01", "2024-05-01", 1)}
+	tests := []struct {
+		name   string
+		closed bool
+		want   []string
+	}{
+		{"closed", true, []string{"1 2024-01-01..2024-02-01", "2 2024-03-01..2024-05-01", "-1 2024-06-01..2024-12-01"}},
+		{"half-open", false, []string{"1 2024-01-01..2024-03-01", "2 2024-03-01..2024-05-01", "-1 2024-05-01..2024-12-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := ProcessPeriods(slices.Clone(input), ProcessOptions{ClosedIntervals: tt.closed, Granularity: Month})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.want) {
+				t.Errorf("processed %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// months in the same end convention leave no gap
+	adjacent := []Period{gapTestPeriod(1, "2024-01-01", "2024-02-01", 1), gapTestPeriod(2, "2024-03-01", "2024-05-01", 1)}
+	if gaps := FindGaps(adjacent, ProcessOptions{ClosedIntervals: true, Granularity: Month}); len(gaps) > 0 {
+		t.Errorf("gaps between adjacent months: %q", gapSpans(gaps))
+	}
+}
@@ -0,0 +1,112 @@
+package periods
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// options controlling how periods are processed
+type ProcessOptions struct {
+	// logs decisions at debug level and problems at warn and error level, the default logger when not set
+	Logger *slog.Logger `json:"-"`
+	// abort processing on conflicts instead of only logging them
+	Strict bool
+	// end dates are inclusive, so a period ending on the day the next starts overlaps it
+	ClosedIntervals bool
+	// boundary shifts skip weekends and holidays (keyed by "2006-01-02")
+	BusinessDaysOnly bool
+	Holidays         map[string]bool
+	// adjusted boundaries are snapped to the nearest day boundary counted from the grid epoch
+	SnapToGrid bool
+	GridEpoch  time.Time
+	// time of day at which day buckets start, used in snapping and business day checks
+	DayAnchor time.Duration
+	// step boundaries are shifted by when adjusting and splitting, a day when not set
+	Granularity Granularity
+	// overlaps up to the tolerance are treated as adjacent periods, per product tolerance overrides the default
+	OverlapTolerance        time.Duration
+	ProductOverlapTolerance map[int]time.Duration
+	// algorithm resolving overlaps of a product, pairwise when not set
+	Resolver Resolver `json:"-"`
+	// deciding between periods of equal priority: "id", "price", "source" or earlier start by default,
+	// sources rank in configured order
+	TieBreak   string
+	SourceRank map[string]int
+	// custom rule deciding the winner of an overlap, lower priority number wins when not set
+	ResolutionRule ResolutionRule `json:"-"`
+	// records decisions for a single product when set
+	Trace *DecisionTrace `json:"-"`
+	// records why periods were removed when set
+	Removals *RemovalLog `json:"-"`
+	// counts resolver loop iterations when set
+	Iterations *int `json:"-"`
+	// adds up per product operation counts when set
+	Stats ProductStatsByProd `json:"-"`
+	// numbers split fragments down from -1, shared across calls when set so products processed
+	// one at a time get distinct fragment IDs
+	SplitIDs *int `json:"-"`
+	// products resolved concurrently, all CPUs when not set
+	Workers int
+	// abort a product that splits periods more often than this, likely bad data (0 means no cap)
+	MaxSplitsPerProduct int
+	// context of the processing run, set by ProcessPeriodsContext
+	ctx context.Context
+}
+
+// Error of the processing run's context once it is done, checked by resolvers as they go
+func (opts ProcessOptions) cancelled() error {
+	if opts.ctx == nil {
+		return nil
+	}
+	return opts.ctx.Err()
+}
+
+// resolver iterations allowed per input period of a product: resolving takes a step per period and one
+// per resume of a suspended period, so only a resolver that stops making progress reaches it
+const iterationsPerPeriod = 4
+
+// Check the resolver iterations of a product of n input periods against the no-progress cap
+func checkIterations(prodNum, n, iterations int) error {
+	if limit := iterationsPerPeriod*n + 16; iterations > limit {
+		return fmt.Errorf("prodnum %d made no progress resolving %d periods in %d iterations, check its data for cyclic overlaps", prodNum, n, limit)
+	}
+	return nil
+}
+
+// Check the number of splits of a product against the cap
+func (opts ProcessOptions) checkSplits(prodNum, splits int) error {
+	if opts.MaxSplitsPerProduct > 0 && splits > opts.MaxSplitsPerProduct {
+		return fmt.Errorf("prodnum %d generated more than %d split periods, check its data for nested overlaps", prodNum, opts.MaxSplitsPerProduct)
+	}
+	return nil
+}
+
+// Overlap tolerance for a product, falling back to the default tolerance
+func (opts ProcessOptions) toleranceFor(prodNum int) time.Duration {
+	if tolerance, ok := opts.ProductOverlapTolerance[prodNum]; ok {
+		return tolerance
+	}
+	return opts.OverlapTolerance
+}
+
+// Logger of processing, the default logger when not set
+func (opts ProcessOptions) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// Step between adjacent boundaries, a day unless configured
+func (opts ProcessOptions) Granule() Granularity {
+	g := opts.Granularity
+	if g.Days > 0 || g.Months > 0 {
+		return g
+	}
+	if g.Duration <= 0 {
+		return Day
+	}
+	return GranularityOf(g.Duration)
+}
@@ -0,0 +1,51 @@
+package periods
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckIterations(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          int
+		iterations int
+		wantErr    bool
+	}{
+		{"empty product at cap", 0, 16, false},
+		{"empty product over cap", 0, 17, true},
+		{"at cap", 1000, iterationsPerPeriod*1000 + 16, false},
+		{"over cap", 1000, iterationsPerPeriod*1000 + 17, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkIterations(1, tt.n, tt.iterations); (err != nil) != tt.wantErr {
+				t.Errorf("checkIterations(1, %d, %d) = %v, want error %v", tt.n, tt.iterations, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPairwiseIterationsWithinCap(t *testing.T) {
+	const n = 3000
+	base := date("2024-01-01")
+	nested := make([]Period, n)
+	chained := make([]Period, n)
+	for i := range n {
+		// each period inside the previous one and winning over it, so every period is split
+		nested[i] = Period{ID: i + 1, ProdNum: 1, PeriodStart: base.AddDate(0, 0, i), PeriodEnd: base.AddDate(0, 0, 2*n-i), PeriodPriority: n - i}
+		// each period overlapping the next, every other one winning
+		chained[i] = Period{ID: i + 1, ProdNum: 1, PeriodStart: base.AddDate(0, 0, 2*i), PeriodEnd: base.AddDate(0, 0, 2*i+3), PeriodPriority: 1 + i%2}
+	}
+	for name, input := range map[string][]Period{"nested": nested, "chained": chained} {
+		t.Run(name, func(t *testing.T) {
+			iterations := 0
+			if _, err := ProcessPeriods(slices.Clone(input), ProcessOptions{Iterations: &iterations}); err != nil {
+				t.Fatal(err)
+			}
+			if limit := iterationsPerPeriod*n + 16; iterations == 0 || iterations > limit {
+				t.Errorf("%d iterations for %d periods, cap is %d", iterations, n, limit)
+			}
+		})
+	}
+}
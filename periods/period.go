@@ -0,0 +1,110 @@
+// Package periods holds the pricing period domain types and the logic flattening overlapping periods
+package periods
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// object corresponding to a row of data returned from db, the json names are part of the output formats
+type Period struct {
+	ID             int       `json:"ID"`
+	PeriodStart    time.Time `json:"PeriodStart"`
+	PeriodEnd      time.Time `json:"PeriodEnd"`
+	Price          Price     `json:"Price"`
+	ProdNum        int       `json:"ProdNum"`
+	PeriodPriority int       `json:"PeriodPriority"`
+	// ID of the period a split fragment was cut from, 0 for periods that were not split
+	ParentID int `json:"ParentID,omitempty"`
+	// name of the source the period was fetched from, when multiple sources are configured
+	Source string `json:"Source,omitempty"`
+	// optional passthrough of the Metadata JSON column, not used in processing
+	Metadata map[string]any `json:"Metadata,omitempty"`
+	// price was NULL in the db, resolved by the null price policy after fetch
+	PriceNull bool `json:"-"`
+}
+
+// ID of the source period this period was resolved from
+func (p Period) SourceID() int {
+	if p.ParentID != 0 {
+		return p.ParentID
+	}
+	return p.ID
+}
+
+// Sort periods by ProdNum, then PeriodStart, then PeriodPriority, then ID
+func SortPeriods(periods []Period) {
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].ProdNum != periods[j].ProdNum {
+			return periods[i].ProdNum < periods[j].ProdNum
+		}
+		if !periods[i].PeriodStart.Equal(periods[j].PeriodStart) {
+			return periods[i].PeriodStart.Before(periods[j].PeriodStart)
+		}
+		if periods[i].PeriodPriority != periods[j].PeriodPriority {
+			return periods[i].PeriodPriority < periods[j].PeriodPriority
+		}
+		// tie on ID so equal periods always come out in the same order
+		return periods[i].ID < periods[j].ID
+	})
+}
+
+// Check if two periods of the same product overlap
+func Overlaps(a, b Period, closed bool) bool {
+	if a.ProdNum != b.ProdNum {
+		return false
+	}
+	if closed {
+		return !a.PeriodEnd.Before(b.PeriodStart) && !b.PeriodEnd.Before(a.PeriodStart)
+	}
+	return a.PeriodEnd.After(b.PeriodStart) && b.PeriodEnd.After(a.PeriodStart)
+}
+
+// Count distinct days covered by periods per product (period ends are inclusive days)
+func coverageDays(periods []Period) map[int]int {
+	sorted := slices.Clone(periods)
+	SortPeriods(sorted)
+	coverage := make(map[int]int)
+	day := time.Hour * 24
+	for i := 0; i < len(sorted); {
+		// merge run of overlapping or touching periods of one product into a single covered range
+		prodNum := sorted[i].ProdNum
+		start, end := sorted[i].PeriodStart, sorted[i].PeriodEnd
+		i++
+		for i < len(sorted) && sorted[i].ProdNum == prodNum && !sorted[i].PeriodStart.After(end.AddDate(0, 0, 1)) {
+			if sorted[i].PeriodEnd.After(end) {
+				end = sorted[i].PeriodEnd
+			}
+			i++
+		}
+		if !end.Before(start) {
+			// rounded, a range over a DST change is an hour short of or over whole days
+			coverage[prodNum] += int((end.Sub(start)+day/2)/day) + 1
+		}
+	}
+	return coverage
+}
+
+// Check that no two periods of a product still overlap, in whole granules with the overlap
+// tolerance applied like in processing, naming the first offending pair; zero length periods
+// (ending on their start in half-open mode) cover nothing and overlap nothing
+func AssertNoOverlaps(periods []Period, opts ProcessOptions) error {
+	sorted := slices.DeleteFunc(slices.Clone(periods), func(p Period) bool {
+		return !opts.ClosedIntervals && !p.PeriodEnd.After(p.PeriodStart)
+	})
+	SortPeriods(sorted)
+	for i := 0; i+1 < len(sorted); i++ {
+		current, next := sorted[i], sorted[i+1]
+		if current.ProdNum != next.ProdNum {
+			continue
+		}
+		if overlapsDay(current.PeriodEnd, next.PeriodStart.Add(opts.toleranceFor(current.ProdNum)), opts) {
+			return fmt.Errorf("prodnum %d: period id %d (%s to %s) overlaps period id %d (%s to %s)", current.ProdNum,
+				current.ID, current.PeriodStart.Format("2006-01-02"), current.PeriodEnd.Format("2006-01-02"),
+				next.ID, next.PeriodStart.Format("2006-01-02"), next.PeriodEnd.Format("2006-01-02"))
+		}
+	}
+	return nil
+}
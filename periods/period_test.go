@@ -0,0 +1,44 @@
+package periods
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssertNoOverlaps(t *testing.T) {
+	period := func(id int, start, end string) Period {
+		return Period{ID: id, ProdNum: 1, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: 1}
+	}
+	otherProduct := period(3, "2024-01-05", "2024-01-20")
+	otherProduct.ProdNum = 2
+	tests := []struct {
+		name      string
+		closed    bool
+		tolerance time.Duration
+		periods   []Period
+		wantIDs   string // the offending pair named in the error, empty when none
+	}{
+		{"adjacent half-open", false, 0, []Period{period(1, "2024-01-01", "2024-01-10"), period(2, "2024-01-10", "2024-01-20")}, ""},
+		{"shared end day closed", true, 0, []Period{period(1, "2024-01-01", "2024-01-10"), period(2, "2024-01-10", "2024-01-20")}, "id 1 (2024-01-01 to 2024-01-10) overlaps period id 2"},
+		{"adjacent closed", true, 0, []Period{period(1, "2024-01-01", "2024-01-09"), period(2, "2024-01-10", "2024-01-20")}, ""},
+		{"overlap", false, 0, []Period{period(2, "2024-01-05", "2024-01-20"), period(1, "2024-01-01", "2024-01-10")}, "id 1 (2024-01-01 to 2024-01-10) overlaps period id 2"},
+		{"other product", false, 0, []Period{period(1, "2024-01-01", "2024-01-10"), otherProduct}, ""},
+		{"within tolerance", false, 48 * time.Hour, []Period{period(1, "2024-01-01", "2024-01-11"), period(2, "2024-01-10", "2024-01-20")}, ""},
+		{"zero length half-open", false, 0, []Period{period(1, "2024-01-01", "2024-01-20"), period(2, "2024-01-05", "2024-01-05")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AssertNoOverlaps(tt.periods, ProcessOptions{ClosedIntervals: tt.closed, OverlapTolerance: tt.tolerance})
+			if tt.wantIDs == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantIDs) {
+				t.Errorf("error %v, want one naming %q", err, tt.wantIDs)
+			}
+		})
+	}
+}
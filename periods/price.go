@@ -0,0 +1,108 @@
+package periods
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// price in ten-thousandths, the scale of SQL Server money, kept as a fixed-point integer so prices
+// read from decimal and money columns are exact instead of picking up binary float artifacts
+type Price int64
+
+// number of Price units in 1
+const priceScale = 10000
+
+// Parse a decimal price like "19.99" or "-0.5", more than four decimals are rejected unless they are zeros
+func ParsePrice(s string) (Price, error) {
+	text := strings.TrimSpace(s)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "-"), "+")
+	whole, fraction, _ := strings.Cut(text, ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if whole == "" && fraction == "" || len(fraction) > 4 {
+		return 0, fmt.Errorf("invalid price %q: expected a decimal with at most 4 decimals", s)
+	}
+	fraction += strings.Repeat("0", 4-len(fraction))
+	digits := strings.TrimLeft(whole, "0") + fraction
+	units, err := strconv.ParseInt("0"+digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q: expected a decimal with at most 4 decimals", s)
+	}
+	if negative {
+		units = -units
+	}
+	return Price(units), nil
+}
+
+// Price nearest to f, for sources that only have a float
+func PriceFromFloat(f float64) Price {
+	return Price(math.Round(f * priceScale))
+}
+
+// Price as a float, for outputs that store numbers as floats anyway (spreadsheets)
+func (p Price) Float64() float64 {
+	return float64(p) / priceScale
+}
+
+// Format with two decimals, or as many more as the price has (up to four)
+func (p Price) String() string {
+	units := int64(p)
+	sign := ""
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	text := fmt.Sprintf("%s%d.%04d", sign, units/priceScale, units%priceScale)
+	// drop the third and fourth decimal when they are zeros
+	for i := 0; i < 2 && strings.HasSuffix(text, "0"); i++ {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// Read a price column: decimal and money columns arrive as text and are parsed exactly,
+// integer columns are whole prices and float columns are rounded to the nearest unit
+func (p *Price) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case []byte:
+		*p, err = ParsePrice(string(v))
+	case string:
+		*p, err = ParsePrice(v)
+	case int64:
+		*p = Price(v * priceScale)
+	case float64:
+		*p = PriceFromFloat(v)
+	case nil:
+		*p = 0
+	default:
+		err = fmt.Errorf("unsupported price type %T", src)
+	}
+	return err
+}
+
+// Write the price as decimal text, converted by the server without going through float
+func (p Price) Value() (driver.Value, error) {
+	return p.String(), nil
+}
+
+// Marshal as a JSON number with the exact decimal digits
+func (p Price) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Unmarshal a JSON number (or quoted number) without going through float
+func (p *Price) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" {
+		return nil
+	}
+	price, err := ParsePrice(text)
+	if err != nil {
+		return err
+	}
+	*p = price
+	return nil
+}
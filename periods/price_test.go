@@ -0,0 +1,83 @@
+package periods
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Price
+		text    string
+		wantErr bool
+	}{
+		{"19.99", 199900, "19.99", false},
+		{"19.9899", 199899, "19.9899", false},
+		{"-0.5", -5000, "-0.50", false},
+		{" 7 ", 70000, "7.00", false},
+		{".25", 2500, "0.25", false},
+		{"1.230000", 12300, "1.23", false},
+		{"1.23456", 0, "", true},
+		{"", 0, "", true},
+		{"abc", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePrice(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want || got.String() != tt.text {
+				t.Errorf("ParsePrice = %d (%s), want %d (%s)", got, got, tt.want, tt.text)
+			}
+		})
+	}
+}
+
+func TestPriceScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  any
+		want string
+	}{
+		// decimal and money columns arrive as text and are read without a float in between
+		{"decimal text", []byte("19.9900"), "19.99"},
+		{"string", "0.1", "0.10"},
+		{"integer", int64(12), "12.00"},
+		{"float rounded", 19.989999999, "19.99"},
+		{"null", nil, "0.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Price
+			if err := p.Scan(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			if p.String() != tt.want {
+				t.Errorf("scanned %s, want %s", p, tt.want)
+			}
+		})
+	}
+	var p Price
+	if err := p.Scan(true); err == nil {
+		t.Error("no error scanning a bool")
+	}
+}
+
+func TestPriceJSON(t *testing.T) {
+	var band struct{ Min, Max Price }
+	if err := json.Unmarshal([]byte(`{"Min": 9.99, "Max": "20"}`), &band); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(band)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Min":9.99,"Max":20.00}`; string(data) != want {
+		t.Errorf("round trip %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,361 @@
+package periods
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// conflicts left unresolved by a best-effort run, the processed periods are complete but may still overlap
+type ConflictsError struct {
+	Conflicts []error
+}
+
+func (e *ConflictsError) Error() string {
+	return fmt.Sprintf("%d unresolved conflicts:\n%v", len(e.Conflicts), errors.Join(e.Conflicts...))
+}
+
+func (e *ConflictsError) Unwrap() []error {
+	return e.Conflicts
+}
+
+// Flatten overlapping periods, each product's periods are resolved by the configured resolver,
+// products concurrently, the output is sorted so it does not depend on scheduling;
+// unresolved conflicts are returned as a *ConflictsError along with the best-effort output
+func ProcessPeriods(periods []Period, opts ProcessOptions) ([]Period, error) {
+	return ProcessPeriodsContext(context.Background(), periods, opts)
+}
+
+// ProcessPeriods until ctx is done: resolvers stop within a product and products not started are skipped,
+// the ctx error is returned with the periods resolved up to the first product it stopped
+func ProcessPeriodsContext(ctx context.Context, periods []Period, opts ProcessOptions) ([]Period, error) {
+	opts.ctx = ctx
+	resolver := opts.Resolver
+	if resolver == nil {
+		resolver = PairwiseResolver{}
+	}
+
+	// debug mode: keep input coverage to check no days were lost or gained
+	logger := opts.logger()
+	debug := logger.Enabled(context.Background(), slog.LevelDebug)
+	var inputCoverage map[int]int
+	if debug {
+		inputCoverage = coverageDays(periods)
+	}
+
+	SortPeriods(periods)
+
+	// products are resolved independently, periods are sorted by product first
+	var products [][]Period
+	for start := 0; start < len(periods); {
+		end := start + 1
+		for end < len(periods) && periods[end].ProdNum == periods[start].ProdNum {
+			end++
+		}
+		products = append(products, periods[start:end:end])
+		start = end
+	}
+	results := resolveProducts(products, resolver, opts)
+
+	// merge in product order, up to the first failed product like a serial run,
+	// products with conflicts are kept and their conflicts aggregated
+	processed := make([]Period, 0, len(periods))
+	var err error
+	var conflicts []error
+	for i, result := range results {
+		processed = append(processed, result.periods...)
+		if opts.Removals != nil {
+			opts.Removals.Removals = append(opts.Removals.Removals, result.removals.Removals...)
+		}
+		if opts.Iterations != nil {
+			*opts.Iterations += result.iterations
+		}
+		if opts.Stats != nil {
+			opts.Stats.add(products[i][0].ProdNum, result.stats)
+		}
+		var conflictsErr *ConflictsError
+		if errors.As(result.err, &conflictsErr) {
+			conflicts = append(conflicts, conflictsErr.Conflicts...)
+		} else if result.err != nil {
+			err = result.err
+			break
+		}
+	}
+	SortPeriods(processed)
+	numberSplits(processed, opts.SplitIDs)
+	if err != nil {
+		return processed, err
+	}
+
+	if debug {
+		outputCoverage := coverageDays(processed)
+		for prodNum, days := range inputCoverage {
+			if outputCoverage[prodNum] != days {
+				logger.Warn("coverage changed by processing", "prodnum", prodNum, "daysBefore", days, "daysAfter", outputCoverage[prodNum])
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return processed, &ConflictsError{Conflicts: conflicts}
+	}
+	return processed, nil
+}
+
+// Give split fragments IDs of their own: the first period of an ID keeps it, further ones get negative IDs
+// counting down from the counter, which never collide with source IDs, and keep the source ID as ParentID
+func numberSplits(processed []Period, counter *int) {
+	if counter == nil {
+		counter = new(int)
+	}
+	seen := make(map[int]bool, len(processed))
+	for i, p := range processed {
+		if seen[p.ID] {
+			*counter--
+			processed[i].ParentID = p.ID
+			processed[i].ID = *counter
+			continue
+		}
+		seen[p.ID] = true
+	}
+}
+
+// Period as a group of log attributes
+func periodAttr(key string, p Period) slog.Attr {
+	return slog.Group(key, "id", p.ID, "start", isoDate(p.PeriodStart), "end", isoDate(p.PeriodEnd), "priority", p.PeriodPriority)
+}
+
+func isoDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// Check a resolved product for overlaps the resolver left behind, where snapping or skipping non-business days
+// moved a cut boundary into the winning period: an error in strict mode, otherwise a conflict of the best-effort run
+func checkResolved(resolved []Period, opts ProcessOptions) error {
+	err := AssertNoOverlaps(resolved, opts)
+	if err == nil {
+		return nil
+	}
+	opts.logger().Error("unresolved conflict", "err", err)
+	if opts.Strict {
+		return err
+	}
+	return &ConflictsError{Conflicts: []error{err}}
+}
+
+// resolution of a single product, with the removals, iterations and stats it recorded
+type productResult struct {
+	periods    []Period
+	err        error
+	removals   RemovalLog
+	iterations int
+	stats      ProductStats
+}
+
+// Resolve each product on a pool of opts.Workers goroutines (all CPUs when not set),
+// debug mode resolves serially so its output follows product order
+func resolveProducts(products [][]Period, resolver Resolver, opts ProcessOptions) []productResult {
+	results := make([]productResult, len(products))
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if opts.logger().Enabled(context.Background(), slog.LevelDebug) {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(products)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if results[i].err = opts.cancelled(); results[i].err != nil {
+					continue
+				}
+				// shared collectors are written per product and merged afterwards,
+				// the trace only records one product so only one worker writes to it
+				productOpts := opts
+				if opts.Removals != nil {
+					productOpts.Removals = &results[i].removals
+				}
+				if opts.Iterations != nil {
+					productOpts.Iterations = &results[i].iterations
+				}
+				// input side counted before the resolver reorders the product in place
+				var inputIDs []int
+				if opts.Stats != nil {
+					results[i].stats = inputStats(products[i], opts)
+					inputIDs = make([]int, len(products[i]))
+					for j, p := range products[i] {
+						inputIDs[j] = p.ID
+					}
+				}
+				results[i].periods, results[i].err = resolver.Resolve(products[i], productOpts)
+				if results[i].err == nil {
+					results[i].err = checkResolved(results[i].periods, opts)
+				}
+				if opts.Stats != nil {
+					results[i].stats.countOutput(inputIDs, results[i].periods)
+				}
+			}
+		}()
+	}
+	for i := range products {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// Resolve overlaps in a single left-to-right pass over the periods sorted by start: the period owning the
+// sweep position (current) is compared with each next period that overlaps it, the loser of the pair is
+// truncated, split or removed where the winner covers it, and a beaten period with granules still ahead is
+// suspended until the winner ends, nothing is ever resorted or compared again from the start
+func (PairwiseResolver) Resolve(product []Period, opts ProcessOptions) ([]Period, error) {
+	if len(product) < 2 {
+		return product, nil
+	}
+	logger := opts.logger()
+	SortPeriods(product)
+	cut := newFragments(product, opts)
+	// periods beaten while still running, resumed best first once the period that beat them ends
+	suspended := &dominanceHeap{product: product, opts: opts}
+	// the period that beat each one last, the survivor named when it is left with no granules
+	beatenBy := make([]int, len(product))
+	for i := range beatenBy {
+		beatenBy[i] = -1
+	}
+	current, from := -1, time.Time{}
+	iterations := 0
+	step := func() error {
+		iterations++
+		if opts.Iterations != nil {
+			*opts.Iterations++
+		}
+		if suspended.err != nil {
+			return suspended.err
+		}
+		if err := opts.cancelled(); err != nil {
+			return err
+		}
+		return checkIterations(product[0].ProdNum, len(product), iterations)
+	}
+	// current is final up to its end: emit its rest and hand the sweep position to the best suspended
+	// period still running there
+	finish := func() error {
+		end := cut.end(current)
+		if err := cut.emit(current, from, end); err != nil {
+			return err
+		}
+		current = -1
+		for suspended.Len() > 0 {
+			if err := step(); err != nil {
+				return err
+			}
+			i := heap.Pop(suspended).(int)
+			if cut.end(i).After(end) {
+				current, from = i, end
+				logger.Debug("resuming suspended period", "prodnum", product[i].ProdNum, periodAttr("period", product[i]), "from", isoDate(from))
+				break
+			}
+		}
+		return suspended.err
+	}
+
+	for n, next := range product {
+		if err := step(); err != nil {
+			return cut.out, err
+		}
+		if !cut.end(n).After(next.PeriodStart) {
+			// covers no granule, overlaps nothing
+			cut.out = append(cut.out, next)
+			continue
+		}
+		// overlap within tolerance is not an overlap: current keeps its end and next its start
+		overlapStart := next.PeriodStart.Add(opts.toleranceFor(next.ProdNum))
+		for current >= 0 && !overlapsDay(product[current].PeriodEnd, overlapStart, opts) {
+			logger.Debug("no overlap", "currentEnd", isoDate(product[current].PeriodEnd), "nextStart", isoDate(next.PeriodStart))
+			if err := finish(); err != nil {
+				return cut.out, err
+			}
+		}
+		if current == -1 {
+			current, from = n, next.PeriodStart
+			continue
+		}
+		c := product[current]
+		logger.Debug("overlap detected", "prodnum", c.ProdNum, periodAttr("current", c), periodAttr("next", next), "from", isoDate(from))
+		currentWins, err := dominates(c, next, opts)
+		if err != nil {
+			return cut.out, err
+		}
+		coincident := c.PeriodStart.Equal(next.PeriodStart) && c.PeriodEnd.Equal(next.PeriodEnd)
+		if coincident {
+			opts.Trace.record("coincident", c, next)
+		} else if opts.ResolutionRule == nil && c.PeriodPriority == next.PeriodPriority {
+			// equal priority: the configured tie break decided, by default the earlier start
+			// (current, as periods are sorted by start) and on the same start the lower ID wins
+			opts.Trace.record("tie break", c, next)
+		}
+		endsAfterNext := cut.end(current).After(cut.end(n))
+		if currentWins {
+			logger.Debug("current period has higher priority", "kept", c.ID)
+			beatenBy[n] = current
+			switch {
+			case coincident:
+			case endsAfterNext || cut.end(current).Equal(cut.end(n)):
+				opts.Trace.record("remove next", c, next)
+			default:
+				// next resumes right after current ends
+				opts.Trace.record("shift next", c, next)
+			}
+			heap.Push(suspended, n)
+			continue
+		}
+		logger.Debug("current period has lower priority", "kept", next.ID)
+		// current keeps the granules before next starts, and resumes after next when it runs longer
+		hasLeadingPart := from.Before(next.PeriodStart) || cut.count[current] > 0
+		switch {
+		case coincident:
+		case hasLeadingPart && endsAfterNext:
+			opts.Trace.record("split current", c, next)
+		case hasLeadingPart:
+			opts.Trace.record("truncate current", c, next)
+		case endsAfterNext:
+			opts.Trace.record("shift current", c, next)
+		default:
+			opts.Trace.record("remove current", c, next)
+		}
+		if err := cut.emit(current, from, next.PeriodStart); err != nil {
+			return cut.out, err
+		}
+		beatenBy[current] = n
+		heap.Push(suspended, current)
+		current, from = n, next.PeriodStart
+	}
+	for current >= 0 {
+		if err := finish(); err != nil {
+			return cut.out, err
+		}
+	}
+	// periods beaten wherever they ran are removed
+	for i, p := range product {
+		if cut.count[i] > 0 || beatenBy[i] == -1 {
+			continue
+		}
+		survivor := product[beatenBy[i]]
+		reason := "contained in higher priority period"
+		if p.PeriodStart.Equal(survivor.PeriodStart) && p.PeriodEnd.Equal(survivor.PeriodEnd) {
+			reason = "coincident with higher priority period"
+		}
+		logger.Debug("period removed", "prodnum", p.ProdNum, periodAttr("removed", p), "survivor", survivor.ID, "reason", reason)
+		opts.Removals.record(p, survivor, reason)
+	}
+	return cut.out, nil
+}
@@ -0,0 +1,973 @@
+package periods
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Parse a "YYYY-MM-DD" or "YYYY-MM-DD hh:mm" UTC time
+func date(s string) time.Time {
+	layout := "2006-01-02"
+	if len(s) > len(layout) {
+		layout = "2006-01-02 15:04"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Periods as "id start..end" lines in output order, compact enough to compare whole results
+func spans(list []Period) []string {
+	out := make([]string, len(list))
+	for i, p := range list {
+		out[i] = fmt.Sprintf("%d %s..%s", p.ID, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"))
+	}
+	return out
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		name         string
+		a, b         Period
+		closed, want bool
+	}{
+		{"inside", Period{ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31")}, Period{ProdNum: 1, PeriodStart: date("2024-01-15"), PeriodEnd: date("2024-01-20")}, false, true},
+		{"shared boundary half-open", Period{ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-10")}, Period{ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20")}, false, false},
+		{"shared boundary closed", Period{ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-10")}, Period{ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20")}, true, true},
+		{"other product", Period{ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31")}, Period{ProdNum: 2, PeriodStart: date("2024-01-15"), PeriodEnd: date("2024-01-20")}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Overlaps(tt.a, tt.b, tt.closed); got != tt.want {
+				t.Errorf("overlaps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlapsDay(t *testing.T) {
+	tests := []struct {
+		name       string
+		end, start string
+		closed     bool
+		want       bool
+	}{
+		{"same day boundary closed", "2024-01-10", "2024-01-10", true, true},
+		{"same day boundary half-open", "2024-01-10", "2024-01-10", false, false},
+		{"end within the start day half-open", "2024-01-10 12:00", "2024-01-10", false, true},
+		{"one day gap closed", "2024-01-09", "2024-01-10", true, false},
+		{"one day gap half-open", "2024-01-09", "2024-01-10", false, false},
+		{"equal start and end closed", "2024-01-10", "2024-01-01", true, true},
+		{"equal start and end half-open", "2024-01-10", "2024-01-01", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overlapsDay(date(tt.end), date(tt.start), ProcessOptions{ClosedIntervals: tt.closed}); got != tt.want {
+				t.Errorf("overlapsDay(%s, %s) = %v, want %v", tt.end, tt.start, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdjacentBoundaries(t *testing.T) {
+	tests := []struct {
+		name                  string
+		closed                bool
+		granularity           time.Duration
+		boundary              string
+		wantBefore, wantAfter string
+	}{
+		{"closed days", true, 0, "2024-01-10", "2024-01-09", "2024-01-11"},
+		{"half-open days", false, 0, "2024-01-10", "2024-01-10", "2024-01-10"},
+		{"closed hours", true, time.Hour, "2024-01-10 05:00", "2024-01-10 04:00", "2024-01-10 06:00"},
+		{"half-open hours", false, time.Hour, "2024-01-10 05:00", "2024-01-10 05:00", "2024-01-10 05:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ProcessOptions{ClosedIntervals: tt.closed, Granularity: GranularityOf(tt.granularity)}
+			if got := endBefore(date(tt.boundary), opts); !got.Equal(date(tt.wantBefore)) {
+				t.Errorf("endBefore(%s) = %v, want %s", tt.boundary, got, tt.wantBefore)
+			}
+			if got := startAfter(date(tt.boundary), opts); !got.Equal(date(tt.wantAfter)) {
+				t.Errorf("startAfter(%s) = %v, want %s", tt.boundary, got, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsSplitInside(t *testing.T) {
+	// a short high priority period inside a long low priority one splits it in two
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-15"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1},
+	}
+	processed, err := ProcessPeriods(input, ProcessOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("strict run aborted: %v", err)
+	}
+	want := []string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20", "-1 2024-01-20..2024-01-31"}
+	if got := spans(processed); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+}
+
+func TestProcessPeriodsCoincident(t *testing.T) {
+	tests := []struct {
+		name                 string
+		priority1, priority2 int
+		wantID               int
+		wantPrice            Price
+	}{
+		{"higher priority listed first", 1, 2, 1, 10 * priceScale},
+		{"higher priority listed second", 2, 1, 2, 20 * priceScale},
+		{"equal priority keeps the lower ID", 1, 1, 1, 10 * priceScale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []Period{
+				{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: tt.priority1, Price: 10 * priceScale},
+				{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: tt.priority2, Price: 20 * priceScale},
+			}
+			processed, err := ProcessPeriods(input, ProcessOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(processed) != 1 || processed[0].ID != tt.wantID || processed[0].Price != tt.wantPrice {
+				t.Errorf("processed %+v, want only period %d", processed, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestCoverageDays(t *testing.T) {
+	period := func(prodNum int, start, end string) Period {
+		return Period{ProdNum: prodNum, PeriodStart: date(start), PeriodEnd: date(end)}
+	}
+	tests := []struct {
+		name  string
+		input []Period
+		want  map[int]int
+	}{
+		{"single period", []Period{period(1, "2024-01-01", "2024-01-10")}, map[int]int{1: 10}},
+		{"overlapping periods", []Period{period(1, "2024-01-01", "2024-01-10"), period(1, "2024-01-05", "2024-01-20")}, map[int]int{1: 20}},
+		{"touching periods", []Period{period(1, "2024-01-01", "2024-01-10"), period(1, "2024-01-11", "2024-01-20")}, map[int]int{1: 20}},
+		{"a lost day", []Period{period(1, "2024-01-01", "2024-01-10"), period(1, "2024-01-12", "2024-01-20")}, map[int]int{1: 19}},
+		{"per product", []Period{period(1, "2024-01-01", "2024-01-10"), period(2, "2024-01-01", "2024-01-01")}, map[int]int{1: 10, 2: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coverageDays(tt.input); !maps.Equal(got, tt.want) {
+				t.Errorf("coverageDays = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsKeepsCoverage(t *testing.T) {
+	// the fragments either side of a split must cover every day the split period did
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-15"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 1, PeriodStart: date("2024-01-25"), PeriodEnd: date("2024-02-10"), PeriodPriority: 1},
+	}
+	want := coverageDays(input)
+	processed, err := ProcessPeriods(input, ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := coverageDays(processed); !maps.Equal(got, want) {
+		t.Errorf("processed %q covers %v days, want %v", spans(processed), got, want)
+	}
+}
+
+func TestShiftBoundaryBusinessDays(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      string
+		direction int
+		business  bool
+		holidays  map[string]bool
+		want      string
+	}{
+		{"calendar days", "2024-01-05", 1, false, nil, "2024-01-06"},
+		{"over a weekend", "2024-01-05", 1, true, nil, "2024-01-08"},
+		{"over a weekend and a holiday", "2024-01-05", 1, true, map[string]bool{"2024-01-08": true}, "2024-01-09"},
+		{"back over a weekend", "2024-01-08", -1, true, nil, "2024-01-05"},
+		{"weekday", "2024-01-08", 1, true, nil, "2024-01-09"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ProcessOptions{BusinessDaysOnly: tt.business, Holidays: tt.holidays}
+			if got := ShiftBoundary(date(tt.from), tt.direction, opts); !got.Equal(date(tt.want)) {
+				t.Errorf("shiftBoundary = %s, want %s", got.Format("2006-01-02"), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsBusinessDays(t *testing.T) {
+	// the winner ends on a Friday, so the loser resumes on the first business day after
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-12"), PeriodPriority: 1},
+	}
+	processed, err := ProcessPeriods(input, ProcessOptions{ClosedIntervals: true, BusinessDaysOnly: true, Holidays: map[string]bool{"2024-01-15": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-12", "-1 2024-01-16..2024-01-31"}
+	if got := spans(processed); !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+}
+
+func TestProcessPeriodsProductOverlapTolerance(t *testing.T) {
+	// the first period runs half an hour into the second; overlaps are checked in whole days,
+	// so only a tolerance of a day keeps it off the second period's day for product 1
+	var input []Period
+	for _, prodNum := range []int{1, 2} {
+		input = append(input,
+			Period{ID: prodNum*10 + 1, ProdNum: prodNum, PeriodStart: date("2024-01-01 00:00"), PeriodEnd: date("2024-01-10 00:30"), PeriodPriority: 2},
+			Period{ID: prodNum*10 + 2, ProdNum: prodNum, PeriodStart: date("2024-01-10 00:00"), PeriodEnd: date("2024-01-20 00:00"), PeriodPriority: 1})
+	}
+	opts := ProcessOptions{ProductOverlapTolerance: map[int]time.Duration{1: 24 * time.Hour}}
+	processed, err := ProcessPeriods(input, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ends := map[int]time.Time{}
+	for _, p := range processed {
+		ends[p.ID] = p.PeriodEnd
+	}
+	if want := date("2024-01-10 00:30"); !ends[11].Equal(want) {
+		t.Errorf("tolerant product: period 11 ends %v, want it untouched at %v", ends[11], want)
+	}
+	if want := date("2024-01-10 00:00"); !ends[21].Equal(want) {
+		t.Errorf("strict product: period 21 ends %v, want it truncated to %v", ends[21], want)
+	}
+}
+
+func TestSnapToGrid(t *testing.T) {
+	epoch := date("2024-01-01 06:00")
+	tests := []struct{ in, want string }{
+		{"2024-01-05 06:00", "2024-01-05 06:00"},
+		{"2024-01-05 09:00", "2024-01-05 06:00"},
+		{"2024-01-05 19:00", "2024-01-06 06:00"},
+		{"2023-12-20 05:00", "2023-12-20 06:00"},
+	}
+	for _, tt := range tests {
+		if got := SnapToGrid(date(tt.in), epoch, 24*time.Hour); !got.Equal(date(tt.want)) {
+			t.Errorf("SnapToGrid(%s) = %v, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestProcessPeriodsSnapsAdjustedBoundaries(t *testing.T) {
+	// boundaries off the noon grid, adjusted several times over a chain of overlaps with inclusive ends
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01 03:00"), PeriodEnd: date("2024-02-28 03:00"), PeriodPriority: 3},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10 03:00"), PeriodEnd: date("2024-01-20 03:00"), PeriodPriority: 2},
+		{ID: 3, ProdNum: 1, PeriodStart: date("2024-01-15 03:00"), PeriodEnd: date("2024-01-25 03:00"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 1, PeriodStart: date("2024-02-01 03:00"), PeriodEnd: date("2024-02-05 03:00"), PeriodPriority: 1},
+	}
+	inputBoundaries := map[time.Time]bool{}
+	for _, p := range input {
+		inputBoundaries[p.PeriodStart], inputBoundaries[p.PeriodEnd] = true, true
+	}
+	epoch := date("2024-01-01 12:00")
+	processed, err := ProcessPeriods(input, ProcessOptions{ClosedIntervals: true, SnapToGrid: true, GridEpoch: epoch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var adjusted int
+	for _, p := range processed {
+		for _, boundary := range []time.Time{p.PeriodStart, p.PeriodEnd} {
+			if inputBoundaries[boundary] {
+				continue
+			}
+			adjusted++
+			if boundary.Sub(epoch)%(24*time.Hour) != 0 {
+				t.Errorf("adjusted boundary %v is off the grid", boundary)
+			}
+		}
+	}
+	if adjusted < 4 {
+		t.Errorf("processed %q adjusted %d boundaries, want several", spans(processed), adjusted)
+	}
+}
+
+func TestProcessPeriodsEarlierLowerPriorityEndingTogether(t *testing.T) {
+	// the part of the lower priority period before the higher priority one starts is kept
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-20"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1},
+	}
+	for _, closed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("closed %v", closed), func(t *testing.T) {
+			processed, err := ProcessPeriods(slices.Clone(input), ProcessOptions{ClosedIntervals: closed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// an exclusive end falls on the start of the winner, an inclusive one on the day before
+			want := []string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}
+			if closed {
+				want = []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-20"}
+			}
+			if got := spans(processed); !slices.Equal(got, want) {
+				t.Errorf("processed %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParseDayAnchor(t *testing.T) {
+	tests := []struct {
+		anchor  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"06:30", 6*time.Hour + 30*time.Minute, false},
+		{"6am", 0, true},
+		{"25:00", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.anchor, func(t *testing.T) {
+			got, err := ParseDayAnchor(tt.anchor)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseDayAnchor = %v, %v; want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShiftBoundaryDayAnchor(t *testing.T) {
+	anchor := 6 * time.Hour
+	tests := []struct {
+		name string
+		from string
+		opts ProcessOptions
+		want string
+	}{
+		{"snapped to the anchored grid", "2024-01-03 05:00", ProcessOptions{SnapToGrid: true, GridEpoch: date("1970-01-01"), DayAnchor: anchor}, "2024-01-04 06:00"},
+		// Saturday before 06:00 is still in Friday's bucket
+		{"early Saturday is a business day", "2024-01-05 03:00", ProcessOptions{BusinessDaysOnly: true, DayAnchor: anchor}, "2024-01-06 03:00"},
+		{"Saturday bucket skipped", "2024-01-05 07:00", ProcessOptions{BusinessDaysOnly: true, DayAnchor: anchor}, "2024-01-08 07:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ShiftBoundary(date(tt.from), 1, tt.opts); !got.Equal(date(tt.want)) {
+				t.Errorf("shiftBoundary = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsLowerPriorityStartsFirst(t *testing.T) {
+	higher := Period{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1}
+	tests := []struct {
+		name   string
+		closed bool
+		// end of the lower priority period starting before the higher priority one
+		lowerEnd string
+		action   string
+		want     []string
+	}{
+		{"ends inside next closed", true, "2024-01-15", "truncate current", []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-20"}},
+		{"ends inside next half-open", false, "2024-01-15", "truncate current", []string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}},
+		{"ends with next closed", true, "2024-01-20", "truncate current", []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-20"}},
+		{"ends after next closed", true, "2024-01-31", "split current",
+			[]string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-20", "-1 2024-01-21..2024-01-31"}},
+		{"ends after next half-open", false, "2024-01-31", "split current",
+			[]string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20", "-1 2024-01-20..2024-01-31"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lower := Period{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date(tt.lowerEnd), PeriodPriority: 2}
+			trace := &DecisionTrace{ProdNum: 1}
+			processed, err := ProcessPeriods([]Period{lower, higher}, ProcessOptions{ClosedIntervals: tt.closed, Trace: trace})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.want) {
+				t.Errorf("processed %q, want %q", got, tt.want)
+			}
+			var actions []string
+			for _, event := range trace.Events {
+				actions = append(actions, event.Action)
+			}
+			if !slices.Contains(actions, tt.action) {
+				t.Errorf("trace actions %q, want %q", actions, tt.action)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsLosingSameStart(t *testing.T) {
+	// the higher price wins, so the first sorted period loses to one starting on the same day
+	higherPrice := func(current, next Period) (bool, error) { return current.Price > next.Price, nil }
+	next := Period{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-10"), Price: 10 * priceScale, PeriodPriority: 2}
+	tests := []struct {
+		name       string
+		currentEnd string
+		want       []string
+	}{
+		{"ends after next", "2024-01-31", []string{"2 2024-01-01..2024-01-10", "1 2024-01-11..2024-01-31"}},
+		{"ends within next", "2024-01-05", []string{"2 2024-01-01..2024-01-10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := Period{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date(tt.currentEnd), Price: 5 * priceScale, PeriodPriority: 1}
+			processed, err := ProcessPeriods([]Period{current, next}, ProcessOptions{ClosedIntervals: true, ResolutionRule: higherPrice})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.want) {
+				t.Errorf("processed %q, want %q", got, tt.want)
+			}
+			for _, p := range processed {
+				if p.PeriodEnd.Before(p.PeriodStart) {
+					t.Errorf("period %d inverted: %s", p.ID, spans([]Period{p}))
+				}
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsMaxSplitsPerProduct(t *testing.T) {
+	// three short winners inside one long period split it three times
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-05"), PeriodEnd: date("2024-01-06"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 1, PeriodStart: date("2024-01-12"), PeriodEnd: date("2024-01-13"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 1, PeriodStart: date("2024-01-20"), PeriodEnd: date("2024-01-21"), PeriodPriority: 1},
+	}
+	tests := []struct {
+		name      string
+		maxSplits int
+		wantErr   bool
+	}{
+		{"no cap", 0, false},
+		{"at the cap", 3, false},
+		{"over the cap", 2, true},
+	}
+	for _, resolver := range []Resolver{PairwiseResolver{}, SweepLineResolver{}} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%T %s", resolver, tt.name), func(t *testing.T) {
+				opts := ProcessOptions{ClosedIntervals: true, Resolver: resolver, MaxSplitsPerProduct: tt.maxSplits}
+				_, err := ProcessPeriods(slices.Clone(input), opts)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("error %v, want error %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestPairwiseMatchesResortingResolver(t *testing.T) {
+	period := func(id, prodNum int, start, end string, priority int) Period {
+		return Period{ID: id, ProdNum: prodNum, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: priority}
+	}
+	// inputs of the processing tests with the outputs of the resolver that resorted after every adjustment,
+	// the same in both interval modes unless wantClosed is set: exclusive ends meet the start of the next period
+	tests := []struct {
+		name             string
+		input            []Period
+		want, wantClosed []string
+	}{
+		{"split inside", []Period{period(1, 1, "2024-01-01", "2024-01-31", 2), period(2, 1, "2024-01-15", "2024-01-20", 1)},
+			[]string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20", "-1 2024-01-20..2024-01-31"}, []string{"1 2024-01-01..2024-01-14", "2 2024-01-15..2024-01-20", "-1 2024-01-21..2024-01-31"}},
+		{"coincident", []Period{period(1, 1, "2024-01-01", "2024-01-10", 2), period(2, 1, "2024-01-01", "2024-01-10", 1)},
+			[]string{"2 2024-01-01..2024-01-10"}, nil},
+		{"nested", []Period{period(1, 1, "2024-01-01", "2024-01-31", 3), period(2, 1, "2024-01-05", "2024-01-25", 2), period(3, 1, "2024-01-10", "2024-01-15", 1)},
+			[]string{"1 2024-01-01..2024-01-05", "2 2024-01-05..2024-01-10", "3 2024-01-10..2024-01-15", "-1 2024-01-15..2024-01-25", "-2 2024-01-25..2024-01-31"}, []string{"1 2024-01-01..2024-01-04", "2 2024-01-05..2024-01-09", "3 2024-01-10..2024-01-15", "-1 2024-01-16..2024-01-25", "-2 2024-01-26..2024-01-31"}},
+		{"chained", []Period{period(1, 1, "2024-01-01", "2024-01-10", 1), period(2, 1, "2024-01-08", "2024-01-20", 2), period(3, 1, "2024-01-18", "2024-01-31", 3)},
+			[]string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20", "3 2024-01-20..2024-01-31"}, []string{"1 2024-01-01..2024-01-10", "2 2024-01-11..2024-01-20", "3 2024-01-21..2024-01-31"}},
+		{"higher priority starts later", []Period{period(1, 1, "2024-01-01", "2024-01-20", 2), period(2, 1, "2024-01-10", "2024-01-31", 1)},
+			[]string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-31"}, []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-31"}},
+		{"lower priority ends together", []Period{period(1, 1, "2024-01-01", "2024-01-20", 2), period(2, 1, "2024-01-10", "2024-01-20", 1)},
+			[]string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}, []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-20"}},
+		{"shared boundary day", []Period{period(1, 1, "2024-01-01", "2024-01-10", 2), period(2, 1, "2024-01-10", "2024-01-20", 1)},
+			[]string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}, []string{"1 2024-01-01..2024-01-09", "2 2024-01-10..2024-01-20"}},
+		{"several splits", []Period{period(1, 1, "2024-01-01", "2024-01-31", 2), period(2, 1, "2024-01-05", "2024-01-06", 1), period(3, 1, "2024-01-12", "2024-01-13", 1), period(4, 1, "2024-01-20", "2024-01-21", 1)},
+			[]string{"1 2024-01-01..2024-01-05", "2 2024-01-05..2024-01-06", "-1 2024-01-06..2024-01-12", "3 2024-01-12..2024-01-13", "-2 2024-01-13..2024-01-20", "4 2024-01-20..2024-01-21", "-3 2024-01-21..2024-01-31"}, []string{"1 2024-01-01..2024-01-04", "2 2024-01-05..2024-01-06", "-1 2024-01-07..2024-01-11", "3 2024-01-12..2024-01-13", "-2 2024-01-14..2024-01-19", "4 2024-01-20..2024-01-21", "-3 2024-01-22..2024-01-31"}},
+		{"two products", []Period{period(1, 9, "2024-01-01", "2024-01-31", 2), period(2, 9, "2024-01-15", "2024-01-20", 1), period(3, 7, "2024-01-01", "2024-01-31", 1), period(4, 7, "2024-01-10", "2024-01-20", 2)},
+			[]string{"3 2024-01-01..2024-01-31", "1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20", "-1 2024-01-20..2024-01-31"}, []string{"3 2024-01-01..2024-01-31", "1 2024-01-01..2024-01-14", "2 2024-01-15..2024-01-20", "-1 2024-01-21..2024-01-31"}},
+		// the resorting resolver left period 3 overlapping period 1 here, once period 2 was shifted past it
+		{"shifted period overtaking a later one", []Period{period(1, 1, "2024-01-01", "2024-01-20", 1), period(2, 1, "2024-01-05", "2024-01-25", 2), period(3, 1, "2024-01-10", "2024-01-12", 3), period(4, 1, "2024-01-22", "2024-01-31", 1)},
+			[]string{"1 2024-01-01..2024-01-20", "2 2024-01-20..2024-01-22", "4 2024-01-22..2024-01-31"}, []string{"1 2024-01-01..2024-01-20", "2 2024-01-21..2024-01-21", "4 2024-01-22..2024-01-31"}},
+	}
+	for _, tt := range tests {
+		for _, closed := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s closed %v", tt.name, closed), func(t *testing.T) {
+				processed, err := ProcessPeriods(slices.Clone(tt.input), ProcessOptions{ClosedIntervals: closed})
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := tt.want
+				if closed && tt.wantClosed != nil {
+					want = tt.wantClosed
+				}
+				if got := spans(processed); !slices.Equal(got, want) {
+					t.Errorf("processed %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+// The pairwise resolver before the single sweep, resorting after every adjustment, kept as the reference the
+// resolvers are checked against: priority decides, coincident periods keep the lower ID on equal priority and split
+// fragments keep the ID of the period they come from
+func resortingResolve(list []Period, opts ProcessOptions) []Period {
+	list = slices.Clone(list)
+	SortPeriods(list)
+	for i := 0; i < len(list)-1; i++ {
+		current, next := list[i], list[i+1]
+		if current.ProdNum != next.ProdNum {
+			continue
+		}
+		if current.PeriodStart.Equal(next.PeriodStart) && current.PeriodEnd.Equal(next.PeriodEnd) {
+			if next.PeriodPriority < current.PeriodPriority || (next.PeriodPriority == current.PeriodPriority && next.ID < current.ID) {
+				list[i] = next
+			}
+			list = slices.Delete(list, i+1, i+2)
+			i--
+			continue
+		}
+		if !overlapsDay(current.PeriodEnd, next.PeriodStart, opts) {
+			continue
+		}
+		endsAfterNext := current.PeriodEnd.After(next.PeriodEnd)
+		switch {
+		case current.PeriodPriority > next.PeriodPriority && !current.PeriodStart.Before(next.PeriodStart):
+			// nothing of current comes before next: it resumes after next or is gone
+			if endsAfterNext {
+				list[i].PeriodStart = startAfter(next.PeriodEnd, opts)
+			} else {
+				list = slices.Delete(list, i, i+1)
+			}
+			SortPeriods(list)
+			i--
+			continue
+		case current.PeriodPriority > next.PeriodPriority:
+			if endsAfterNext {
+				split := current
+				split.PeriodStart = startAfter(next.PeriodEnd, opts)
+				list = slices.Insert(list, i+2, split)
+			}
+			list[i].PeriodEnd = endBefore(next.PeriodStart, opts)
+		case endsAfterNext || current.PeriodEnd.Equal(next.PeriodEnd):
+			list = slices.Delete(list, i+1, i+2)
+		default:
+			list[i+1].PeriodStart = startAfter(current.PeriodEnd, opts)
+		}
+		SortPeriods(list)
+	}
+	return list
+}
+
+func TestResolversMatchResortingReference(t *testing.T) {
+	period := func(id, prodNum int, start, end string, priority int) Period {
+		return Period{ID: id, ProdNum: prodNum, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: priority}
+	}
+	// the inputs of the processing tests, except the one the resorting resolver left overlapping
+	tests := []struct {
+		name  string
+		input []Period
+	}{
+		{"split inside", []Period{period(1, 1, "2024-01-01", "2024-01-31", 2), period(2, 1, "2024-01-15", "2024-01-20", 1)}},
+		{"coincident", []Period{period(1, 1, "2024-01-01", "2024-01-10", 2), period(2, 1, "2024-01-01", "2024-01-10", 1)}},
+		{"nested", []Period{period(1, 1, "2024-01-01", "2024-01-31", 3), period(2, 1, "2024-01-05", "2024-01-25", 2), period(3, 1, "2024-01-10", "2024-01-15", 1)}},
+		{"chained", []Period{period(1, 1, "2024-01-01", "2024-01-10", 1), period(2, 1, "2024-01-08", "2024-01-20", 2), period(3, 1, "2024-01-18", "2024-01-31", 3)}},
+		{"higher priority starts later", []Period{period(1, 1, "2024-01-01", "2024-01-20", 2), period(2, 1, "2024-01-10", "2024-01-31", 1)}},
+		{"lower priority ends together", []Period{period(1, 1, "2024-01-01", "2024-01-20", 2), period(2, 1, "2024-01-10", "2024-01-20", 1)}},
+		{"shared boundary day", []Period{period(1, 1, "2024-01-01", "2024-01-10", 2), period(2, 1, "2024-01-10", "2024-01-20", 1)}},
+		{"same start lower priority runs longer", []Period{period(1, 1, "2024-01-01", "2024-01-31", 2), period(2, 1, "2024-01-01", "2024-01-10", 1)}},
+		{"several splits", []Period{period(1, 1, "2024-01-01", "2024-01-31", 2), period(2, 1, "2024-01-05", "2024-01-06", 1), period(3, 1, "2024-01-12", "2024-01-13", 1), period(4, 1, "2024-01-20", "2024-01-21", 1)}},
+		{"two products", []Period{period(1, 9, "2024-01-01", "2024-01-31", 2), period(2, 9, "2024-01-15", "2024-01-20", 1), period(3, 7, "2024-01-01", "2024-01-31", 1), period(4, 7, "2024-01-10", "2024-01-20", 2)}},
+	}
+	// fragments are compared by the period they come from, the sweep numbers them apart
+	origins := func(list []Period) []string {
+		out := spans(list)
+		for i, p := range list {
+			if p.ParentID != 0 {
+				out[i] = fmt.Sprintf("%d %s", p.ParentID, strings.SplitN(out[i], " ", 2)[1])
+			}
+		}
+		return out
+	}
+	for _, resolver := range []Resolver{PairwiseResolver{}, SweepLineResolver{}} {
+		for _, tt := range tests {
+			for _, closed := range []bool{false, true} {
+				t.Run(fmt.Sprintf("%T %s closed %v", resolver, tt.name, closed), func(t *testing.T) {
+					opts := ProcessOptions{ClosedIntervals: closed, Resolver: resolver}
+					processed, err := ProcessPeriods(slices.Clone(tt.input), opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got, want := origins(processed), origins(resortingResolve(tt.input, opts)); !slices.Equal(got, want) {
+						t.Errorf("processed %q, resorting resolver %q", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+// Reproducible periods of a few products, whole days of one to forty days each so that periods nest,
+// chain and coincide, with few priorities so ties are common
+func randomPeriods(seed int64, n int, closed bool) []Period {
+	rng := rand.New(rand.NewSource(seed))
+	base := date("2024-01-01")
+	periods := make([]Period, n)
+	for i := range periods {
+		start := base.AddDate(0, 0, rng.Intn(120))
+		end := start.AddDate(0, 0, 1+rng.Intn(40))
+		if closed {
+			end = end.AddDate(0, 0, -1)
+		}
+		periods[i] = Period{ID: i + 1, ProdNum: 1 + rng.Intn(5), PeriodStart: start, PeriodEnd: end,
+			PeriodPriority: 1 + rng.Intn(3), Price: Price(int64(1+rng.Intn(100)) * priceScale)}
+	}
+	return periods
+}
+
+func BenchmarkProcessPeriods(b *testing.B) {
+	input := randomPeriods(1, 3000, false)
+	for _, resolver := range []Resolver{PairwiseResolver{}, SweepLineResolver{}} {
+		b.Run(fmt.Sprintf("%T", resolver), func(b *testing.B) {
+			log.SetOutput(io.Discard)
+			defer log.SetOutput(os.Stderr)
+			for i := 0; i < b.N; i++ {
+				if _, err := ProcessPeriods(slices.Clone(input), ProcessOptions{Resolver: resolver}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsHourlyGranularity(t *testing.T) {
+	// a split of hourly data resumes on the hour the winner ends
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01 00:00"), PeriodEnd: date("2024-01-01 23:00"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-01 10:00"), PeriodEnd: date("2024-01-01 12:00"), PeriodPriority: 1},
+	}
+	processed, err := ProcessPeriods(input, ProcessOptions{Granularity: GranularityOf(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range processed {
+		got = append(got, fmt.Sprintf("%d %s..%s", p.ID, p.PeriodStart.Format("15:04"), p.PeriodEnd.Format("15:04")))
+	}
+	want := []string{"1 00:00..10:00", "2 10:00..12:00", "-1 12:00..23:00"}
+	if !slices.Equal(got, want) {
+		t.Errorf("processed %q, want %q", got, want)
+	}
+}
+
+func TestSortPeriodsDeterministic(t *testing.T) {
+	// same product, start and priority throughout but the last, so only the ID orders them,
+	// one start given as the same instant in another location
+	input := []Period{
+		{ID: 3, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-10"), PeriodPriority: 1},
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 1, PeriodStart: date("2024-01-01").In(time.FixedZone("UTC+2", 2*60*60)), PeriodEnd: date("2024-01-20"), PeriodPriority: 1},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-05"), PeriodPriority: 1},
+		{ID: 5, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-15"), PeriodPriority: 2},
+	}
+	want := []int{1, 2, 3, 4, 5}
+	rng := rand.New(rand.NewSource(1))
+	for run := 0; run < 20; run++ {
+		shuffled := slices.Clone(input)
+		rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		SortPeriods(shuffled)
+		ids := make([]int, len(shuffled))
+		for i, p := range shuffled {
+			ids[i] = p.ID
+		}
+		if !slices.Equal(ids, want) {
+			t.Fatalf("run %d sorted to IDs %v, want %v", run, ids, want)
+		}
+	}
+}
+
+func TestProcessPeriodsTieBreak(t *testing.T) {
+	// two equal priority promotions overlapping from the 10th to the 15th
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-15"), PeriodPriority: 1, Price: 1 * priceScale},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1, Price: 5 * priceScale},
+	}
+	tests := []struct {
+		name       string
+		tieBreak   string
+		sourceRank map[string]int
+		want       []string
+	}{
+		{"earlier start wins by default", "", nil, []string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20"}},
+		{"higher price wins", "price", nil, []string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}},
+		{"lower id wins", "id", nil, []string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20"}},
+		{"earlier source wins", "source", map[string]int{"list": 0, "promo": 1}, []string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := slices.Clone(input)
+			list[0].Source, list[1].Source = "promo", "list"
+			processed, err := ProcessPeriods(list, ProcessOptions{TieBreak: tt.tieBreak, SourceRank: tt.sourceRank})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.want) {
+				t.Errorf("processed %q, want %q", got, tt.want)
+			}
+			// the same input in any order resolves the same
+			slices.Reverse(list)
+			processed, err = ProcessPeriods(list, ProcessOptions{TieBreak: tt.tieBreak, SourceRank: tt.sourceRank})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.want) {
+				t.Errorf("reversed input processed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsCoincidentTieBreak(t *testing.T) {
+	// two equal priority promotions over the same days, one of them is kept whole
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-15"), PeriodPriority: 1, Price: 1 * priceScale, Source: "promo"},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-15"), PeriodPriority: 1, Price: 5 * priceScale, Source: "list"},
+	}
+	tests := []struct {
+		name       string
+		tieBreak   string
+		sourceRank map[string]int
+		want       []string
+	}{
+		{"lower id wins by default", "", nil, []string{"1 2024-01-01..2024-01-15"}},
+		{"higher price wins", "price", nil, []string{"2 2024-01-01..2024-01-15"}},
+		{"lower id wins", "id", nil, []string{"1 2024-01-01..2024-01-15"}},
+		{"earlier source wins", "source", map[string]int{"list": 0, "promo": 1}, []string{"2 2024-01-01..2024-01-15"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := ProcessPeriods(slices.Clone(input), ProcessOptions{TieBreak: tt.tieBreak, SourceRank: tt.sourceRank})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(processed); !slices.Equal(got, tt.want) {
+				t.Errorf("processed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPeriodsConcurrentMatchesSerial(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	for seed := int64(1); seed <= 10; seed++ {
+		input := randomPeriods(seed, 300, false)
+		serial, err := ProcessPeriods(slices.Clone(input), ProcessOptions{Workers: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		concurrent, err := ProcessPeriods(slices.Clone(input), ProcessOptions{Workers: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := spans(concurrent), spans(serial); !slices.Equal(got, want) {
+			t.Fatalf("seed %d: concurrent output differs from serial\n got %q\nwant %q", seed, got, want)
+		}
+	}
+}
+
+func TestProcessPeriodsUniqueIDs(t *testing.T) {
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 3},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-05"), PeriodEnd: date("2024-01-08"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 1, PeriodStart: date("2024-01-12"), PeriodEnd: date("2024-01-15"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 1, PeriodStart: date("2024-01-20"), PeriodEnd: date("2024-01-22"), PeriodPriority: 2},
+	}
+	for _, closed := range []bool{false, true} {
+		processed, err := ProcessPeriods(slices.Clone(input), ProcessOptions{ClosedIntervals: closed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"1 2024-01-01..2024-01-05", "2 2024-01-05..2024-01-08", "-1 2024-01-08..2024-01-12", "3 2024-01-12..2024-01-15",
+			"-2 2024-01-15..2024-01-20", "4 2024-01-20..2024-01-22", "-3 2024-01-22..2024-01-31"}
+		if closed {
+			want = []string{"1 2024-01-01..2024-01-04", "2 2024-01-05..2024-01-08", "-1 2024-01-09..2024-01-11", "3 2024-01-12..2024-01-15",
+				"-2 2024-01-16..2024-01-19", "4 2024-01-20..2024-01-22", "-3 2024-01-23..2024-01-31"}
+		}
+		if got := spans(processed); !slices.Equal(got, want) {
+			t.Errorf("closed %v: processed %q, want %q", closed, got, want)
+		}
+		seen := make(map[int]bool, len(processed))
+		splits := 0
+		for _, p := range processed {
+			if seen[p.ID] {
+				t.Errorf("closed %v: ID %d appears twice in %q", closed, p.ID, spans(processed))
+			}
+			seen[p.ID] = true
+			if p.ParentID != 0 {
+				splits++
+				if p.ParentID != 1 || p.ID >= 0 {
+					t.Errorf("closed %v: fragment %d of parent %d, want a negative ID split from 1", closed, p.ID, p.ParentID)
+				}
+			}
+		}
+		// 1 is cut into four pieces by the three periods within it
+		if splits != 3 {
+			t.Errorf("closed %v: %d split fragments, want 3", closed, splits)
+		}
+	}
+
+	// a shared counter keeps fragment IDs distinct across calls
+	counter := 0
+	for run := 0; run < 2; run++ {
+		processed, err := ProcessPeriods(slices.Clone(input), ProcessOptions{SplitIDs: &counter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := processed[len(processed)-1]; last.ID != -3*(run+1) {
+			t.Errorf("run %d: last fragment ID %d, want %d", run, last.ID, -3*(run+1))
+		}
+	}
+}
+
+func TestProcessPeriodsLogsDecisions(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	input := []Period{
+		{ID: 1, ProdNum: 7, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 7, PeriodStart: date("2024-01-15"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1},
+	}
+	if _, err := ProcessPeriods(input, ProcessOptions{Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("record %q: %v", line, err)
+		}
+		messages = append(messages, record["msg"].(string))
+	}
+	for _, want := range []string{"overlap detected", "current period has lower priority", "resuming suspended period"} {
+		if !slices.Contains(messages, want) {
+			t.Errorf("logged %q, want a %q record", messages, want)
+		}
+	}
+}
+
+func TestProcessPeriodsConflicts(t *testing.T) {
+	// a grid at noon snaps the cut boundaries of the split half a day into the winning period
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2, Price: 10 * priceScale},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-15"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1, Price: 20 * priceScale},
+	}
+	opts := ProcessOptions{SnapToGrid: true, GridEpoch: date("2024-01-01 12:00"), Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	processed, err := ProcessPeriods(slices.Clone(input), opts)
+	var conflicts *ConflictsError
+	if !errors.As(err, &conflicts) || len(conflicts.Conflicts) != 1 {
+		t.Fatalf("best-effort run: got %v, want one conflict", err)
+	}
+	if !strings.HasPrefix(err.Error(), "1 unresolved conflicts") || !strings.Contains(err.Error(), "overlaps period id 2") {
+		t.Errorf("conflict %v, want the overlap with period 2 reported", err)
+	}
+	if len(processed) != 3 {
+		t.Errorf("best-effort run kept %q, want the complete result", spans(processed))
+	}
+
+	opts.Strict = true
+	if _, err := ProcessPeriods(slices.Clone(input), opts); err == nil || errors.As(err, &conflicts) {
+		t.Errorf("strict run: got %v, want an abort", err)
+	}
+}
+
+func TestProcessPeriodsAcrossSpringForward(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	// clocks go forward on 2024-03-31, that day is 23 hours long
+	local := func(s string) time.Time {
+		d := date(s)
+		return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, london)
+	}
+	for _, closed := range []bool{false, true} {
+		outer := Period{ID: 1, ProdNum: 1, PeriodStart: local("2024-03-25"), PeriodEnd: local("2024-04-05"), PeriodPriority: 2}
+		// the same days in either mode, the closed end falls on the short day so the boundary after it crosses the change
+		inner := Period{ID: 2, ProdNum: 1, PeriodStart: local("2024-03-30"), PeriodEnd: local("2024-04-01"), PeriodPriority: 1}
+		if closed {
+			inner.PeriodEnd = local("2024-03-31")
+		}
+		processed, err := ProcessPeriods([]Period{outer, inner}, ProcessOptions{ClosedIntervals: closed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"2024-03-25 00:00..2024-03-30 00:00", "2024-03-30 00:00..2024-04-01 00:00", "2024-04-01 00:00..2024-04-05 00:00"}
+		if closed {
+			want = []string{"2024-03-25 00:00..2024-03-29 00:00", "2024-03-30 00:00..2024-03-31 00:00", "2024-04-01 00:00..2024-04-05 00:00"}
+		}
+		got := make([]string, len(processed))
+		for i, p := range processed {
+			// boundaries stay on local midnight on both sides of the change
+			got[i] = p.PeriodStart.In(london).Format("2006-01-02 15:04") + ".." + p.PeriodEnd.In(london).Format("2006-01-02 15:04")
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("closed %v: processed\n got %q\nwant %q", closed, got, want)
+		}
+	}
+}
+
+func TestProcessPeriodsContextCancelled(t *testing.T) {
+	product := randomPeriods(1, 200, false)
+	for i := range product {
+		product[i].ProdNum = 1
+	}
+	for _, resolver := range []string{"pairwise", "sweepline"} {
+		t.Run(resolver, func(t *testing.T) {
+			var opts ProcessOptions
+			var err error
+			if opts.Resolver, err = ResolverByName(resolver); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if processed, err := ProcessPeriodsContext(ctx, slices.Clone(product), opts); !errors.Is(err, context.Canceled) || len(processed) > 0 {
+				t.Errorf("cancelled before processing: %d periods, err %v", len(processed), err)
+			}
+
+			// cancelled at the first decision, the resolver has to stop within the product
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			opts.ResolutionRule = func(current, next Period) (bool, error) {
+				cancel()
+				return current.PeriodPriority < next.PeriodPriority, nil
+			}
+			if _, err := ProcessPeriodsContext(ctx, slices.Clone(product), opts); !errors.Is(err, context.Canceled) {
+				t.Errorf("cancelled within a product: err %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package periods
+
+import (
+	"container/heap"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+)
+
+// algorithm flattening the overlapping periods of a single product,
+// a *ConflictsError returned with the periods reports conflicts left in an otherwise complete result,
+// overlaps left in a result returned without error are reported by ProcessPeriods the same way
+type Resolver interface {
+	Resolve(product []Period, opts ProcessOptions) ([]Period, error)
+}
+
+// default resolver sweeping over the periods in start order, comparing each with the period it overlaps
+type PairwiseResolver struct{}
+
+// resolver computing the winning period of every elementary interval between boundaries
+type SweepLineResolver struct{}
+
+// Resolve a product by sweeping over all period boundaries: each interval between two consecutive boundaries
+// goes to the period dominating the active set, the periods started and not yet ended, kept as a heap updated
+// at start and end events, and consecutive intervals won by the same period are merged back into one output period
+func (SweepLineResolver) Resolve(product []Period, opts ProcessOptions) ([]Period, error) {
+	if len(product) < 2 {
+		return product, nil
+	}
+	SortPeriods(product)
+	cut := newFragments(product, opts)
+	boundaries := make([]time.Time, 0, 2*len(product))
+	for i, p := range product {
+		boundaries = append(boundaries, p.PeriodStart, cut.end(i))
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	active := &dominanceHeap{product: product, opts: opts}
+	started := 0
+	for b := 0; b < len(boundaries)-1; b++ {
+		from, to := boundaries[b], boundaries[b+1]
+		if !from.Before(to) {
+			continue // duplicate boundary
+		}
+		if opts.Iterations != nil {
+			*opts.Iterations++
+		}
+		if err := opts.cancelled(); err != nil {
+			return cut.out, err
+		}
+		// periods starting by the interval join the active set, ended ones leave it once they come on top
+		for ; started < len(product) && !product[started].PeriodStart.After(from); started++ {
+			heap.Push(active, started)
+		}
+		for active.Len() > 0 && !cut.end(active.items[0]).After(from) {
+			heap.Pop(active)
+		}
+		if active.err != nil {
+			return cut.out, active.err
+		}
+		if active.Len() == 0 {
+			continue // gap, no period covers the interval
+		}
+		if err := cut.emit(active.items[0], from, to); err != nil {
+			return cut.out, err
+		}
+	}
+	return cut.out, nil
+}
+
+// Check if candidate beats winner wherever both cover the same granules, the one decision both resolvers
+// make: the configured resolution rule when set, otherwise the lower priority number and on equal priority the tie break
+func dominates(candidate, winner Period, opts ProcessOptions) (bool, error) {
+	if opts.ResolutionRule != nil {
+		return opts.ResolutionRule(candidate, winner)
+	}
+	if candidate.PeriodPriority != winner.PeriodPriority {
+		return candidate.PeriodPriority < winner.PeriodPriority, nil
+	}
+	return tieBreakWins(candidate, winner, opts), nil
+}
+
+// Decide between two periods of equal priority per the configured tie break:
+// "id" lower ID, "price" higher price, "source" earlier configured source, and by default
+// earlier start; undecided ties fall back to earlier start then lower ID
+func tieBreakWins(candidate, winner Period, opts ProcessOptions) bool {
+	switch opts.TieBreak {
+	case "id":
+		if candidate.ID != winner.ID {
+			return candidate.ID < winner.ID
+		}
+	case "price":
+		if candidate.Price != winner.Price {
+			return candidate.Price > winner.Price
+		}
+	case "source":
+		if opts.SourceRank[candidate.Source] != opts.SourceRank[winner.Source] {
+			return opts.SourceRank[candidate.Source] < opts.SourceRank[winner.Source]
+		}
+	}
+	if !candidate.PeriodStart.Equal(winner.PeriodStart) {
+		return candidate.PeriodStart.Before(winner.PeriodStart)
+	}
+	return candidate.ID < winner.ID
+}
+
+// Resolver by config name: "pairwise" (default) or "sweepline"
+func ResolverByName(name string) (Resolver, error) {
+	switch name {
+	case "", "pairwise":
+		return PairwiseResolver{}, nil
+	case "sweepline":
+		return SweepLineResolver{}, nil
+	}
+	return nil, fmt.Errorf("unknown resolver %q", name)
+}
+
+// Output fragments of a product's periods cut at exclusive boundaries, the one place both resolvers turn
+// cut points back into period boundaries in the end convention of the interval mode
+type fragments struct {
+	product []Period
+	opts    ProcessOptions
+	out     []Period
+	// fragments emitted per period, every one after the first is a split
+	count  []int
+	splits int
+	// output index and exclusive end of the last fragment of each period
+	last    []int
+	lastEnd []time.Time
+}
+
+func newFragments(product []Period, opts ProcessOptions) *fragments {
+	return &fragments{
+		product: product,
+		opts:    opts,
+		out:     make([]Period, 0, len(product)),
+		count:   make([]int, len(product)),
+		last:    make([]int, len(product)),
+		lastEnd: make([]time.Time, len(product)),
+	}
+}
+
+// Exclusive end of period i: in closed mode the end granule itself is covered
+func (f *fragments) end(i int) time.Time {
+	if f.opts.ClosedIntervals {
+		return AddGranules(f.product[i].PeriodEnd, 1, f.opts.Granule())
+	}
+	return f.product[i].PeriodEnd
+}
+
+// Emit the part of period i from one cut point up to another, the period keeps its own start and end where
+// the cut is at them, cuts elsewhere are moved like boundary shifts; fragments left empty by snapping or
+// skipped business days are dropped and a fragment continuing the previous one of the period extends it
+func (f *fragments) emit(i int, from, to time.Time) error {
+	if !from.Before(to) {
+		return nil
+	}
+	p := f.product[i]
+	end := p.PeriodEnd
+	if !to.Equal(f.end(i)) {
+		end = endBefore(to, f.opts)
+	}
+	if f.count[i] > 0 && f.lastEnd[i].Equal(from) {
+		f.out[f.last[i]].PeriodEnd = end
+		f.lastEnd[i] = to
+		return nil
+	}
+	fragment := p
+	if !from.Equal(p.PeriodStart) {
+		fragment.PeriodStart = ShiftBoundary(AddGranules(from, -1, f.opts.Granule()), 1, f.opts)
+	}
+	fragment.PeriodEnd = end
+	if end.Before(fragment.PeriodStart) || !f.opts.ClosedIntervals && end.Equal(fragment.PeriodStart) {
+		return nil
+	}
+	if f.count[i]++; f.count[i] > 1 {
+		f.splits++
+		if err := f.opts.checkSplits(p.ProdNum, f.splits); err != nil {
+			return err
+		}
+	}
+	fragment.Metadata = maps.Clone(p.Metadata)
+	f.last[i], f.lastEnd[i] = len(f.out), to
+	f.out = append(f.out, fragment)
+	return nil
+}
+
+// Indexes of a product's periods with the one dominating all others on top,
+// the first error of the resolution rule is kept as comparisons after it mean nothing
+type dominanceHeap struct {
+	product []Period
+	opts    ProcessOptions
+	items   []int
+	err     error
+}
+
+func (h *dominanceHeap) Len() int { return len(h.items) }
+
+func (h *dominanceHeap) Less(a, b int) bool {
+	wins, err := dominates(h.product[h.items[a]], h.product[h.items[b]], h.opts)
+	if err != nil && h.err == nil {
+		h.err = err
+	}
+	return wins
+}
+
+func (h *dominanceHeap) Swap(a, b int) { h.items[a], h.items[b] = h.items[b], h.items[a] }
+
+func (h *dominanceHeap) Push(x any) { h.items = append(h.items, x.(int)) }
+
+func (h *dominanceHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
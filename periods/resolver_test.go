@@ -0,0 +1,99 @@
+package periods
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSweepLineMatchesPairwise(t *testing.T) {
+	period := func(id int, start, end string, priority int) Period {
+		return Period{ID: id, ProdNum: 1, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: priority}
+	}
+	tests := []struct {
+		name  string
+		input []Period
+	}{
+		{"nested", []Period{period(1, "2024-01-01", "2024-01-31", 3), period(2, "2024-01-05", "2024-01-25", 2), period(3, "2024-01-10", "2024-01-15", 1)}},
+		{"chained", []Period{period(1, "2024-01-01", "2024-01-10", 1), period(2, "2024-01-08", "2024-01-20", 2), period(3, "2024-01-18", "2024-01-31", 3)}},
+		{"higher priority starts later", []Period{period(1, "2024-01-01", "2024-01-20", 2), period(2, "2024-01-10", "2024-01-31", 1)}},
+		{"shared boundary day", []Period{period(1, "2024-01-01", "2024-01-10", 2), period(2, "2024-01-10", "2024-01-20", 1)}},
+		{"coincident", []Period{period(1, "2024-01-01", "2024-01-10", 2), period(2, "2024-01-01", "2024-01-10", 1)}},
+		{"two splits of one period", []Period{period(1, "2024-01-01", "2024-01-31", 2), period(2, "2024-01-05", "2024-01-08", 1), period(3, "2024-01-15", "2024-01-18", 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairwise, err := ProcessPeriods(slices.Clone(tt.input), ProcessOptions{ClosedIntervals: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sweepLine, err := ProcessPeriods(slices.Clone(tt.input), ProcessOptions{ClosedIntervals: true, Resolver: SweepLineResolver{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := spans(sweepLine), spans(pairwise); !slices.Equal(got, want) {
+				t.Errorf("sweep line %q, pairwise %q", got, want)
+			}
+		})
+	}
+}
+
+func TestResolverByName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Resolver
+		wantErr bool
+	}{
+		{"", PairwiseResolver{}, false},
+		{"pairwise", PairwiseResolver{}, false},
+		{"sweepline", SweepLineResolver{}, false},
+		{"interval-tree", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolverByName(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ResolverByName(%q) = %T, %v; want %T", tt.name, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPairwiseMatchesSweepLineRandom(t *testing.T) {
+	for _, closed := range []bool{false, true} {
+		for seed := int64(1); seed <= 50; seed++ {
+			input := randomPeriods(seed, 60, closed)
+			opts := ProcessOptions{ClosedIntervals: closed, Resolver: SweepLineResolver{}}
+			swept, err := ProcessPeriods(slices.Clone(input), opts)
+			if err != nil {
+				t.Fatalf("sweepline seed %d: %v", seed, err)
+			}
+			opts.Resolver = PairwiseResolver{}
+			pairwise, err := ProcessPeriods(slices.Clone(input), opts)
+			if err != nil {
+				t.Fatalf("pairwise seed %d: %v", seed, err)
+			}
+			if got, want := spans(pairwise), spans(swept); !slices.Equal(got, want) {
+				t.Fatalf("closed %v seed %d: pairwise\n%q\nsweepline\n%q", closed, seed, got, want)
+			}
+			if err := AssertNoOverlaps(pairwise, opts); err != nil {
+				t.Fatalf("closed %v seed %d: %v", closed, seed, err)
+			}
+		}
+	}
+}
+
+func TestSweepLineIterationsLinear(t *testing.T) {
+	// every interval between boundaries used to scan the whole product
+	input := randomPeriods(7, 2000, false)
+	for i := range input {
+		input[i].ProdNum = 1
+	}
+	iterations := 0
+	opts := ProcessOptions{Resolver: SweepLineResolver{}, Iterations: &iterations}
+	if _, err := ProcessPeriods(slices.Clone(input), opts); err != nil {
+		t.Fatal(err)
+	}
+	if limit := 2 * len(input); iterations > limit {
+		t.Errorf("%d iterations for %d periods, want at most %d", iterations, len(input), limit)
+	}
+}
@@ -0,0 +1,69 @@
+package periods
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/expr-lang/expr"
+)
+
+// decides whether the current period wins an overlap against the next one
+type ResolutionRule func(current, next Period) (bool, error)
+
+// period as seen by rule expressions, with the price as a plain number comparable to literals
+type rulePeriod struct {
+	ID             int
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	Price          float64
+	ProdNum        int
+	PeriodPriority int
+	Source         string
+	Metadata       map[string]any
+}
+
+func newRulePeriod(p Period) rulePeriod {
+	return rulePeriod{p.ID, p.PeriodStart, p.PeriodEnd, p.Price.Float64(), p.ProdNum, p.PeriodPriority, p.Source, p.Metadata}
+}
+
+// Compile a boolean rule expression over the current and next periods,
+// e.g. "current.PeriodPriority <= next.PeriodPriority", true means current wins
+func CompileResolutionRule(rule string) (ResolutionRule, error) {
+	env := map[string]any{"current": rulePeriod{}, "next": rulePeriod{}}
+	program, err := expr.Compile(rule, expr.Env(env), expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("error compiling resolution rule: %w", err)
+	}
+	return func(current, next Period) (bool, error) {
+		result, err := expr.Run(program, map[string]any{"current": newRulePeriod(current), "next": newRulePeriod(next)})
+		if err != nil {
+			return false, fmt.Errorf("error evaluating resolution rule for periods %d and %d: %w", current.ID, next.ID, err)
+		}
+		return result.(bool), nil
+	}, nil
+}
+
+// Resolution rule of a named strategy: "priority" (default) keeps the lower priority number winning
+// and returns no rule, "highestPrice" and "lowestPrice" let the price decide regardless of priority,
+// equal prices fall back to priority and then the tie break in opts
+func ResolutionRuleByName(name string, opts ProcessOptions) (ResolutionRule, error) {
+	var higherWins bool
+	switch name {
+	case "", "priority":
+		return nil, nil
+	case "highestPrice":
+		higherWins = true
+	case "lowestPrice":
+	default:
+		return nil, fmt.Errorf("unknown resolution strategy %q", name)
+	}
+	return func(current, next Period) (bool, error) {
+		if current.Price != next.Price {
+			return (current.Price > next.Price) == higherWins, nil
+		}
+		if current.PeriodPriority != next.PeriodPriority {
+			return current.PeriodPriority < next.PeriodPriority, nil
+		}
+		return tieBreakWins(current, next, opts), nil
+	}, nil
+}
@@ -0,0 +1,112 @@
+package periods
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolutionRuleByName(t *testing.T) {
+	cheap := Period{ID: 1, Price: Price(3 * priceScale), PeriodPriority: 2}
+	dear := Period{ID: 2, Price: Price(5 * priceScale), PeriodPriority: 1}
+	samePrice := Period{ID: 3, Price: Price(3 * priceScale), PeriodPriority: 1}
+	tests := []struct {
+		strategy      string
+		current, next Period
+		wantRule      bool
+		wantWins      bool
+		wantErr       bool
+	}{
+		{strategy: ""},
+		{strategy: "priority"},
+		{strategy: "highestPrice", current: dear, next: cheap, wantRule: true, wantWins: true},
+		{strategy: "highestPrice", current: cheap, next: dear, wantRule: true, wantWins: false},
+		{strategy: "lowestPrice", current: cheap, next: dear, wantRule: true, wantWins: true},
+		// equal prices fall back to priority
+		{strategy: "lowestPrice", current: cheap, next: samePrice, wantRule: true, wantWins: false},
+		{strategy: "highestPrice", current: samePrice, next: cheap, wantRule: true, wantWins: true},
+		{strategy: "cheapest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			rule, err := ResolutionRuleByName(tt.strategy, ProcessOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if (rule != nil) != tt.wantRule {
+				t.Fatalf("rule returned %v, want %v", rule != nil, tt.wantRule)
+			}
+			if rule == nil {
+				return
+			}
+			wins, err := rule(tt.current, tt.next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wins != tt.wantWins {
+				t.Errorf("id %d wins over id %d: %v, want %v", tt.current.ID, tt.next.ID, wins, tt.wantWins)
+			}
+		})
+	}
+}
+
+func TestResolutionStrategies(t *testing.T) {
+	period := func(id int, start, end string, priority int, price Price) Period {
+		return Period{ID: id, ProdNum: 1, PeriodStart: date(start), PeriodEnd: date(end), PeriodPriority: priority, Price: price * priceScale}
+	}
+	// priority, price and the strategy each pick a different winner
+	overlapping := []Period{period(1, "2024-01-01", "2024-01-15", 1, 3), period(2, "2024-01-10", "2024-01-20", 2, 5), period(3, "2024-01-12", "2024-01-25", 3, 1)}
+	coincident := []Period{period(1, "2024-01-01", "2024-01-15", 1, 3), period(2, "2024-01-01", "2024-01-15", 2, 5), period(3, "2024-01-01", "2024-01-15", 3, 1)}
+	tests := []struct {
+		strategy                string
+		overlapping, coincident []string
+	}{
+		{"priority", []string{"1 2024-01-01..2024-01-15", "2 2024-01-15..2024-01-20", "3 2024-01-20..2024-01-25"}, []string{"1 2024-01-01..2024-01-15"}},
+		{"highestPrice", []string{"1 2024-01-01..2024-01-10", "2 2024-01-10..2024-01-20", "3 2024-01-20..2024-01-25"}, []string{"2 2024-01-01..2024-01-15"}},
+		{"lowestPrice", []string{"1 2024-01-01..2024-01-12", "3 2024-01-12..2024-01-25"}, []string{"3 2024-01-01..2024-01-15"}},
+	}
+	for _, resolver := range []string{"pairwise", "sweepline"} {
+		for _, tt := range tests {
+			t.Run(resolver+" "+tt.strategy, func(t *testing.T) {
+				var opts ProcessOptions
+				var err error
+				if opts.Resolver, err = ResolverByName(resolver); err != nil {
+					t.Fatal(err)
+				}
+				if opts.ResolutionRule, err = ResolutionRuleByName(tt.strategy, opts); err != nil {
+					t.Fatal(err)
+				}
+				for _, run := range []struct {
+					input []Period
+					want  []string
+				}{{overlapping, tt.overlapping}, {coincident, tt.coincident}} {
+					processed, err := ProcessPeriods(slices.Clone(run.input), opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got := spans(processed); !slices.Equal(got, run.want) {
+						t.Errorf("processed %q, want %q", got, run.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCompileResolutionRule(t *testing.T) {
+	rule, err := CompileResolutionRule("current.Price >= next.Price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-15"), PeriodPriority: 1, Price: Price(1 * priceScale)},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20"), PeriodPriority: 2, Price: Price(5 * priceScale)},
+	}
+	processed, err := ProcessPeriods(input, ProcessOptions{ResolutionRule: rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the dearer period 2 wins the overlap despite its priority
+	if len(processed) != 2 || processed[0].PeriodEnd.After(date("2024-01-10")) || processed[1].ID != 2 || !processed[1].PeriodStart.Equal(date("2024-01-10")) {
+		t.Errorf("processed %q, want 1 cut before 2 kept whole", spans(processed))
+	}
+}
@@ -0,0 +1,64 @@
+package periods
+
+// counts of what processing did to one product, derived from its input and output so
+// every resolver reports them the same way
+type ProductStats struct {
+	// periods before and after processing
+	Input  int
+	Output int
+	// pairs of input periods that overlapped
+	Overlaps int
+	// extra fragments periods were split into
+	Splits int
+	// input periods with nothing left in the output
+	Removed int
+}
+
+// operation counts keyed by ProdNum, adding up over processing runs
+type ProductStatsByProd map[int]*ProductStats
+
+// Add the counts of a product
+func (s ProductStatsByProd) add(prodNum int, stats ProductStats) {
+	total := s[prodNum]
+	if total == nil {
+		total = &ProductStats{}
+		s[prodNum] = total
+	}
+	total.Input += stats.Input
+	total.Output += stats.Output
+	total.Overlaps += stats.Overlaps
+	total.Splits += stats.Splits
+	total.Removed += stats.Removed
+}
+
+// Count the input side of a product sorted by start: its periods and overlapping pairs,
+// within tolerance like the resolvers
+func inputStats(product []Period, opts ProcessOptions) ProductStats {
+	stats := ProductStats{Input: len(product)}
+	for i, current := range product {
+		for _, next := range product[i+1:] {
+			if !overlapsDay(current.PeriodEnd, next.PeriodStart.Add(opts.toleranceFor(current.ProdNum)), opts) {
+				break // later periods start later still
+			}
+			stats.Overlaps++
+		}
+	}
+	return stats
+}
+
+// Complete the counts with the resolved product, whose fragments still carry their source ID
+func (stats *ProductStats) countOutput(input []int, output []Period) {
+	stats.Output = len(output)
+	fragments := make(map[int]int, len(output))
+	for _, p := range output {
+		fragments[p.ID]++
+	}
+	for _, n := range fragments {
+		stats.Splits += n - 1
+	}
+	for _, id := range input {
+		if fragments[id] == 0 {
+			stats.Removed++
+		}
+	}
+}
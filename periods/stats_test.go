@@ -0,0 +1,44 @@
+package periods
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProcessPeriodsStats(t *testing.T) {
+	// product 1: 2 splits 1 in two and 3 lies within 2, product 2 has nothing to resolve
+	input := []Period{
+		{ID: 1, ProdNum: 1, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: date("2024-01-10"), PeriodEnd: date("2024-01-20"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 1, PeriodStart: date("2024-01-12"), PeriodEnd: date("2024-01-15"), PeriodPriority: 3},
+		{ID: 4, ProdNum: 2, PeriodStart: date("2024-01-01"), PeriodEnd: date("2024-01-31"), PeriodPriority: 1},
+	}
+	want := map[int]ProductStats{
+		1: {Input: 3, Output: 3, Overlaps: 3, Splits: 1, Removed: 1},
+		2: {Input: 1, Output: 1},
+	}
+	for _, resolver := range []string{"pairwise", "sweepline"} {
+		t.Run(resolver, func(t *testing.T) {
+			opts := ProcessOptions{Stats: ProductStatsByProd{}}
+			var err error
+			if opts.Resolver, err = ResolverByName(resolver); err != nil {
+				t.Fatal(err)
+			}
+			processed, err := ProcessPeriods(slices.Clone(input), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(processed) != 4 {
+				t.Errorf("processed %q, want 4 periods", spans(processed))
+			}
+			if len(opts.Stats) != len(want) {
+				t.Errorf("stats for %d products, want %d", len(opts.Stats), len(want))
+			}
+			for prodNum, w := range want {
+				if got := opts.Stats[prodNum]; got == nil || *got != w {
+					t.Errorf("product %d stats = %+v, want %+v", prodNum, got, w)
+				}
+			}
+		})
+	}
+}
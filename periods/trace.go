@@ -0,0 +1,42 @@
+package periods
+
+// decision taken when resolving an overlap between two neighbouring periods
+type TraceEvent struct {
+	Action  string
+	Current Period
+	Next    Period
+}
+
+// decisions taken while processing a single product
+type DecisionTrace struct {
+	ProdNum int
+	Events  []TraceEvent
+}
+
+// Record a decision, ignored when tracing is off or for other products
+func (t *DecisionTrace) record(action string, current, next Period) {
+	if t == nil || current.ProdNum != t.ProdNum {
+		return
+	}
+	t.Events = append(t.Events, TraceEvent{Action: action, Current: current, Next: next})
+}
+
+// why a period was dropped during processing
+type Removal struct {
+	RemovedID  int    `json:"removedID"`
+	SurvivorID int    `json:"survivorID"`
+	Reason     string `json:"reason"`
+}
+
+// explanations of removed periods, collected when -explain-removal is set
+type RemovalLog struct {
+	Removals []Removal
+}
+
+// Record the period that caused a removal and the rule applied, ignored when not collecting
+func (r *RemovalLog) record(removed, survivor Period, reason string) {
+	if r == nil {
+		return
+	}
+	r.Removals = append(r.Removals, Removal{RemovedID: removed.ID, SurvivorID: survivor.ID, Reason: reason})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+	"github.com/segmentio/kafka-go"
+)
+
+// keyed message for a message broker
+type QueueMessage struct {
+	Key, Value []byte
+}
+
+// sink publishing keyed messages to a message broker, a batch of messages per call
+type Publisher interface {
+	Publish(ctx context.Context, messages []QueueMessage) error
+	Close() error
+}
+
+// Publisher backed by a kafka topic
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(brokers []string, topic string) *kafkaPublisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Topic:    topic,
+		Balancer: &kafka.Hash{}, // same key always lands on same partition
+		// a run's messages come in one call, a partial batch has nothing more to wait for
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (k *kafkaPublisher) Publish(ctx context.Context, messages []QueueMessage) error {
+	batch := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		batch[i] = kafka.Message{Key: m.Key, Value: m.Value}
+	}
+	return k.writer.WriteMessages(ctx, batch...)
+}
+
+func (k *kafkaPublisher) Close() error {
+	return k.writer.Close()
+}
+
+// error of an attempt that retrying cannot fix, ends retryWithBackoff right away
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Run op until it succeeds, waiting baseDelay doubled after each failed attempt,
+// an error wrapped in permanentError is returned unwrapped without further attempts,
+// a cancelled ctx ends the wait between attempts with the ctx error
+func retryWithBackoff(ctx context.Context, attempts int, baseDelay time.Duration, op func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	delay := baseDelay
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = op(); err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt < attempts {
+			slog.Warn("attempt failed, retrying", "attempt", attempt, "attempts", attempts, "error", err, "retryIn", delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// Publish each period as a JSON message keyed by its ProdNum, all periods in one batch
+// that is retried as a whole
+func publishPeriods(ctx context.Context, pub Publisher, list []periods.Period, config *Config) error {
+	messages := make([]QueueMessage, len(list))
+	for i, p := range list {
+		value, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("error encoding period %d: %w", p.ID, err)
+		}
+		messages[i] = QueueMessage{Key: []byte(strconv.Itoa(p.ProdNum)), Value: value}
+	}
+	baseDelay := time.Duration(config.Output.Queue.RetryBaseDelayMs) * time.Millisecond
+	err := retryWithBackoff(ctx, config.Output.Queue.RetryAttempts, baseDelay, func() error {
+		return pub.Publish(ctx, messages)
+	})
+	if err != nil {
+		return fmt.Errorf("error publishing %d periods: %w", len(list), err)
+	}
+	fmt.Printf("Periods published to %s: %v\n", config.Output.Queue.Topic, len(list))
+	return nil
+}
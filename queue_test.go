@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Publisher recording published batches, failing the first failures attempts
+type fakePublisher struct {
+	failures int
+	batches  [][]QueueMessage
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, messages []QueueMessage) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("broker unavailable")
+	}
+	f.batches = append(f.batches, messages)
+	return nil
+}
+
+func (f *fakePublisher) Close() error { return nil }
+
+func TestPublishPeriods(t *testing.T) {
+	list := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10")},
+		{ID: 2, ProdNum: 9, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("20")},
+		{ID: 3, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), Price: mustPrice("15")},
+	}
+	tests := []struct {
+		name     string
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{"published", 0, 1, false},
+		{"retried", 2, 3, false},
+		{"out of attempts", 2, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &fakePublisher{failures: tt.failures}
+			var config Config
+			config.Output.Queue.RetryAttempts = tt.attempts
+			err := publishPeriods(context.Background(), pub, list, &config)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error once retries ran out")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// every period goes out in a single batch, not a call per period
+			if len(pub.batches) != 1 || len(pub.batches[0]) != len(list) {
+				t.Fatalf("published batches %v, want one batch of %d messages", pub.batches, len(list))
+			}
+			for i, m := range pub.batches[0] {
+				var published periods.Period
+				if err := json.Unmarshal(m.Value, &published); err != nil {
+					t.Fatal(err)
+				}
+				if want := strconv.Itoa(list[i].ProdNum); string(m.Key) != want || published.ID != list[i].ID {
+					t.Errorf("message %d keyed %q with period %d, want key %q and period %d", i, m.Key, published.ID, want, list[i].ID)
+				}
+			}
+		})
+	}
+}
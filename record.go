@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// everything a run did, written by -record so a run can be reproduced without the db
+type RunRecord struct {
+	Config  Config                 `json:"config"`
+	Options periods.ProcessOptions `json:"options"`
+	Input   []periods.Period       `json:"input"`
+	Output  []periods.Period       `json:"output"`
+	// per product operation counts of the run and its decision trace, when a product was traced
+	Stats periods.ProductStatsByProd `json:"stats,omitempty"`
+	Trace *periods.DecisionTrace     `json:"trace,omitempty"`
+}
+
+// Write a run record to file, secrets are encoded redacted
+func writeRunRecord(path string, record RunRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding run record: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing run record: %w", err)
+	}
+	fmt.Printf("Run recorded to %s\n", path)
+	return nil
+}
+
+// Read a run record from file
+func readRunRecord(path string) (*RunRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run record: %w", err)
+	}
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("error parsing run record: %w", err)
+	}
+	return &record, nil
+}
+
+// Re-run processing on a recorded input with the recorded config and check it reproduces the recorded output
+// and stats, a difference is an error
+func replayRunRecord(record *RunRecord) ([]periods.Period, error) {
+	input := make([]periods.Period, len(record.Input))
+	copy(input, record.Input)
+	// resolver and resolution rule are not recorded with the options, they follow from the config
+	opts := record.Options
+	if err := record.Config.resolution(&opts); err != nil {
+		return nil, fmt.Errorf("error in recorded config: %w", err)
+	}
+	var stats periods.ProductStatsByProd
+	if record.Stats != nil {
+		stats = periods.ProductStatsByProd{}
+		opts.Stats = stats
+	}
+	// the recorded run kept its best-effort output on conflicts, so the replay compares it too
+	output, err := periods.ProcessPeriods(input, opts)
+	var conflicts *periods.ConflictsError
+	if err != nil && !errors.As(err, &conflicts) {
+		return output, err
+	}
+	output, _ = normalizeResolved(output, &record.Config, opts)
+	if !samePeriods(output, record.Output) {
+		return output, fmt.Errorf("replay output differs from recorded output: %d periods, recorded %d", len(output), len(record.Output))
+	}
+	if stats != nil && !reflect.DeepEqual(stats, record.Stats) {
+		return output, fmt.Errorf("replay stats differ from recorded stats: %d products, recorded %d", len(stats), len(record.Stats))
+	}
+	fmt.Printf("Replay output matches recorded output: %d periods\n", len(output))
+	return output, nil
+}
+
+// Compare two period slices field by field, times compared as instants
+func samePeriods(a, b []periods.Period) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].ProdNum != b[i].ProdNum || a[i].Price != b[i].Price ||
+			a[i].PeriodPriority != b[i].PeriodPriority ||
+			!a[i].PeriodStart.Equal(b[i].PeriodStart) || !a[i].PeriodEnd.Equal(b[i].PeriodEnd) {
+			return false
+		}
+	}
+	return true
+}
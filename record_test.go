@@ -0,0 +1,117 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestRunRecordReplay(t *testing.T) {
+	period := func(id int, start, end string, priority int, price periods.Price) periods.Period {
+		return periods.Period{ID: id, ProdNum: 1, PeriodStart: day(start), PeriodEnd: day(end), PeriodPriority: priority, Price: price}
+	}
+	input := []periods.Period{
+		period(1, "2024-01-01", "2024-01-31", 2, 3),
+		period(2, "2024-01-10", "2024-01-20", 1, 5),
+		period(3, "2024-02-10", "2024-02-20", 1, 1),
+	}
+	stats := periods.ProductStatsByProd{}
+	opts := periods.ProcessOptions{ClosedIntervals: true, Stats: stats, Trace: &periods.DecisionTrace{ProdNum: 1}}
+	output, err := periods.ProcessPeriods(append([]periods.Period(nil), input...), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config Config
+	config.QueryURL.AuthHeader = "Bearer secret"
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := writeRunRecord(path, RunRecord{Config: config, Options: opts, Input: input, Output: output, Stats: stats, Trace: opts.Trace}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := readRunRecord(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Config.QueryURL.AuthHeader != "REDACTED" {
+		t.Errorf("recorded auth header %q, want it redacted", record.Config.QueryURL.AuthHeader)
+	}
+	if !record.Options.ClosedIntervals || !samePeriods(record.Input, input) {
+		t.Errorf("recorded options %+v and input %v, want the run's", record.Options, record.Input)
+	}
+	if !reflect.DeepEqual(record.Stats, stats) || stats[1].Splits != 1 {
+		t.Errorf("recorded stats %v, want the run's %v with 1 split", record.Stats, stats)
+	}
+	if record.Trace == nil || record.Trace.ProdNum != 1 || len(record.Trace.Events) == 0 || len(record.Trace.Events) != len(opts.Trace.Events) {
+		t.Errorf("recorded trace %+v, want the run's %d events of product 1", record.Trace, len(opts.Trace.Events))
+	}
+	replayed, err := replayRunRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePeriods(replayed, output) {
+		t.Errorf("replayed %v, want %v", replayed, output)
+	}
+	// recorded stats the replay does not reproduce fail it
+	record.Stats[1].Splits++
+	if _, err := replayRunRecord(record); err == nil || !strings.Contains(err.Error(), "stats differ") {
+		t.Errorf("replay with altered stats returned %v, want the stats difference reported", err)
+	}
+}
+
+func TestRunRecordReplayStrategy(t *testing.T) {
+	period := func(id int, start, end string, priority int, price periods.Price) periods.Period {
+		return periods.Period{ID: id, ProdNum: 1, PeriodStart: day(start), PeriodEnd: day(end), PeriodPriority: priority, Price: price}
+	}
+	input := []periods.Period{
+		period(1, "2024-01-01", "2024-01-31", 1, 300),
+		period(2, "2024-01-10", "2024-01-20", 2, 500),
+		period(3, "2024-02-10", "2024-02-20", 1, 100),
+	}
+	// a strategy and resolver other than the defaults, which the recorded options do not carry
+	var config Config
+	config.Processing.Resolver = "sweepline"
+	config.Processing.ResolutionStrategy = "highestPrice"
+	config.Processing.FillGaps = "default"
+	config.Processing.GapPrice = 900
+	opts := periods.ProcessOptions{}
+	if err := config.resolution(&opts); err != nil {
+		t.Fatal(err)
+	}
+	output, err := periods.ProcessPeriods(append([]periods.Period(nil), input...), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, _ = normalizeResolved(output, &config, opts)
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := writeRunRecord(path, RunRecord{Config: config, Options: opts, Input: input, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		strategy string
+		wantErr  bool
+	}{
+		{"highestPrice", false},
+		// under the default priority strategy the same input resolves differently
+		{"priority", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			record, err := readRunRecord(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record.Config.Processing.ResolutionStrategy = tt.strategy
+			replayed, err := replayRunRecord(record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("replay error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !samePeriods(replayed, output) {
+				t.Errorf("replayed %v, want %v", replayed, output)
+			}
+		})
+	}
+}
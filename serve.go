@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// address served on when not configured
+const defaultServeAddress = ":8080"
+
+// on-demand runs of fetch, process and output over HTTP, sharing one db pool
+type processServer struct {
+	db     *sql.DB
+	config *Config
+	opts   periods.ProcessOptions
+	// plausible range of period dates, out of range periods fail the run when strictDates is set
+	minDate, maxDate time.Time
+	strictDates      bool
+	// held for the duration of a run, runs share the output file and the processing options
+	running sync.Mutex
+}
+
+// summary of an on-demand run
+type processResponse struct {
+	InputRows  int                        `json:"inputRows"`
+	OutputRows int                        `json:"outputRows"`
+	DurationMs int64                      `json:"durationMs"`
+	Products   periods.ProductStatsByProd `json:"products"`
+}
+
+// Serve POST /process and GET /healthz until ctx is done, then let the current run finish
+func (s *processServer) serve(ctx context.Context, address string) error {
+	if address == "" {
+		address = defaultServeAddress
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /process", s.handleProcess)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	server := &http.Server{Addr: address, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("server shutdown failed", "error", err)
+		}
+	}()
+	slog.Info("serving", "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving: %w", err)
+	}
+	return nil
+}
+
+// Run the pipeline once and answer with its stats, a run already in progress is not queued behind
+func (s *processServer) handleProcess(w http.ResponseWriter, r *http.Request) {
+	if !s.running.TryLock() {
+		http.Error(w, "a run is already in progress", http.StatusConflict)
+		return
+	}
+	defer s.running.Unlock()
+	stats, err := s.run(r.Context())
+	if err != nil {
+		slog.Warn("run failed", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats.print()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(processResponse{
+		InputRows:  stats.InputRows,
+		OutputRows: stats.OutputRows,
+		DurationMs: stats.Duration.Milliseconds(),
+		Products:   stats.Products,
+	})
+}
+
+// Report whether the database answers a ping
+func (s *processServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if err := s.db.PingContext(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("database unavailable: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Fetch, check, process and write the output like a one-shot run, without its optional reports and write-back
+func (s *processServer) run(ctx context.Context) (*ProcessStats, error) {
+	var fetched []periods.Period
+	var err error
+	if len(s.config.Sources) > 0 {
+		fetched, err = fetchSources(ctx, s.db, s.config)
+	} else {
+		fetched, err = fetchPeriods(ctx, s.db, s.config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch periods: %w", err)
+	}
+	if fetched, err = checkDateRange(fetched, s.minDate, s.maxDate, s.strictDates); err != nil {
+		return nil, fmt.Errorf("invalid period dates: %w", err)
+	}
+	if fetched, err = checkPeriodLengths(fetched, s.opts.ClosedIntervals, s.config.Processing.SkipInvalidPeriods); err != nil {
+		return nil, fmt.Errorf("invalid periods: %w", err)
+	}
+
+	stats := &ProcessStats{}
+	processed, err := stats.timeProcessing(ctx, fetched, s.opts)
+	if err := checkConflicts(err, s.config.Processing.AbortOnConflicts); err != nil {
+		return nil, fmt.Errorf("failed to process periods: %w", err)
+	}
+	if s.config.Processing.SnapBoundariesTo == "month" {
+		processed = snapBoundariesToMonth(processed, s.opts.ClosedIntervals)
+	}
+	if gaps := periods.FindGaps(processed, s.opts); len(gaps) > 0 && s.config.Processing.FillGaps != "" {
+		processed = periods.FillGaps(processed, gaps, s.config.Processing.FillGaps, s.config.Processing.GapPrice, s.opts)
+	}
+	stats.OutputRows = len(processed)
+
+	write, ok := fileWriters[s.config.Output.Format]
+	if !ok {
+		return stats, nil
+	}
+	output := processed
+	if s.config.Output.EndDateInclusive {
+		output = inclusiveEndDates(processed, s.opts)
+	}
+	output = slices.Clone(output)
+	periods.SortPeriods(output)
+	if err := write(output, s.config.Output.FilePath, s.config); err != nil {
+		return nil, fmt.Errorf("failed to write output: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestProcessServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		busy       bool
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantBody   string
+	}{
+		{"healthy", http.MethodGet, "/healthz", false, func(mock sqlmock.Sqlmock) { mock.ExpectPing() }, http.StatusOK, "ok"},
+		{"database down", http.MethodGet, "/healthz", false, func(mock sqlmock.Sqlmock) {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}, http.StatusServiceUnavailable, "database unavailable"},
+		{"run", http.MethodPost, "/process", false, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(periodQueryColumns).
+				AddRow(1, day("2024-01-01"), day("2024-01-31"), 10.5, 7, 2).
+				AddRow(2, day("2024-01-10"), day("2024-01-20"), 20.5, 7, 1))
+		}, http.StatusOK, `"inputRows":2,"outputRows":3`},
+		{"run in progress", http.MethodPost, "/process", true, func(sqlmock.Sqlmock) {}, http.StatusConflict, "already in progress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			tt.expect(mock)
+			server := &processServer{db: db, config: &Config{Query: "SELECT periods"}, minDate: day("2000-01-01"), maxDate: day("2100-01-01")}
+			if tt.busy {
+				server.running.Lock()
+				defer server.running.Unlock()
+			}
+			handlers := map[string]http.HandlerFunc{"/healthz": server.handleHealth, "/process": server.handleProcess}
+			recorder := httptest.NewRecorder()
+			handlers[tt.path](recorder, httptest.NewRequest(tt.method, tt.path, nil))
+			if recorder.Code != tt.wantStatus || !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s answered %d %q, want %d with %q", tt.method, tt.path, recorder.Code, recorder.Body, tt.wantStatus, tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && tt.path == "/process" {
+				var response processResponse
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				if stats := response.Products[7]; stats == nil || stats.Splits != 1 {
+					t.Errorf("product 7 stats %+v, want 1 split", stats)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Fetch periods from every shard concurrently, at most parallel at a time (0 means all at once),
+// merged in shard order. A failing shard fails the fetch, or is skipped with policy "skip"
+func fetchShards(shards []DatabaseConfig, policy string, parallel int, fetch func(shard DatabaseConfig) ([]periods.Period, error)) ([]periods.Period, error) {
+	if parallel <= 0 {
+		parallel = len(shards)
+	}
+	results := make([][]periods.Period, len(shards))
+	errs := make([]error, len(shards))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], errs[i] = fetch(shard)
+		}()
+	}
+	wg.Wait()
+
+	var merged []periods.Period
+	var failed []error
+	for i, shard := range shards {
+		if errs[i] != nil {
+			err := fmt.Errorf("shard %s/%s: %w", shard.Server, shard.Database, errs[i])
+			if policy != "skip" {
+				failed = append(failed, err)
+				continue
+			}
+			log.Printf("warning: skipping %v", err)
+			continue
+		}
+		merged = append(merged, results[i]...)
+	}
+	if len(failed) > 0 {
+		return nil, errors.Join(failed...)
+	}
+	return merged, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestFetchShards(t *testing.T) {
+	shards := []DatabaseConfig{{Server: "a", Database: "pricing"}, {Server: "b", Database: "pricing"}, {Server: "c", Database: "pricing"}}
+	// shard "a" answers last, the merge still follows shard order
+	fetch := func(failing string) func(DatabaseConfig) ([]periods.Period, error) {
+		return func(shard DatabaseConfig) ([]periods.Period, error) {
+			if shard.Server == failing {
+				return nil, errors.New("login failed")
+			}
+			if shard.Server == "a" {
+				time.Sleep(10 * time.Millisecond)
+			}
+			return []periods.Period{{ID: int(shard.Server[0]-'a') + 1}}, nil
+		}
+	}
+	tests := []struct {
+		name, policy, failing string
+		wantIDs               []int
+		wantErr               bool
+	}{
+		{"all shards", "", "", []int{1, 2, 3}, false},
+		{"failing shard fails the fetch", "fail-fast", "b", nil, true},
+		{"failing shard skipped", "skip", "b", []int{1, 3}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods, err := fetchShards(shards, tt.policy, 0, fetch(tt.failing))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			var ids []int
+			for _, p := range periods {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("fetched %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestFetchShardsMaxParallel(t *testing.T) {
+	shards := make([]DatabaseConfig, 6)
+	var running, peak atomic.Int32
+	_, err := fetchShards(shards, "", 2, func(DatabaseConfig) ([]periods.Period, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("at most %d shards fetched at a time, want 2", peak.Load())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Process shuffled copies of the same input runs times and compare every output to the first,
+// any difference means processing depends on input order
+func shuffleCheck(source []periods.Period, opts periods.ProcessOptions, runs int) error {
+	// no tracing or removal log across the repeated runs
+	opts.Logger, opts.Trace, opts.Removals, opts.SplitIDs = discardLogger, nil, nil, nil
+	var reference []periods.Period
+	for run := 0; run < runs; run++ {
+		input := slices.Clone(source)
+		rand.Shuffle(len(input), func(i, j int) { input[i], input[j] = input[j], input[i] })
+		// conflicts are part of the output being compared, only failed runs stop the check
+		output, err := periods.ProcessPeriods(input, opts)
+		var conflicts *periods.ConflictsError
+		if err != nil && !errors.As(err, &conflicts) {
+			return fmt.Errorf("shuffle run %d: %w", run+1, err)
+		}
+		// compare in a canonical order, output order itself is allowed to differ
+		sortPeriodsByID(output)
+		if run == 0 {
+			reference = output
+			continue
+		}
+		if !samePeriods(reference, output) {
+			return fmt.Errorf("shuffle run %d: output differs from run 1 (%d vs %d periods)", run+1, len(output), len(reference))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestShuffleCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []periods.Period
+		wantErr bool
+	}{
+		{"order independent", []periods.Period{
+			{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 2},
+			{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+			{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), PeriodPriority: 1},
+			{ID: 4, ProdNum: 2, PeriodStart: day("2024-01-05"), PeriodEnd: day("2024-01-20"), PeriodPriority: 2},
+		}, false},
+		// equal start and priority are ordered on ID, not left to the input order
+		{"tie on start and priority", []periods.Period{
+			{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), PeriodPriority: 1},
+			{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := shuffleCheck(tt.input, periods.ProcessOptions{Trace: &periods.DecisionTrace{ProdNum: 1}}, 30)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("shuffleCheck error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// counters of a processing run
+type ProcessStats struct {
+	InputRows  int
+	OutputRows int
+	// wall-clock time spent in ProcessPeriods
+	Duration time.Duration
+	// operation counts of each product
+	Products periods.ProductStatsByProd
+}
+
+// Time a ProcessPeriods call, which stops once ctx is done, and add its counts to the stats
+func (s *ProcessStats) timeProcessing(ctx context.Context, input []periods.Period, opts periods.ProcessOptions) ([]periods.Period, error) {
+	inputRows := len(input)
+	if s.Products == nil {
+		s.Products = periods.ProductStatsByProd{}
+	}
+	opts.Stats = s.Products
+	start := time.Now()
+	processed, err := periods.ProcessPeriodsContext(ctx, input, opts)
+	s.Duration += time.Since(start)
+	s.InputRows += inputRows
+	s.OutputRows += len(processed)
+	return processed, err
+}
+
+// Input rows processed per second of processing time
+func (s *ProcessStats) RowsPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.InputRows) / s.Duration.Seconds()
+}
+
+// Print the run summary
+func (s *ProcessStats) print() {
+	fmt.Printf("Processed %d periods into %d in %v (%.0f rows/s)\n", s.InputRows, s.OutputRows, s.Duration, s.RowsPerSecond())
+}
+
+// Print one line of operation counts per product, in ProdNum order
+func (s *ProcessStats) printProducts() {
+	prodNums := make([]int, 0, len(s.Products))
+	for prodNum := range s.Products {
+		prodNums = append(prodNums, prodNum)
+	}
+	sort.Ints(prodNums)
+	fmt.Printf("%10s %8s %8s %8s %8s %8s\n", "prodnum", "input", "overlaps", "splits", "removed", "output")
+	for _, prodNum := range prodNums {
+		p := s.Products[prodNum]
+		fmt.Printf("%10d %8d %8d %8d %8d %8d\n", prodNum, p.Input, p.Overlaps, p.Splits, p.Removed, p.Output)
+	}
+}
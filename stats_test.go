@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestProcessStatsTimeProcessing(t *testing.T) {
+	var stats ProcessStats
+	// two products processed in separate calls, as a streamed run does
+	for _, prodNum := range []int{1, 2} {
+		product := []periods.Period{
+			{ID: prodNum*10 + 1, ProdNum: prodNum, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 2},
+			{ID: prodNum*10 + 2, ProdNum: prodNum, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		}
+		if _, err := stats.timeProcessing(context.Background(), product, periods.ProcessOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats.InputRows != 4 || stats.OutputRows != 6 {
+		t.Errorf("stats counted %d rows in and %d out, want 4 and 6", stats.InputRows, stats.OutputRows)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("duration %v, want a positive processing time", stats.Duration)
+	}
+	if want := 4 / stats.Duration.Seconds(); stats.RowsPerSecond() != want {
+		t.Errorf("throughput %v rows/s, want %v", stats.RowsPerSecond(), want)
+	}
+	if (&ProcessStats{InputRows: 4}).RowsPerSecond() != 0 || (&ProcessStats{Duration: time.Second}).RowsPerSecond() != 0 {
+		t.Error("throughput of an untimed or empty run is not 0")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// output file written one product at a time, so a streamed run holds no more than one product's periods
+type streamOutput struct {
+	file   *os.File
+	csv    *csv.Writer
+	config *Config
+	// log entries of the run share one timestamp like the log writer
+	timestamp string
+	rows      int
+}
+
+// Create the output file of a streamed run, csv output starts with its header row
+func newStreamOutput(config *Config) (*streamOutput, error) {
+	file, err := os.Create(config.Output.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %w", err)
+	}
+	out := &streamOutput{file: file, config: config, timestamp: time.Now().Format("2006-01-02 15:04:05")}
+	if config.Output.Format == "csv" {
+		out.csv = csv.NewWriter(file)
+		if err := out.csv.Write(csvHeader); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error writing header: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// Finish a resolved product like a full run does (month snapping, the -verify check, inclusive ends,
+// period order) and append it to the output
+func (s *streamOutput) write(product []periods.Period, opts periods.ProcessOptions, verify bool) error {
+	if s.config.Processing.SnapBoundariesTo == "month" {
+		product = snapBoundariesToMonth(product, opts.ClosedIntervals)
+	}
+	if verify {
+		if err := periods.AssertNoOverlaps(product, opts); err != nil {
+			return fmt.Errorf("verification failed: %w", err)
+		}
+	}
+	if s.config.Output.EndDateInclusive {
+		product = inclusiveEndDates(product, opts)
+	}
+	periods.SortPeriods(product)
+	for _, p := range product {
+		if s.csv != nil {
+			if err := s.csv.Write(csvRow(p, boundaryLayout(opts.Granule()))); err != nil {
+				return fmt.Errorf("error writing row: %w", err)
+			}
+			continue
+		}
+		entry, err := formatLogEntry(s.config.Logging.RecordFormat, s.timestamp, "processed", boundaryLayout(opts.Granule()), p)
+		if err != nil {
+			return fmt.Errorf("error formatting log entry: %w", err)
+		}
+		if _, err := s.file.WriteString(entry); err != nil {
+			return fmt.Errorf("error writing log output: %w", err)
+		}
+	}
+	s.rows += len(product)
+	return nil
+}
+
+// Flush and close the output file
+func (s *streamOutput) close() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			s.file.Close()
+			return fmt.Errorf("error writing csv file: %w", err)
+		}
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("error closing output file: %w", err)
+	}
+	fmt.Printf("Periods written to %s: %v\n", s.config.Output.FilePath, s.rows)
+	return nil
+}
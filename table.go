@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Reason a processed period differs from its input period of the same ID
+func adjustmentReasons(input, output []periods.Period) []string {
+	byID := make(map[int]periods.Period, len(input))
+	for _, p := range input {
+		byID[p.ID] = p
+	}
+	parts := make(map[int]int)
+	for _, p := range output {
+		parts[p.SourceID()]++
+	}
+	reasons := make([]string, len(output))
+	for i, p := range output {
+		original, ok := byID[p.SourceID()]
+		var changes []string
+		if parts[p.SourceID()] > 1 {
+			changes = append(changes, "split")
+		}
+		if ok && !p.PeriodStart.Equal(original.PeriodStart) {
+			changes = append(changes, "start shifted")
+		}
+		if ok && !p.PeriodEnd.Equal(original.PeriodEnd) {
+			changes = append(changes, "end truncated")
+		}
+		reasons[i] = strings.Join(changes, ", ")
+	}
+	return reasons
+}
+
+// Terminal width from $COLUMNS, 120 when not set
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 120
+}
+
+// Write periods as a column aligned table grouped by product, boundaries in the layout of the granularity,
+// the reason column is cut to keep rows within width
+func writeTable(w io.Writer, output, input []periods.Period, granularity periods.Granularity, width int) error {
+	header := []string{"PRODNUM", "START", "END", "PRICE", "PRIORITY", "REASON"}
+	reasons := adjustmentReasons(input, output)
+	rows := make([][]string, len(output))
+	widths := make([]int, len(header))
+	for i, title := range header {
+		widths[i] = len(title)
+	}
+	for i, p := range output {
+		rows[i] = []string{
+			strconv.Itoa(p.ProdNum),
+			p.PeriodStart.Format(boundaryLayout(granularity)),
+			p.PeriodEnd.Format(boundaryLayout(granularity)),
+			p.Price.String(),
+			strconv.Itoa(p.PeriodPriority),
+			reasons[i],
+		}
+		for c, cell := range rows[i] {
+			widths[c] = max(widths[c], len(cell))
+		}
+	}
+	// the fixed columns always show in full, the reason gets what is left of the width
+	fixed := 0
+	for _, columnWidth := range widths[:len(widths)-1] {
+		fixed += columnWidth + 2
+	}
+	reasonWidth := max(min(widths[len(widths)-1], width-fixed), len("REASON"))
+	widths[len(widths)-1] = reasonWidth
+
+	line := func(cells []string) string {
+		var b strings.Builder
+		for c, cell := range cells {
+			if len(cell) > widths[c] {
+				cell = cell[:widths[c]-1] + "~"
+			}
+			if c > 0 {
+				b.WriteString("  ")
+			}
+			// numbers right aligned, text left aligned
+			if c == 0 || c == 3 || c == 4 {
+				fmt.Fprintf(&b, "%*s", widths[c], cell)
+			} else {
+				fmt.Fprintf(&b, "%-*s", widths[c], cell)
+			}
+		}
+		return strings.TrimRight(b.String(), " ") + "\n"
+	}
+	separator := strings.Repeat("-", fixed+reasonWidth) + "\n"
+	out := line(header) + separator
+	for i, row := range rows {
+		if i > 0 && output[i].ProdNum != output[i-1].ProdNum {
+			out += separator
+		}
+		out += line(row)
+	}
+	if _, err := io.WriteString(w, out); err != nil {
+		return fmt.Errorf("error writing table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestAdjustmentReasons(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31")},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20")},
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")},
+		{ID: 4, ProdNum: 2, PeriodStart: day("2024-01-05"), PeriodEnd: day("2024-01-20")},
+	}
+	output := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-14")},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20")},
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-21"), PeriodEnd: day("2024-01-31")},
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")},
+		{ID: 4, ProdNum: 2, PeriodStart: day("2024-01-11"), PeriodEnd: day("2024-01-20")},
+	}
+	want := []string{"split, end truncated", "", "split, start shifted", "", "start shifted"}
+	if got := adjustmentReasons(input, output); !slices.Equal(got, want) {
+		t.Errorf("reasons %q, want %q", got, want)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), Price: mustPrice("12.50"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), Price: mustPrice("9"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 12, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), Price: mustPrice("100"), PeriodPriority: 1},
+	}
+	output := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-09"), Price: mustPrice("12.50"), PeriodPriority: 2},
+		input[1],
+		input[2],
+	}
+	tests := []struct {
+		name  string
+		width int
+		want  string
+	}{
+		{"wide", 120, `
+PRODNUM  START       END          PRICE  PRIORITY  REASON
+----------------------------------------------------------------
+      7  2024-01-01  2024-01-09   12.50         2  end truncated
+      7  2024-01-10  2024-01-20    9.00         1
+----------------------------------------------------------------
+     12  2024-01-01  2024-01-31  100.00         1
+`},
+		// the reason is cut, the fixed columns never are
+		{"narrow", 50, `
+PRODNUM  START       END          PRICE  PRIORITY  REASON
+---------------------------------------------------------
+      7  2024-01-01  2024-01-09   12.50         2  end t~
+      7  2024-01-10  2024-01-20    9.00         1
+---------------------------------------------------------
+     12  2024-01-01  2024-01-31  100.00         1
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeTable(&b, output, input, periods.Day, tt.width); err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.TrimPrefix(tt.want, "\n"); b.String() != want {
+				t.Errorf("table\n%s\nwant\n%s", b.String(), want)
+			}
+		})
+	}
+}
+
+func TestWriteTableHourly(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01 06:00"), PeriodEnd: day("2024-01-01 18:00"), Price: mustPrice("12.50"), PeriodPriority: 1},
+	}
+	var b strings.Builder
+	if err := writeTable(&b, input, input, periods.GranularityOf(time.Hour), 120); err != nil {
+		t.Fatal(err)
+	}
+	// sub-day boundaries keep their time of day
+	if want := "      7  2024-01-01 06:00  2024-01-01 18:00  12.50         1\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("table\n%s\nwant a row\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// One segment of a product's effective price timeline
+type TimelineSegment struct {
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Price periods.Price `json:"price"`
+}
+
+// Group processed periods by product into ordered {from, to, price} segments,
+// gaps between periods are left out of the timeline rather than filled
+func priceTimeline(list []periods.Period) map[int][]TimelineSegment {
+	timeline := make(map[int][]TimelineSegment)
+	for _, p := range list {
+		timeline[p.ProdNum] = append(timeline[p.ProdNum], TimelineSegment{From: p.PeriodStart, To: p.PeriodEnd, Price: p.Price})
+	}
+	for _, segments := range timeline {
+		sort.SliceStable(segments, func(i, j int) bool { return segments[i].From.Before(segments[j].From) })
+	}
+	return timeline
+}
+
+// Write the effective price timeline as a JSON object keyed by ProdNum
+func writeTimeline(list []periods.Period, path string) error {
+	return writeTimelineSegments(priceTimeline(list), path)
+}
+
+// Write timeline segments as a JSON object keyed by ProdNum
+func writeTimelineSegments(timeline map[int][]TimelineSegment, path string) error {
+	// products in numeric order, encoding a map would sort the keys as strings
+	prodNums := make([]int, 0, len(timeline))
+	for prodNum := range timeline {
+		prodNums = append(prodNums, prodNum)
+	}
+	sort.Ints(prodNums)
+	out := make([]byte, 0, 1024)
+	out = append(out, '{')
+	for i, prodNum := range prodNums {
+		segments, err := json.Marshal(timeline[prodNum])
+		if err != nil {
+			return fmt.Errorf("error encoding timeline: %w", err)
+		}
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, "\n  "+strconv.Quote(strconv.Itoa(prodNum))+": "...)
+		out = append(out, segments...)
+	}
+	out = append(out, "\n}\n"...)
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("error writing timeline file: %w", err)
+	}
+	fmt.Printf("Price timeline written to %s: %v products\n", path, len(timeline))
+	return nil
+}
+
+// Read a timeline written by a previous run, a missing file means there is no prior run
+func readTimeline(path string) (map[int][]TimelineSegment, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading prior timeline: %w", err)
+	}
+	var timeline map[int][]TimelineSegment
+	if err := json.Unmarshal(data, &timeline); err != nil {
+		return nil, fmt.Errorf("error parsing prior timeline: %w", err)
+	}
+	for _, segments := range timeline {
+		sort.SliceStable(segments, func(i, j int) bool { return segments[i].From.Before(segments[j].From) })
+	}
+	return timeline, nil
+}
+
+// Segments of the timeline whose price is not the same over their whole range in the prior timeline,
+// without a prior timeline every segment has changed
+func changedSegments(timeline, prior map[int][]TimelineSegment, closed bool, granularity periods.Granularity) map[int][]TimelineSegment {
+	// exclusive end of a segment: in closed mode the end granule itself is covered
+	exclusiveEnd := func(s TimelineSegment) time.Time {
+		if closed {
+			return periods.AddGranules(s.To, 1, granularity)
+		}
+		return s.To
+	}
+	changed := make(map[int][]TimelineSegment)
+	for prodNum, segments := range timeline {
+		for _, segment := range segments {
+			covered := segment.From
+			for _, previous := range prior[prodNum] {
+				if !exclusiveEnd(previous).After(covered) {
+					continue
+				}
+				if previous.From.After(covered) || previous.Price != segment.Price {
+					break // gap or different price in the prior timeline
+				}
+				covered = exclusiveEnd(previous)
+				if !covered.Before(exclusiveEnd(segment)) {
+					break
+				}
+			}
+			if covered.Before(exclusiveEnd(segment)) {
+				changed[prodNum] = append(changed[prodNum], segment)
+			}
+		}
+	}
+	return changed
+}
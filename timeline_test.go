@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestWriteTimeline(t *testing.T) {
+	list := []periods.Period{
+		{ID: 3, ProdNum: 10, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), Price: mustPrice("5")},
+		{ID: 2, ProdNum: 9, PeriodStart: day("2024-01-21"), PeriodEnd: day("2024-01-31"), Price: mustPrice("12")},
+		{ID: 1, ProdNum: 9, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10")},
+	}
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	if err := writeTimeline(list, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// products in numeric order, not "10" before "9"
+	if first, second := strings.Index(string(data), `"9"`), strings.Index(string(data), `"10"`); first < 0 || second < first {
+		t.Errorf("products out of numeric order:\n%s", data)
+	}
+	var timeline map[string][]TimelineSegment
+	if err := json.Unmarshal(data, &timeline); err != nil {
+		t.Fatalf("timeline is not valid JSON: %v\n%s", err, data)
+	}
+	// segments in start order with the gap between them left out
+	want := []TimelineSegment{
+		{From: day("2024-01-01"), To: day("2024-01-10"), Price: mustPrice("10")},
+		{From: day("2024-01-21"), To: day("2024-01-31"), Price: mustPrice("12")},
+	}
+	got := timeline["9"]
+	if len(got) != len(want) {
+		t.Fatalf("product 9 segments %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].From.Equal(want[i].From) || !got[i].To.Equal(want[i].To) || got[i].Price != want[i].Price {
+			t.Errorf("segment %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if len(timeline["10"]) != 1 {
+		t.Errorf("product 10 segments %+v, want one", timeline["10"])
+	}
+}
+
+func TestChangedSegments(t *testing.T) {
+	segment := func(from, to string, price periods.Price) TimelineSegment {
+		return TimelineSegment{From: day(from), To: day(to), Price: price}
+	}
+	current := map[int][]TimelineSegment{7: {segment("2024-01-01", "2024-01-10", 10)}}
+	tests := []struct {
+		name        string
+		prior       map[int][]TimelineSegment
+		closed      bool
+		wantChanged bool
+	}{
+		{"no prior run", nil, false, true},
+		{"same segment", map[int][]TimelineSegment{7: {segment("2024-01-01", "2024-01-10", 10)}}, false, false},
+		{"covered by adjacent segments of the same price", map[int][]TimelineSegment{7: {segment("2023-12-01", "2024-01-05", 10), segment("2024-01-05", "2024-02-01", 10)}}, false, false},
+		{"adjacent closed segments", map[int][]TimelineSegment{7: {segment("2024-01-01", "2024-01-04", 10), segment("2024-01-05", "2024-01-10", 10)}}, true, false},
+		{"one day gap half-open", map[int][]TimelineSegment{7: {segment("2024-01-01", "2024-01-04", 10), segment("2024-01-05", "2024-01-10", 10)}}, false, true},
+		{"price changed in part", map[int][]TimelineSegment{7: {segment("2024-01-01", "2024-01-05", 10), segment("2024-01-05", "2024-01-10", 11)}}, false, true},
+		{"prior ends early", map[int][]TimelineSegment{7: {segment("2024-01-01", "2024-01-08", 10)}}, false, true},
+		{"other product only", map[int][]TimelineSegment{8: {segment("2024-01-01", "2024-01-10", 10)}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := changedSegments(current, tt.prior, tt.closed, periods.Day)
+			if got := len(changed[7]) == 1; got != tt.wantChanged {
+				t.Errorf("changed %+v, want changed %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestReadTimelineRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if prior, err := readTimeline(filepath.Join(dir, "missing.json")); prior != nil || err != nil {
+		t.Errorf("missing prior timeline read as %v, %v; want none", prior, err)
+	}
+	path := filepath.Join(dir, "timeline.json")
+	list := []periods.Period{{ID: 1, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10")}}
+	if err := writeTimeline(list, path); err != nil {
+		t.Fatal(err)
+	}
+	prior, err := readTimeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unchanged run has no changed segments
+	if changed := changedSegments(priceTimeline(list), prior, false, periods.Day); len(changed) != 0 {
+		t.Errorf("changed %+v against its own timeline", changed)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// Write removal explanations as a JSON array
+func writeRemovals(path string, removals *periods.RemovalLog) error {
+	data, err := json.MarshalIndent(removals.Removals, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding removals: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing removals: %w", err)
+	}
+	fmt.Printf("Removal explanations written to %s: %v\n", path, len(removals.Removals))
+	return nil
+}
+
+// Graphviz node id of a period, split fragments share their parent's ID so dates are part of it
+func dotNodeID(p periods.Period) string {
+	return fmt.Sprintf("\"%d_%s_%s\"", p.ID, p.PeriodStart.Format("20060102"), p.PeriodEnd.Format("20060102"))
+}
+
+func dotNodeLabel(p periods.Period) string {
+	return fmt.Sprintf("ID %d\\n%s to %s\\npriority %d, price %v",
+		p.ID, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"), p.PeriodPriority, p.Price)
+}
+
+// Render the traced product's input periods, the decisions between them and
+// the resulting fragments as a Graphviz dot graph
+func traceDot(trace *periods.DecisionTrace, input, output []periods.Period) string {
+	var b strings.Builder
+	declared := make(map[string]bool)
+	declare := func(p periods.Period, style string) {
+		id := dotNodeID(p)
+		if declared[id] {
+			return
+		}
+		declared[id] = true
+		fmt.Fprintf(&b, "    %s [label=\"%s\", style=%s];\n", id, dotNodeLabel(p), style)
+	}
+	fmt.Fprintf(&b, "digraph prodnum_%d {\n  rankdir=LR;\n  node [shape=box];\n", trace.ProdNum)
+	b.WriteString("  subgraph cluster_input {\n    label=\"input\";\n")
+	for _, p := range input {
+		if p.ProdNum == trace.ProdNum {
+			declare(p, "solid")
+		}
+	}
+	b.WriteString("  }\n  subgraph cluster_output {\n    label=\"output\";\n")
+	for _, p := range output {
+		if p.ProdNum == trace.ProdNum {
+			declare(p, "bold")
+		}
+	}
+	b.WriteString("  }\n")
+	// intermediate fragments reached during processing but neither input nor output
+	for _, event := range trace.Events {
+		declare(event.Current, "dashed")
+		declare(event.Next, "dashed")
+	}
+	for _, event := range trace.Events {
+		fmt.Fprintf(&b, "  %s -> %s [label=\"%s\"];\n", dotNodeID(event.Current), dotNodeID(event.Next), event.Action)
+	}
+	// link each input period to the output fragments it resulted in
+	for _, in := range input {
+		for _, out := range output {
+			if in.ProdNum == trace.ProdNum && out.ProdNum == trace.ProdNum && in.ID == out.SourceID() && dotNodeID(in) != dotNodeID(out) {
+				fmt.Fprintf(&b, "  %s -> %s [label=\"fragment\", style=dotted];\n", dotNodeID(in), dotNodeID(out))
+			}
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Write the trace graph to a .dot file
+func writeTraceDot(path string, trace *periods.DecisionTrace, input, output []periods.Period) error {
+	if err := os.WriteFile(path, []byte(traceDot(trace, input, output)), 0644); err != nil {
+		return fmt.Errorf("error writing trace graph: %w", err)
+	}
+	fmt.Printf("Trace graph for prodnum %d written to %s\n", trace.ProdNum, path)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestTraceDot(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 2},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-15"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 1, PeriodStart: day("2024-01-25"), PeriodEnd: day("2024-02-10"), PeriodPriority: 1},
+		{ID: 4, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+	}
+	trace := &periods.DecisionTrace{ProdNum: 1}
+	output, err := periods.ProcessPeriods(slices.Clone(input), periods.ProcessOptions{Trace: trace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Events) == 0 {
+		t.Fatal("no decisions traced for the product")
+	}
+	dot := traceDot(trace, input, output)
+
+	// a single digraph of balanced braces and quotes whose statements all end in ;
+	if !strings.HasPrefix(dot, "digraph prodnum_1 {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("dot is not a single digraph:\n%s", dot)
+	}
+	if strings.Count(dot, "{") != strings.Count(dot, "}") || strings.Count(dot, "\"")%2 != 0 {
+		t.Errorf("unbalanced braces or quotes:\n%s", dot)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(dot), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasSuffix(line, ";") && !strings.HasSuffix(line, "{") && line != "}" {
+			t.Errorf("unterminated statement %q", line)
+		}
+	}
+	for _, p := range input {
+		declared := strings.Contains(dot, dotNodeID(p)+" [label=")
+		if want := p.ProdNum == 1; declared != want {
+			t.Errorf("node for period %d of prodnum %d declared: %v, want %v", p.ID, p.ProdNum, declared, want)
+		}
+	}
+}
+
+func TestExplainRemovals(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), PeriodPriority: 2},
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 2},
+		{ID: 4, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+	}
+	removals := &periods.RemovalLog{}
+	if _, err := periods.ProcessPeriods(input, periods.ProcessOptions{Removals: removals}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "removals.json")
+	if err := writeRemovals(path, removals); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []periods.Removal
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	want := []periods.Removal{
+		{RemovedID: 2, SurvivorID: 1, Reason: "contained in higher priority period"},
+		{RemovedID: 3, SurvivorID: 4, Reason: "coincident with higher priority period"},
+	}
+	if !slices.Equal(written, want) {
+		t.Errorf("removals %+v, want %+v", written, want)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// validation rule codes
+const (
+	RuleInvertedPeriod = "inverted_period"
+	RuleNegativePrice  = "negative_price"
+	RuleDuplicateID    = "duplicate_id"
+	RuleZeroDate       = "zero_date"
+	RulePriceOutOfBand = "price_out_of_band"
+)
+
+// a period that broke a validation rule
+type ValidationIssue struct {
+	Rule string
+	periods.Period
+}
+
+// Run all validators over fetched periods and return every issue found
+func validatePeriods(list []periods.Period) []ValidationIssue {
+	var issues []ValidationIssue
+	seenIDs := make(map[int]bool, len(list))
+	for _, p := range list {
+		if p.PeriodEnd.Before(p.PeriodStart) {
+			issues = append(issues, ValidationIssue{Rule: RuleInvertedPeriod, Period: p})
+		}
+		if p.Price < 0 {
+			issues = append(issues, ValidationIssue{Rule: RuleNegativePrice, Period: p})
+		}
+		if seenIDs[p.ID] {
+			issues = append(issues, ValidationIssue{Rule: RuleDuplicateID, Period: p})
+		}
+		seenIDs[p.ID] = true
+		if p.PeriodStart.IsZero() || p.PeriodEnd.IsZero() {
+			issues = append(issues, ValidationIssue{Rule: RuleZeroDate, Period: p})
+		}
+	}
+	return issues
+}
+
+// Aggregate validation issues into counts per rule code
+func countIssuesByRule(issues []ValidationIssue) map[string]int {
+	counts := make(map[string]int)
+	for _, issue := range issues {
+		counts[issue.Rule]++
+	}
+	return counts
+}
+
+// expected price range of a product
+type PriceBand struct {
+	Min periods.Price `json:"min"`
+	Max periods.Price `json:"max"`
+}
+
+// Load expected price ranges keyed by ProdNum from a JSON file
+func loadPriceBands(path string) (map[int]PriceBand, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading price bands: %w", err)
+	}
+	var bands map[int]PriceBand
+	if err := json.Unmarshal(data, &bands); err != nil {
+		return nil, fmt.Errorf("error parsing price bands: %w", err)
+	}
+	for prodNum, band := range bands {
+		if band.Min > band.Max {
+			return nil, fmt.Errorf("price band of prodnum %d has min %v above max %v", prodNum, band.Min, band.Max)
+		}
+	}
+	return bands, nil
+}
+
+// Flag periods priced outside their product's expected range, products without a band are not checked
+func checkPriceBands(list []periods.Period, bands map[int]PriceBand) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, p := range list {
+		band, ok := bands[p.ProdNum]
+		if ok && (p.Price < band.Min || p.Price > band.Max) {
+			issues = append(issues, ValidationIssue{Rule: RulePriceOutOfBand, Period: p})
+		}
+	}
+	return issues
+}
+
+// Drop periods with a start or end outside of [minDate, maxDate] (zero dates, epoch defaults),
+// logging each of them, or fail on the first one in strict mode
+func checkDateRange(list []periods.Period, minDate, maxDate time.Time, strict bool) ([]periods.Period, error) {
+	inRange := list[:0]
+	for _, p := range list {
+		if p.PeriodStart.Before(minDate) || p.PeriodStart.After(maxDate) || p.PeriodEnd.Before(minDate) || (p.PeriodEnd.After(maxDate) && !p.PeriodEnd.Equal(openPeriodEnd)) {
+			if strict {
+				return nil, fmt.Errorf("period id %d (prodnum %d) from %s to %s is outside of the plausible range %s to %s",
+					p.ID, p.ProdNum, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"),
+					minDate.Format("2006-01-02"), maxDate.Format("2006-01-02"))
+			}
+			slog.Warn("skipping period outside of the plausible range", "id", p.ID, "prodnum", p.ProdNum,
+				"start", p.PeriodStart.Format("2006-01-02"), "end", p.PeriodEnd.Format("2006-01-02"))
+			continue
+		}
+		inRange = append(inRange, p)
+	}
+	return inRange, nil
+}
+
+// Find periods ending before they start, or on their start in half-open mode where they cover nothing,
+// dropping and logging each of them when skip is set, otherwise failing with all of them
+func checkPeriodLengths(list []periods.Period, closed, skip bool) ([]periods.Period, error) {
+	valid := list[:0]
+	var errs []error
+	for _, p := range list {
+		inverted := p.PeriodEnd.Before(p.PeriodStart)
+		if !inverted && (closed || !p.PeriodEnd.Equal(p.PeriodStart)) {
+			valid = append(valid, p)
+			continue
+		}
+		problem := "zero length"
+		if inverted {
+			problem = "inverted"
+		}
+		if skip {
+			slog.Warn("skipping "+problem+" period", "id", p.ID, "prodnum", p.ProdNum,
+				"start", p.PeriodStart.Format("2006-01-02"), "end", p.PeriodEnd.Format("2006-01-02"))
+			continue
+		}
+		err := fmt.Errorf("period id %d (prodnum %d) from %s to %s is %s",
+			p.ID, p.ProdNum, p.PeriodStart.Format("2006-01-02"), p.PeriodEnd.Format("2006-01-02"), problem)
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d invalid periods, set processing.skipInvalidPeriods to skip them: %w", len(errs), errors.Join(errs...))
+	}
+	return valid, nil
+}
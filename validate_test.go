@@ -0,0 +1,159 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestValidatePeriodsCountsByRule(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), Price: mustPrice("10")},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-01"), Price: mustPrice("-1")},
+		{ID: 2, ProdNum: 2, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-05"), Price: mustPrice("10")},
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-10"), PeriodEnd: time.Time{}, Price: mustPrice("10")},
+	}
+	want := map[string]int{RuleInvertedPeriod: 3, RuleNegativePrice: 1, RuleDuplicateID: 1, RuleZeroDate: 1}
+	if got := countIssuesByRule(validatePeriods(input)); !maps.Equal(got, want) {
+		t.Errorf("counts %v, want %v", got, want)
+	}
+}
+
+func TestCheckPriceBands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bands.json")
+	if err := os.WriteFile(path, []byte(`{"7": {"min": 10, "max": 20}, "8": {"min": 0, "max": 5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bands, err := loadPriceBands(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		prodNum int
+		price   string
+		flagged bool
+	}{
+		{"in band", 7, "15", false},
+		{"on the band edge", 7, "20", false},
+		{"below band", 7, "9.99", true},
+		{"above band", 8, "5.01", true},
+		{"product without a band", 9, "1000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := checkPriceBands([]periods.Period{{ID: 1, ProdNum: tt.prodNum, Price: mustPrice(tt.price)}}, bands)
+			if flagged := len(issues) == 1 && issues[0].Rule == RulePriceOutOfBand; flagged != tt.flagged || len(issues) > 1 {
+				t.Errorf("issues %+v, want flagged %v", issues, tt.flagged)
+			}
+		})
+	}
+}
+
+func TestLoadPriceBandsInverted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bands.json")
+	if err := os.WriteFile(path, []byte(`{"7": {"min": 20, "max": 10}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPriceBands(path); err == nil {
+		t.Error("no error for a band with min above max")
+	}
+}
+
+func TestCheckDateRange(t *testing.T) {
+	minDate, maxDate := day("2000-01-01"), day("2100-12-31")
+	input := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")},
+		{ID: 2, ProdNum: 1, PeriodStart: time.Time{}, PeriodEnd: day("2024-01-10")},
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-01"), PeriodEnd: day("2150-12-31")},
+		{ID: 4, ProdNum: 2, PeriodStart: day("2000-01-01"), PeriodEnd: day("2100-12-31")},
+		// open ends are past the range but plausible
+		{ID: 5, ProdNum: 3, PeriodStart: day("2024-01-01"), PeriodEnd: openPeriodEnd},
+	}
+	tests := []struct {
+		name         string
+		strict       bool
+		wantIDs      []int
+		wantErr      bool
+		wantWarnings []string
+	}{
+		{"implausible dates skipped", false, []int{1, 4, 5}, false, []string{"id=2 prodnum=1 start=0001-01-01", "id=3 prodnum=2 start=2024-01-01 end=2150-12-31"}},
+		{"implausible dates rejected", true, nil, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []periods.Period
+			var err error
+			logged := captureLog(t, func() { got, err = checkDateRange(slices.Clone(input), minDate, maxDate, tt.strict) })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			var ids []int
+			for _, p := range got {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("kept %v, want %v", ids, tt.wantIDs)
+			}
+			if warnings := strings.Count(logged, "level=WARN"); warnings != len(tt.wantWarnings) {
+				t.Errorf("logged %d warnings, want %d: %q", warnings, len(tt.wantWarnings), logged)
+			}
+			for _, want := range tt.wantWarnings {
+				if !strings.Contains(logged, want) {
+					t.Errorf("logged %q, want a warning with %q", logged, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPeriodLengths(t *testing.T) {
+	input := []periods.Period{
+		{ID: 1, ProdNum: 1, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10")},
+		{ID: 2, ProdNum: 1, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-01")},
+		{ID: 3, ProdNum: 2, PeriodStart: day("2024-01-05"), PeriodEnd: day("2024-01-05")},
+	}
+	tests := []struct {
+		name         string
+		closed, skip bool
+		wantIDs      []int
+		wantErr      []string
+	}{
+		{"half-open rejects inverted and zero length", false, false, nil, []string{"2 invalid periods", "period id 2 (prodnum 1) from 2024-01-10 to 2024-01-01 is inverted", "period id 3 (prodnum 2) from 2024-01-05 to 2024-01-05 is zero length"}},
+		{"closed keeps a single day", true, false, nil, []string{"1 invalid periods", "period id 2 (prodnum 1)"}},
+		{"half-open skips", false, true, []int{1}, nil},
+		{"closed skips", true, true, []int{1, 3}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := checkPeriodLengths(slices.Clone(input), tt.closed, tt.skip)
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatalf("kept %d periods, want an error", len(valid))
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not name %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, p := range valid {
+				ids = append(ids, p.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("kept IDs %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
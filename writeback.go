@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+// output table column names of the Period fields, empty names default to the field name
+type ColumnMapping struct {
+	ID             string `json:"id"`
+	PeriodStart    string `json:"periodStart"`
+	PeriodEnd      string `json:"periodEnd"`
+	Price          string `json:"price"`
+	ProdNum        string `json:"prodNum"`
+	PeriodPriority string `json:"periodPriority"`
+}
+
+// Quoted column names in Period field order (same order as scanned and as statement parameters)
+func (m ColumnMapping) columns() []string {
+	names := []struct{ column, field string }{
+		{m.ID, "ID"},
+		{m.PeriodStart, "PeriodStart"},
+		{m.PeriodEnd, "PeriodEnd"},
+		{m.Price, "Price"},
+		{m.ProdNum, "ProdNum"},
+		{m.PeriodPriority, "PeriodPriority"},
+	}
+	columns := make([]string, len(names))
+	for i, name := range names {
+		if name.column == "" {
+			name.column = name.field
+		}
+		columns[i] = quoteTableName(name.column)
+	}
+	return columns
+}
+
+// Statement parameters of a period, in the order of the mapped columns, open ends as NULL
+func insertArgs(p periods.Period) []any {
+	var end any = p.PeriodEnd
+	if p.PeriodEnd.Equal(openPeriodEnd) {
+		end = nil
+	}
+	return []any{p.ID, p.PeriodStart, end, p.Price, p.ProdNum, p.PeriodPriority}
+}
+
+// Build the parameterized insert statement of a period row
+func buildInsertStatement(table string, m ColumnMapping) string {
+	columns := m.columns()
+	params := make([]string, len(columns))
+	for i := range columns {
+		params[i] = fmt.Sprintf("@p%d", i+1)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteTableName(table), strings.Join(columns, ", "), strings.Join(params, ", "))
+}
+
+// Build the statement deleting the rows of one product overlapping a window, with ProdNum as @p1 followed by
+// the set bounds: rows ending on or after from (open ends included) and starting on or before to
+func buildDeleteWindowStatement(table string, m ColumnMapping, window writeWindow) (string, []any) {
+	columns := m.columns()
+	conditions := []string{fmt.Sprintf("%s = @p1", columns[4])}
+	args := []any{nil}
+	if !window.From.IsZero() {
+		args = append(args, window.From)
+		conditions = append(conditions, fmt.Sprintf("(%s >= @p%d OR %s IS NULL)", columns[2], len(args), columns[2]))
+	}
+	if !window.To.IsZero() {
+		args = append(args, window.To)
+		conditions = append(conditions, fmt.Sprintf("%s <= @p%d", columns[1], len(args)))
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", quoteTableName(table), strings.Join(conditions, " AND ")), args
+}
+
+// Build the statement selecting all stored periods, columns in Period field order aliased to the field names,
+// so the scanner matches mapped columns by name
+func buildSelectStatement(table string, m ColumnMapping) string {
+	columns := m.columns()
+	for i, column := range columns {
+		columns[i] = fmt.Sprintf("%s AS [%s]", column, periodColumns[i])
+	}
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), quoteTableName(table))
+}
+
+// Build the condition limiting stored rows to a run scope, with the since date as its parameter @p1 when set:
+// rows of the scoped products (inlined, prodnums are integers) that end on or after the date or have open ends
+func buildScopeCondition(m ColumnMapping, scope runScope) (string, []any) {
+	columns := m.columns()
+	var conditions []string
+	var args []any
+	if len(scope.ProdNums) > 0 {
+		prodNums := make([]int, 0, len(scope.ProdNums))
+		for prodNum := range scope.ProdNums {
+			prodNums = append(prodNums, prodNum)
+		}
+		slices.Sort(prodNums)
+		list := make([]string, len(prodNums))
+		for i, prodNum := range prodNums {
+			list[i] = strconv.Itoa(prodNum)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", columns[4], strings.Join(list, ", ")))
+	}
+	if !scope.Since.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("(%s >= @p1 OR %s IS NULL)", columns[2], columns[2]))
+		args = append(args, scope.Since)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Map a configured isolation level name onto sql.IsolationLevel, driver default when empty
+func parseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, " ", "")) {
+	case "":
+		return sql.LevelDefault, nil
+	case "readuncommitted":
+		return sql.LevelReadUncommitted, nil
+	case "readcommitted":
+		return sql.LevelReadCommitted, nil
+	case "repeatableread":
+		return sql.LevelRepeatableRead, nil
+	case "snapshot":
+		return sql.LevelSnapshot, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", name)
+}
+
+// db handle write-back transactions are started on, *sql.DB in production
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Begin the write-back transaction at the configured isolation level
+func beginWriteTx(ctx context.Context, db txBeginner, config *Config) (*sql.Tx, error) {
+	level, err := parseIsolationLevel(config.Database.IsolationLevel)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: level})
+	if err != nil {
+		return nil, fmt.Errorf("error starting write transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// Build the statement selecting the lowest stored ID, 0 when no row has a negative one
+func buildMinIDStatement(table string, m ColumnMapping) string {
+	return fmt.Sprintf("SELECT COALESCE(MIN(%s), 0) FROM %s", m.columns()[0], quoteTableName(table))
+}
+
+// Copy periods for writing with unique stored IDs: source periods keep their (positive) source IDs, split fragments,
+// gap fills and any further period of an ID get negative IDs counting down from below minStoredID, a key space
+// of their own that source IDs of any product never reach, in this run or a later one
+func uniqueRowIDs(processed []periods.Period, minStoredID int) []periods.Period {
+	nextID := min(minStoredID, 0)
+	rows := make([]periods.Period, len(processed))
+	seen := make(map[int]bool, len(processed))
+	for i, p := range processed {
+		if p.ID <= 0 || seen[p.ID] {
+			nextID--
+			p.ID = nextID
+		}
+		seen[p.ID] = true
+		rows[i] = p
+	}
+	return rows
+}
+
+// range of stored rows a write replaces, zero bounds do not limit it
+type writeWindow struct {
+	From, To time.Time
+}
+
+// Window a run's write replaces: from the later of the since date (-since runs) and the query window start,
+// up to the query window end, as periods outside the fetched range were never processed
+func (c *Config) writeWindow(since time.Time) (writeWindow, error) {
+	window := writeWindow{From: since}
+	from, to, err := c.queryWindow()
+	if err != nil {
+		return window, err
+	}
+	if from, ok := from.(time.Time); ok && from.After(window.From) {
+		window.From = from
+	}
+	if to, ok := to.(time.Time); ok {
+		window.To = to
+	}
+	return window, nil
+}
+
+// Check if a period lies outside the window
+func (w writeWindow) excludes(p periods.Period) bool {
+	return !w.From.IsZero() && p.PeriodEnd.Before(w.From) || !w.To.IsZero() && p.PeriodStart.After(w.To)
+}
+
+// Replace the stored periods of every written product in one transaction, any failure rolls back the whole write.
+// In runs limited to a window (-since, -from and -to) only rows overlapping it are replaced,
+// rows are inserted in ascending ID order when sortByID is set (-sort-output-by-id)
+func writePeriods(ctx context.Context, db *sql.DB, processed []periods.Period, config *Config, since time.Time, sortByID bool) error {
+	ctx, cancel := config.queryContext(ctx)
+	defer cancel()
+	window, err := config.writeWindow(since)
+	if err != nil {
+		return err
+	}
+	processed = slices.DeleteFunc(slices.Clone(processed), window.excludes)
+	tx, err := beginWriteTx(ctx, db, config)
+	if err != nil {
+		return err
+	}
+	// no-op once committed
+	defer tx.Rollback()
+
+	// delete existing rows of the affected products
+	deleted := make(map[int]bool)
+	deleteStatement, deleteArgs := buildDeleteWindowStatement(config.WriteTable, config.WriteColumns, window)
+	for _, p := range processed {
+		if deleted[p.ProdNum] {
+			continue
+		}
+		deleteArgs[0] = p.ProdNum
+		if _, err := tx.ExecContext(ctx, deleteStatement, deleteArgs...); err != nil {
+			return fmt.Errorf("error deleting periods of prodnum %d: %w", p.ProdNum, timeoutError(ctx, err))
+		}
+		deleted[p.ProdNum] = true
+	}
+	// split fragments and gap fills are written under fresh negative IDs below every stored row
+	var minStoredID int
+	if err := tx.QueryRowContext(ctx, buildMinIDStatement(config.WriteTable, config.WriteColumns)).Scan(&minStoredID); err != nil {
+		return fmt.Errorf("error reading min stored id: %w", err)
+	}
+	insert, err := tx.PrepareContext(ctx, buildInsertStatement(config.WriteTable, config.WriteColumns))
+	if err != nil {
+		return fmt.Errorf("error preparing insert: %w", err)
+	}
+	defer insert.Close()
+	rows := uniqueRowIDs(processed, minStoredID)
+	if sortByID {
+		sortPeriodsByID(rows)
+	}
+	inserted := 0
+	for _, p := range rows {
+		if _, err := insert.ExecContext(ctx, insertArgs(p)...); err != nil {
+			return fmt.Errorf("error inserting period id %d (prodnum %d): %w", p.ID, p.ProdNum, timeoutError(ctx, err))
+		}
+		inserted++
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing write: %w", timeoutError(ctx, err))
+	}
+	fmt.Printf("Periods written to %s: %v (replacing %d products)\n", config.WriteTable, inserted, len(deleted))
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/borowiak-m/file-processing-pricingperiods/periods"
+)
+
+func TestParseIsolationLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    sql.IsolationLevel
+		wantErr bool
+	}{
+		{"", sql.LevelDefault, false},
+		{"ReadCommitted", sql.LevelReadCommitted, false},
+		{"Read Committed", sql.LevelReadCommitted, false},
+		{"snapshot", sql.LevelSnapshot, false},
+		{"Serializable", sql.LevelSerializable, false},
+		{"Chaos", sql.LevelDefault, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIsolationLevel(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseIsolationLevel = %v, %v; want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// txBeginner recording the options write-back transactions are started with
+type recordingBeginner struct {
+	opts *sql.TxOptions
+}
+
+func (b *recordingBeginner) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	b.opts = opts
+	return nil, nil
+}
+
+func TestBeginWriteTxIsolationLevel(t *testing.T) {
+	var config Config
+	config.Database.IsolationLevel = "Snapshot"
+	var db recordingBeginner
+	if _, err := beginWriteTx(context.Background(), &db, &config); err != nil {
+		t.Fatal(err)
+	}
+	if db.opts == nil || db.opts.Isolation != sql.LevelSnapshot {
+		t.Errorf("transaction started with %+v, want snapshot isolation", db.opts)
+	}
+
+	config.Database.IsolationLevel = "Chaos"
+	db = recordingBeginner{}
+	if _, err := beginWriteTx(context.Background(), &db, &config); err == nil || db.opts != nil {
+		t.Errorf("unknown level started a transaction (error %v)", err)
+	}
+}
+
+func TestBuildSelectStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping ColumnMapping
+		want    string
+	}{
+		{"default columns", ColumnMapping{}, "SELECT [ID] AS [ID], [PeriodStart] AS [PeriodStart], [PeriodEnd] AS [PeriodEnd], [Price] AS [Price], " +
+			"[ProdNum] AS [ProdNum], [PeriodPriority] AS [PeriodPriority] FROM [dbo].[Periods]"},
+		{"mapped columns", ColumnMapping{ID: "PeriodID", Price: "UnitPrice", PeriodPriority: "Prio"}, "SELECT [PeriodID] AS [ID], [PeriodStart] AS [PeriodStart], " +
+			"[PeriodEnd] AS [PeriodEnd], [UnitPrice] AS [Price], [ProdNum] AS [ProdNum], [Prio] AS [PeriodPriority] FROM [dbo].[Periods]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildSelectStatement("dbo.Periods", tt.mapping); got != tt.want {
+				t.Errorf("statement\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchTablePeriodsMappedColumns(t *testing.T) {
+	config := &Config{WriteTable: "Periods", WriteColumns: ColumnMapping{Price: "UnitPrice", PeriodPriority: "Prio"}}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the server names result columns after the aliases
+	mock.ExpectQuery(regexp.QuoteMeta(buildSelectStatement(config.WriteTable, config.WriteColumns))).
+		WillReturnRows(sqlmock.NewRows(periodQueryColumns).AddRow(1, day("2024-01-01"), day("2024-01-10"), "12.50", 7, 3))
+	stored, err := fetchTablePeriods(context.Background(), db, config, runScope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := stored[0]; p.Price != mustPrice("12.50") || p.PeriodPriority != 3 {
+		t.Errorf("stored period price %v priority %d, want 12.50 and 3", p.Price, p.PeriodPriority)
+	}
+}
+
+func TestFetchTablePeriodsScope(t *testing.T) {
+	config := &Config{WriteTable: "Periods"}
+	since := day("2024-03-01")
+	tests := []struct {
+		name      string
+		scope     runScope
+		condition string
+		args      []driver.Value
+	}{
+		{"whole table", runScope{}, "", nil},
+		{"products", runScope{ProdNums: map[int]bool{9: true, 7: true}}, " WHERE [ProdNum] IN (7, 9)", nil},
+		{"since", runScope{Since: since}, " WHERE ([PeriodEnd] >= @p1 OR [PeriodEnd] IS NULL)", []driver.Value{since}},
+		{"products since", runScope{ProdNums: map[int]bool{9: true, 7: true}, Since: since},
+			" WHERE [ProdNum] IN (7, 9) AND ([PeriodEnd] >= @p1 OR [PeriodEnd] IS NULL)", []driver.Value{since}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			query := mock.ExpectQuery(buildSelectStatement(config.WriteTable, config.WriteColumns) + tt.condition)
+			if tt.args != nil {
+				query.WithArgs(tt.args...)
+			} else {
+				query.WithoutArgs()
+			}
+			query.WillReturnRows(sqlmock.NewRows(periodQueryColumns))
+			if _, err := fetchTablePeriods(context.Background(), db, config, tt.scope); err != nil {
+				t.Fatal(err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWritePeriodsWindow(t *testing.T) {
+	insert := buildInsertStatement("Periods", ColumnMapping{})
+	tests := []struct {
+		name             string
+		queryFrom, since string
+		queryTo          string
+		deleteStatement  string
+		deleteArgs       []driver.Value
+	}{
+		{
+			name:            "whole products",
+			deleteStatement: "DELETE FROM [Periods] WHERE [ProdNum] = @p1",
+			deleteArgs:      []driver.Value{7},
+		},
+		{
+			name:            "since",
+			since:           "2024-02-01",
+			deleteStatement: "DELETE FROM [Periods] WHERE [ProdNum] = @p1 AND ([PeriodEnd] >= @p2 OR [PeriodEnd] IS NULL)",
+			deleteArgs:      []driver.Value{7, day("2024-02-01")},
+		},
+		{
+			name:            "query window",
+			queryFrom:       "2024-02-01",
+			queryTo:         "2024-02-29",
+			deleteStatement: "DELETE FROM [Periods] WHERE [ProdNum] = @p1 AND ([PeriodEnd] >= @p2 OR [PeriodEnd] IS NULL) AND [PeriodStart] <= @p3",
+			deleteArgs:      []driver.Value{7, day("2024-02-01"), day("2024-02-29")},
+		},
+		{
+			name:            "query window within since",
+			since:           "2024-01-15",
+			queryFrom:       "2024-02-01",
+			deleteStatement: "DELETE FROM [Periods] WHERE [ProdNum] = @p1 AND ([PeriodEnd] >= @p2 OR [PeriodEnd] IS NULL)",
+			deleteArgs:      []driver.Value{7, day("2024-02-01")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			config := &Config{WriteTable: "Periods", QueryFrom: tt.queryFrom, QueryTo: tt.queryTo}
+			var since time.Time
+			if tt.since != "" {
+				since = day(tt.since)
+			}
+			processed := []periods.Period{
+				{ID: 4, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), PeriodPriority: 1},
+				{ID: 5, ProdNum: 7, PeriodStart: day("2024-02-01"), PeriodEnd: day("2024-02-10"), PeriodPriority: 1},
+				{ID: -1, ParentID: 5, ProdNum: 7, PeriodStart: day("2024-02-20"), PeriodEnd: day("2024-03-10"), PeriodPriority: 1},
+			}
+			mock.ExpectBegin()
+			mock.ExpectExec(tt.deleteStatement).WithArgs(tt.deleteArgs...).WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectQuery(buildMinIDStatement("Periods", ColumnMapping{})).WillReturnRows(sqlmock.NewRows([]string{""}).AddRow(-3))
+			prepared := mock.ExpectPrepare(insert)
+			// only periods within the window are written, the ones before it stay as stored
+			if tt.since == "" && tt.queryFrom == "" {
+				prepared.ExpectExec().WithArgs(4, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 7, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			prepared.ExpectExec().WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 7, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			prepared.ExpectExec().WithArgs(-4, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 7, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			if err := writePeriods(context.Background(), db, processed, config, since, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUniqueRowIDs(t *testing.T) {
+	processed := []periods.Period{
+		{ID: 5, ProdNum: 1},
+		{ID: -1, ParentID: 5, ProdNum: 1},
+		{ID: 5, ProdNum: 2},
+		{ID: -2, ProdNum: 2},
+		{ID: 900, ProdNum: 3},
+	}
+	tests := []struct {
+		name        string
+		minStoredID int
+		want        []int
+	}{
+		{"no fragments stored", 1, []int{5, -1, -2, -3, 900}},
+		{"below stored fragments", -7, []int{5, -8, -9, -10, 900}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, p := range uniqueRowIDs(processed, tt.minStoredID) {
+				got = append(got, p.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePeriodsAfterSampling(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	config := &Config{WriteTable: "Periods"}
+	processed := []periods.Period{
+		{ID: 4, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), PeriodPriority: 1},
+		{ID: 5, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		{ID: 6, ProdNum: 7, PeriodStart: day("2024-01-20"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+	}
+	// the sample only feeds the outputs, the write-back still replaces the product with every processed period
+	if sample := samplePeriods(processed, 1); len(sample) != 1 || len(processed) != 3 {
+		t.Fatalf("sample of %d and %d processed periods, want 1 and 3", len(sample), len(processed))
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM [Periods] WHERE [ProdNum] = @p1").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery(buildMinIDStatement("Periods", ColumnMapping{})).WillReturnRows(sqlmock.NewRows([]string{""}).AddRow(1))
+	prepared := mock.ExpectPrepare(buildInsertStatement("Periods", ColumnMapping{}))
+	for _, id := range []int{4, 5, 6} {
+		prepared.ExpectExec().WithArgs(id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 7, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	if err := writePeriods(context.Background(), db, processed, config, time.Time{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWritePeriodsSortByID(t *testing.T) {
+	processed := []periods.Period{
+		{ID: 9, ProdNum: 7, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-10"), PeriodPriority: 1},
+		{ID: 3, ProdNum: 7, PeriodStart: day("2024-01-10"), PeriodEnd: day("2024-01-20"), PeriodPriority: 1},
+		{ID: -1, ParentID: 9, ProdNum: 7, PeriodStart: day("2024-01-20"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+		{ID: 5, ProdNum: 8, PeriodStart: day("2024-01-01"), PeriodEnd: day("2024-01-31"), PeriodPriority: 1},
+	}
+	tests := []struct {
+		name     string
+		sortByID bool
+		wantIDs  []int
+	}{
+		{"processing order", false, []int{9, 3, -2, 5}},
+		// a fragment follows the period it was split from
+		{"id order", true, []int{3, 5, 9, -2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectBegin()
+			for _, prodNum := range []int{7, 8} {
+				mock.ExpectExec("DELETE FROM [Periods] WHERE [ProdNum] = @p1").WithArgs(prodNum).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectQuery(buildMinIDStatement("Periods", ColumnMapping{})).WillReturnRows(sqlmock.NewRows([]string{""}).AddRow(-1))
+			prepared := mock.ExpectPrepare(buildInsertStatement("Periods", ColumnMapping{}))
+			for _, id := range tt.wantIDs {
+				prepared.ExpectExec().WithArgs(id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+			if err := writePeriods(context.Background(), db, processed, &Config{WriteTable: "Periods"}, time.Time{}, tt.sortByID); err != nil {
+				t.Fatal(err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}